@@ -0,0 +1,162 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	"context"
+	"io"
+
+	"github.com/nyaosorg/go-readline-ny"
+)
+
+// enterMiniBuffer shows text fitted to the terminal in the minibuffer
+// and erases the rest of the line, such as a longer message shown before.
+func (M *Mode) enterMiniBuffer(B *readline.Buffer, text string) {
+	M.MiniBuffer.Enter(B.Out, fitToTerminal(B, text))
+	M.terminal().EraseToEnd(B.Out)
+}
+
+func (M *Mode) message(B *readline.Buffer, text string) {
+	M.enterMiniBuffer(B, text)
+	M.MiniBuffer.Leave(B.Out)
+	B.RepaintAfterPrompt()
+}
+
+// getKey reads a key like B.GetKey, but returns ctx.Err() as soon as ctx is canceled.
+// Only one goroutine of SKK reads the terminal of B: the key being read
+// when ctx is canceled is kept in pendingKey and returned by the next read
+// instead of starting another goroutine, so the key is not dropped.
+func (M *Mode) getKey(ctx context.Context, B *readline.Buffer) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	st := M.stateOf(B)
+	if st.pendingKey == nil && ctx.Done() == nil {
+		return getKeyUnwrapped(B)
+	}
+	ch := M.startKey(B)
+	select {
+	case r := <-ch:
+		st.pendingKey = nil
+		return r.key, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// resultOnError returns the result of the command which failed to read a key.
+// When ctx is canceled, the editor is interrupted.
+func resultOnError(ctx context.Context) readline.Result {
+	if ctx.Err() != nil {
+		return readline.INTR
+	}
+	return readline.CONTINUE
+}
+
+func (M *Mode) ask1(ctx context.Context, B *readline.Buffer, prompt string) (string, error) {
+	M.enterMiniBuffer(B, prompt)
+	B.Out.Flush()
+	rc, err := M.readKey(ctx, B)
+	M.terminal().EraseLine(B.Out)
+	M.MiniBuffer.Leave(B.Out)
+	B.RepaintAfterPrompt()
+	return rc, err
+}
+
+// _SubEditor is the editor for the questions and the registration.
+// It is made once for each Mode and reused, so that the nested Mode
+// for the registration keeps its keymaps made already.
+type _SubEditor struct {
+	editor *readline.Editor
+	prompt string
+	mode   *Mode
+	busy   bool
+}
+
+// subEditor returns the editor for the question shown with prompt.
+// A new one is made while the one of M is in use.
+func (M *Mode) subEditor(B *readline.Buffer, prompt string) *_SubEditor {
+	sub := M.sub
+	if sub == nil || sub.busy {
+		sub = &_SubEditor{}
+		sub.editor = &readline.Editor{
+			PromptWriter: func(w io.Writer) (int, error) {
+				return M.MiniBuffer.Enter(w, sub.prompt)
+			},
+			LineFeedWriter: func(_ readline.Result, w io.Writer) (int, error) {
+				M.terminal().EraseLine(w)
+				return M.MiniBuffer.Leave(w)
+			},
+		}
+		if M.sub == nil {
+			M.sub = sub
+		}
+	}
+	sub.prompt = prompt
+	sub.editor.Writer = B.Writer
+	sub.editor.Tty = M.PromptTty
+	return sub
+}
+
+// subMode returns the Mode for the registration in sub
+// with the current settings of M.
+func (M *Mode) subMode(sub *_SubEditor) *Mode {
+	m := sub.mode
+	if m == nil {
+		m = &Mode{}
+		sub.mode = m
+	}
+	m.User = M.User
+	m.System = M.System
+	m.UserDictionary = M.UserDictionary
+	m.SystemDictionary = M.SystemDictionary
+	m.Sources = M.Sources
+	m.Normalization = M.Normalization
+	m.RemoteTimeout = M.RemoteTimeout
+	m.DateFormats = M.DateFormats
+	m.MiniBuffer = M.MiniBuffer.Recurse(sub.prompt)
+	m.PromptTty = M.PromptTty
+	m.Terminal = M.Terminal
+	m.SelectionKeys = M.SelectionKeys
+	m.QuotedInsertKey = M.QuotedInsertKey
+	m.KeyBindings = M.KeyBindings
+	m.depth = M.depth + 1
+	m.MaxRegistrationDepth = M.MaxRegistrationDepth
+	m.onRegister = M.onRegister
+	m.onError = M.onError
+	m.Logger = M.Logger
+	m.whiteMarker = M.whiteMarker
+	m.blackMarker = M.blackMarker
+	m.kanaTable = M.kanaTable
+	m.numConvs = M.numConvs
+	// 入れ子の登録で追加した単語も M の辞書として保存・集計する
+	m.sharedBy = M.root()
+	return m
+}
+
+func (M *Mode) ask(ctx context.Context, B *readline.Buffer, prompt string, ime bool) (string, error) {
+	sub := M.subEditor(B, fitToTerminal(B, prompt))
+	sub.busy = true
+	defer func() { sub.busy = false }()
+	if ime {
+		m := M.subMode(sub)
+		m.enable(sub.editor, m.kanas()[0])
+	} else if sub.mode != nil {
+		sub.mode.restoreKeyMap(sub.editor)
+	}
+	defer B.RepaintAfterPrompt()
+	return sub.editor.ReadLine(ctx)
+}
+
+// reportError reports the failure of op for source.
+func (M *Mode) reportError(B *readline.Buffer, op, source string, err error) {
+	if err == nil {
+		return
+	}
+	err = &JisyoError{Op: op, Source: source, Err: err}
+	if M.onError != nil {
+		M.onError(err)
+	} else {
+		M.message(B, err.Error())
+	}
+}
@@ -0,0 +1,49 @@
+//go:build !js && !plan9
+
+// Package auto installs go-readline-skk onto an editor with one call.
+// The settings are given by a string such as the environment variable
+// GOREADLINESKK, so that shells like nyagos can enable SKK without code:
+//
+//	GOREADLINESKK=user=~/.skk-jisyo;system=/usr/share/skk/SKK-JISYO.L;layout=azik
+package auto
+
+import (
+	"os"
+
+	rl "github.com/nyaosorg/go-readline-ny"
+
+	"github.com/hymkor/go-readline-skk"
+)
+
+// EnvName is the name of the environment variable read by InstallFromEnv.
+const EnvName = "GOREADLINESKK"
+
+// Install creates an instance of SKK with the setting string
+// (see skk.ParseConfigString for the syntax)
+// and binds the key to start it on editor.
+// The user dictionary is saved by Mode.Close when it was changed,
+// so call it on exit of the application:
+//
+//	M, err := auto.Install(&editor, setting)
+//	if err != nil {
+//		return err
+//	}
+//	defer M.Close()
+func Install(editor *rl.Editor, setting string) (*skk.Mode, error) {
+	c, err := skk.ParseConfigString(setting)
+	if err != nil {
+		return nil, err
+	}
+	c.BindTo = editor
+	return c.Setup()
+}
+
+// InstallFromEnv is Install with the value of the environment variable
+// GOREADLINESKK. When it is not set, nothing is installed and M is nil.
+func InstallFromEnv(editor *rl.Editor) (M *skk.Mode, err error) {
+	setting, ok := os.LookupEnv(EnvName)
+	if !ok {
+		return nil, nil
+	}
+	return Install(editor, setting)
+}
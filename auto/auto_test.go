@@ -0,0 +1,36 @@
+//go:build !js && !plan9
+
+package auto_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	rl "github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
+
+	"github.com/hymkor/go-readline-skk/auto"
+)
+
+func TestInstall(t *testing.T) {
+	dir := t.TempDir()
+	system := filepath.Join(dir, "SKK-JISYO.S")
+	os.WriteFile(system, []byte(";; -*- coding: utf-8 -*-\nかんじ /漢字/\n"), 0666)
+	user := filepath.Join(dir, "user-jisyo")
+
+	var editor rl.Editor
+	M, err := auto.Install(&editor, system+";user="+user)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if command, ok := editor.Lookup(keys.CtrlJ); !ok || command != M {
+		t.Fatalf("Ctrl-J is bound to %v", command)
+	}
+	if len(M.System["かんじ"]) != 1 {
+		t.Fatalf("System: %v", M.System)
+	}
+	if err := M.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+}
@@ -0,0 +1,110 @@
+package skk
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultAutoSaveDelay is the delay of the auto-save when it is zero.
+const defaultAutoSaveDelay = 5 * time.Second
+
+// autoSaver saves the user dictionary once after the changes stop for delay.
+type autoSaver struct {
+	delay time.Duration
+	mutex sync.Mutex
+	timer *time.Timer
+	// pending is true while the changes are not saved by the auto-save.
+	pending bool
+	closed  bool
+	// saving is held while saving, so that only one save runs at a time.
+	saving sync.Mutex
+}
+
+// WithAutoSave saves the user dictionary loaded by WithUserJisyo
+// automatically delay after the last change, so that the registrations
+// in a burst are written at once. When delay is zero, 5 seconds is used.
+// The changes not saved yet are saved by Close.
+// The user dictionary is synchronized by Synchronize to be saved
+// from another goroutine.
+func WithAutoSave(delay time.Duration) Option {
+	return func(M *Mode) error {
+		if delay <= 0 {
+			delay = defaultAutoSaveDelay
+		}
+		a := &autoSaver{delay: delay}
+		M.autoSaver = a
+		M.onClose(func() error {
+			if a.stop() {
+				M.dirty.Store(true)
+			}
+			return nil
+		})
+		return nil
+	}
+}
+
+// markDirty records that the user dictionary is changed
+// and schedules the auto-save. The changes of the dictionary shared
+// by Share are recorded on the Mode sharing it.
+func (M *Mode) markDirty() {
+	if M.sharedBy != nil {
+		M.sharedBy.markDirty()
+		return
+	}
+	M.dirty.Store(true)
+	a := M.autoSaver
+	if a == nil || M.userJisyoPath == "" {
+		return
+	}
+	M.Synchronize()
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.closed {
+		return
+	}
+	a.pending = true
+	if a.timer == nil {
+		a.timer = time.AfterFunc(a.delay, M.autoSave)
+	} else {
+		a.timer.Reset(a.delay)
+	}
+}
+
+// autoSave is called by the timer of the auto-save.
+func (M *Mode) autoSave() {
+	a := M.autoSaver
+	a.saving.Lock()
+	defer a.saving.Unlock()
+	a.mutex.Lock()
+	pending := a.pending && !a.closed
+	a.pending = false
+	a.mutex.Unlock()
+	if !pending {
+		return
+	}
+	M.debugf("auto-save %s", M.userJisyoPath)
+	if err := M.SaveUserJisyo(M.userJisyoPath); err != nil {
+		a.mutex.Lock()
+		a.pending = true
+		a.mutex.Unlock()
+		if M.onError != nil {
+			M.onError(err)
+		}
+	}
+}
+
+// stop stops the timer and waits for the save running.
+// It reports whether the changes are not saved yet.
+func (a *autoSaver) stop() bool {
+	a.mutex.Lock()
+	a.closed = true
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	a.mutex.Unlock()
+	a.saving.Lock()
+	defer a.saving.Unlock()
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.pending
+}
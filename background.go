@@ -0,0 +1,131 @@
+package skk
+
+import (
+	"time"
+)
+
+// defaultLoadingWait is the time Lookup of BackgroundJisyo waits
+// for the loading when its Wait is zero.
+const defaultLoadingWait = 100 * time.Millisecond
+
+// BackgroundJisyo is Dictionary which is loaded in a goroutine,
+// so that the first prompt of a shell appears without waiting for
+// the large dictionaries. Lookup waits for the loading only for Wait,
+// and reports "not found" when it is not done yet.
+type BackgroundJisyo struct {
+	// Wait is the time Lookup waits for the loading.
+	// When it is zero, 100 milliseconds is used.
+	Wait time.Duration
+
+	jisyo Jisyo
+	done  chan struct{}
+	err   error
+}
+
+// LoadInBackground starts load with a new Jisyo in a goroutine.
+func LoadInBackground(load func(Jisyo) error) *BackgroundJisyo {
+	b := &BackgroundJisyo{jisyo: Jisyo{}, done: make(chan struct{})}
+	go func() {
+		defer close(b.done)
+		b.err = load(b.jisyo)
+	}()
+	return b
+}
+
+// Ready reports whether the loading is done.
+func (b *BackgroundJisyo) Ready() bool {
+	select {
+	case <-b.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Done returns a channel closed when the loading is done.
+func (b *BackgroundJisyo) Done() <-chan struct{} {
+	return b.done
+}
+
+// Err returns the error of the loading. It is nil while loading.
+func (b *BackgroundJisyo) Err() error {
+	if !b.Ready() {
+		return nil
+	}
+	return b.err
+}
+
+// wait waits for the loading up to Wait and reports whether it is done.
+func (b *BackgroundJisyo) wait() bool {
+	if b.Ready() {
+		return true
+	}
+	d := b.Wait
+	if d <= 0 {
+		d = defaultLoadingWait
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-b.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Lookup returns the candidates for source when the loading is done.
+func (b *BackgroundJisyo) Lookup(source string) ([]string, bool) {
+	if !b.wait() {
+		return nil, false
+	}
+	return b.jisyo.Lookup(source)
+}
+
+// Store waits for the loading and replaces the candidates for source.
+func (b *BackgroundJisyo) Store(source string, candidates []string) error {
+	<-b.done
+	return b.jisyo.Store(source, candidates)
+}
+
+// Delete waits for the loading and removes the entry for source.
+func (b *BackgroundJisyo) Delete(source string) error {
+	<-b.done
+	return b.jisyo.Delete(source)
+}
+
+// Complete returns the midashi starting with prefix when the loading is done.
+func (b *BackgroundJisyo) Complete(prefix string) []string {
+	if !b.Ready() {
+		return nil
+	}
+	return b.jisyo.PrefixSearch(prefix)
+}
+
+// loader is the interface of the sources which may be still loading.
+type loader interface {
+	Ready() bool
+}
+
+// loading reports whether a source is still loading.
+func (M *Mode) loading() bool {
+	for _, s := range M.sources() {
+		if l, ok := s.(loader); ok && !l.Ready() {
+			return true
+		}
+	}
+	return false
+}
+
+// WithSystemJisyoInBackground is the same as WithSystemJisyo,
+// but the dictionaries are loaded in background by BackgroundJisyo
+// set to Mode.SystemDictionary. The error such as ErrJisyoNotFound
+// is reported by its Err method after the loading.
+func WithSystemJisyoInBackground(filenames ...string) Option {
+	return func(M *Mode) error {
+		M.SystemDictionary = LoadInBackground(func(j Jisyo) error {
+			return loadAll(j, filenames, Jisyo.Load)
+		})
+		return nil
+	}
+}
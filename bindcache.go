@@ -0,0 +1,173 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"unicode"
+
+	rl "github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+// _Binding is a key and the command bound to it by SKK.
+type _Binding struct {
+	key     keys.Code
+	command rl.Command
+}
+
+// bindingCache is the commands of SKK made once for each Mode,
+// so that the mode switches only bind them without allocating
+// a command for each key again.
+type bindingCache struct {
+	commands  map[string]rl.Command
+	recorders map[_Binding]*_Recorder
+	romaji    map[*_Kana][]_Binding
+	upper     []_Binding
+	jisx0208  []_Binding
+	abbrev    []_Binding
+}
+
+// recorder returns _Recorder of command for key made once for each pair.
+// It must be called with M.bindingMutex locked.
+func (M *Mode) recorder(key keys.Code, command rl.Command) *_Recorder {
+	b := _Binding{key: key, command: command}
+	if r, ok := M.bindings.recorders[b]; ok {
+		return r
+	}
+	if M.bindings.recorders == nil {
+		M.bindings.recorders = map[_Binding]*_Recorder{}
+	}
+	r := &_Recorder{Command: command, key: key, M: M}
+	M.bindings.recorders[b] = r
+	return r
+}
+
+// kanaBindings returns the bindings of the kana mode K:
+// the romaji, the upper letters to start the midashi and the commands
+// of KeyBindings.
+func (M *Mode) kanaBindings(K *_Kana) []_Binding {
+	commands := M.commands()
+	M.bindingMutex.Lock()
+	defer M.bindingMutex.Unlock()
+	romaji, ok := M.bindings.romaji[K]
+	if !ok {
+		for _, c := range K.triggers() {
+			key := keys.Code(c)
+			romaji = append(romaji, _Binding{key, M.recorder(key, &_Romaji{kana: K, last: c, mode: M})})
+		}
+		if M.bindings.romaji == nil {
+			M.bindings.romaji = map[*_Kana][]_Binding{}
+		}
+		M.bindings.romaji[K] = romaji
+	}
+	if M.bindings.upper == nil {
+		const upperRomaji = "AIUEOKSTNHMYRWFGZDBPCJ"
+		for i, c := range upperRomaji {
+			key := keys.Code(upperRomaji[i : i+1])
+			u := &_Trigger{Key: byte(unicode.ToLower(c)), M: M}
+			M.bindings.upper = append(M.bindings.upper, _Binding{key, M.recorder(key, u)})
+		}
+	}
+	// KeyBindings は後から変わりうるので毎回引く
+	result := make([]_Binding, 0, len(romaji)+len(M.bindings.upper)+len(DefaultKeyBindings)+2)
+	result = append(result, romaji...)
+	result = append(result, M.bindings.upper...)
+	for key, name := range M.keyBindings() {
+		if command, ok := commands[name]; ok {
+			result = append(result, _Binding{key, M.recorder(key, command)})
+		}
+	}
+	quotedInsertKey := M.QuotedInsertKey
+	if quotedInsertKey == "" {
+		quotedInsertKey = keys.CtrlQ
+	}
+	return append(result,
+		_Binding{quotedInsertKey, M.recorder(quotedInsertKey, commands["SKK_QUOTED_INSERT"])},
+		M.pasteBinding(commands))
+}
+
+// jisx0208Bindings returns the bindings of the JIS X 0208 latin mode.
+func (M *Mode) jisx0208Bindings() []_Binding {
+	M.bindingMutex.Lock()
+	defer M.bindingMutex.Unlock()
+	if M.bindings.jisx0208 != nil {
+		return M.bindings.jisx0208
+	}
+	for _, i := range jisx0208Keys() {
+		z := string(hanToZen(i))
+		M.bindings.jisx0208 = append(M.bindings.jisx0208, _Binding{keys.Code(string(i)), &rl.GoCommand{
+			Name: "SKK_JISX0208_LATIN_INSERT_" + z,
+			Func: func(_ context.Context, B *rl.Buffer) rl.Result {
+				M.countKey(StateJisx0208Latin)
+				B.InsertAndRepaint(z)
+				return rl.CONTINUE
+			}}})
+	}
+	M.bindings.jisx0208 = append(M.bindings.jisx0208, _Binding{keys.CtrlJ, &rl.GoCommand{
+		Name: "SKK_JISX0208_LATIN_KAKUTEI",
+		Func: func(ctx context.Context, B *rl.Buffer) rl.Result {
+			M.enable(B, M.kanas()[0])
+			M.message(B, msgHiragana)
+			M.notify(StateHiragana)
+			return rl.CONTINUE
+		},
+	}})
+	return M.bindings.jisx0208
+}
+
+// jisx0208Keys returns the keys converted by the JIS X 0208 latin mode:
+// the printable ASCII characters and the Latin-1 signs such as ¥,
+// which are typed with AltGr on some layouts.
+func jisx0208Keys() []rune {
+	result := make([]rune, 0, 0x7F-' '+len(hanToZenSpecial))
+	for i := rune(' '); i < '\x7F'; i++ {
+		result = append(result, i)
+	}
+	for _, i := range slices.Sorted(maps.Keys(hanToZenSpecial)) {
+		if i >= 0x80 {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// abbrevBindings returns the bindings of the abbrev mode.
+func (M *Mode) abbrevBindings() []_Binding {
+	commands := M.commands()
+	M.bindingMutex.Lock()
+	defer M.bindingMutex.Unlock()
+	if M.bindings.abbrev != nil {
+		return M.bindings.abbrev
+	}
+	backwardDeleteChar := &rl.GoCommand{
+		Name: "SKK_ABBREV_BACKWARD_DELETE_CHAR",
+		Func: func(ctx context.Context, B *rl.Buffer) rl.Result {
+			if markerPos := M.seekMarker(surfaceOf(B)); markerPos < 0 || markerPos+1 != B.Cursor {
+				return M.cmdBackwardDeleteChar(ctx, B)
+			}
+			// ▽ まで消した時は abbrev モードをやめる
+			B.ReplaceAndRepaint(B.Cursor-1, "")
+			M.enable(B, M.kanas()[0])
+			M.message(B, msgHiragana)
+			M.notify(StateHiragana)
+			return rl.CONTINUE
+		},
+	}
+	M.bindings.abbrev = []_Binding{{" ", &rl.GoCommand{
+		Name: "SKK_ABBREV_START_HENKAN",
+		Func: func(ctx context.Context, B *rl.Buffer) rl.Result {
+			rc := M.cmdStartHenkan(ctx, B)
+			M.enable(B, M.kanas()[0])
+			M.message(B, msgHiragana)
+			M.notify(StateHiragana)
+			return rc
+		},
+	}},
+		{keys.Backspace, backwardDeleteChar},
+		{keys.CtrlH, backwardDeleteChar},
+		M.pasteBinding(commands)}
+	return M.bindings.abbrev
+}
@@ -0,0 +1,81 @@
+package skk
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+// DefaultKeyBindings is the keys bound to the commands of SKK
+// in the hiragana and katakana modes.
+var DefaultKeyBindings = map[keys.Code]string{
+	"q":            "SKK_TOGGLE_KANA",
+	"/":            "SKK_ABBREV_MODE",
+	"\\":           "SKK_INPUT_BY_CODE",
+	"@":            "SKK_TODAY",
+	" ":            "SKK_START_HENKAN",
+	"l":            "SKK_LATIN_MODE",
+	"L":            "SKK_JISX0208_LATIN_MODE",
+	keys.CtrlG:     "SKK_CANCEL",
+	keys.CtrlH:     "SKK_BACKWARD_DELETE_CHAR",
+	keys.Backspace: "SKK_BACKWARD_DELETE_CHAR",
+	keys.CtrlJ:     "SKK_KAKUTEI",
+	keys.Enter:     "SKK_ACCEPT_LINE",
+	keys.CtrlK:     "SKK_KILL_LINE",
+	keys.CtrlU:     "SKK_UNIX_LINE_DISCARD",
+	keys.CtrlC:     "SKK_INTERRUPT",
+}
+
+// commandNames is the names of the commands which can be bound by KeyBindings.
+// It is kept apart from Mode.commands to validate the names
+// on the platforms without go-readline-ny.
+var commandNames = []string{
+	"SKK_TOGGLE_KANA",
+	"SKK_HIRAGANA_MODE",
+	"SKK_KATAKANA_MODE",
+	"SKK_ABBREV_MODE",
+	"SKK_INPUT_BY_CODE",
+	"SKK_TODAY",
+	"SKK_START_HENKAN",
+	"SKK_LATIN_MODE",
+	"SKK_JISX0208_LATIN_MODE",
+	"SKK_CANCEL",
+	"SKK_BACKWARD_DELETE_CHAR",
+	"SKK_KAKUTEI",
+	"SKK_ACCEPT_LINE",
+	"SKK_QUOTED_INSERT",
+	"SKK_EDIT_USER_JISYO",
+	"SKK_CONVERT_CLIPBOARD",
+	"SKK_KILL_LINE",
+	"SKK_UNIX_LINE_DISCARD",
+	"SKK_BRACKETED_PASTE",
+	"SKK_INTERRUPT",
+	"SKK_RESET",
+}
+
+// keyBindings returns DefaultKeyBindings overridden by M.KeyBindings.
+func (M *Mode) keyBindings() map[keys.Code]string {
+	bindings := make(map[keys.Code]string, len(DefaultKeyBindings)+len(M.KeyBindings))
+	for key, name := range DefaultKeyBindings {
+		bindings[key] = name
+	}
+	for key, name := range M.KeyBindings {
+		bindings[key] = name
+	}
+	return bindings
+}
+
+// WithKeyBindings overrides DefaultKeyBindings with bindings.
+// It returns an error when bindings contains an unknown command name.
+func WithKeyBindings(bindings map[keys.Code]string) Option {
+	return func(M *Mode) error {
+		for key, name := range bindings {
+			if name != "" && !slices.Contains(commandNames, name) {
+				return fmt.Errorf("%q: unknown SKK command for %q", name, key)
+			}
+		}
+		M.KeyBindings = bindings
+		return nil
+	}
+}
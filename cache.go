@@ -0,0 +1,224 @@
+package skk
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// jisyoCacheMagic is the first bytes of the cache files.
+// The last byte is the version of the format.
+const jisyoCacheMagic = "GoSKKJisyoCache\x01"
+
+// errCacheInvalid means the cache is broken or made from another version
+// of the dictionary.
+var errCacheInvalid = errors.New("jisyo cache is invalid")
+
+// jisyoCacheHeader is written after the magic. Size and ModTime are
+// of the dictionary when the cache was made.
+type jisyoCacheHeader struct {
+	Size       int64
+	ModTime    int64
+	Entries    uint64
+	Candidates uint64
+}
+
+// cacheFilenames returns the filenames where the cache of the dictionary
+// is looked for: next to the dictionary, and in the user cache directory
+// for the dictionaries in the directories not writable.
+func cacheFilenames(filename string) []string {
+	names := []string{filename + ".cache"}
+	if dir, err := os.UserCacheDir(); err == nil {
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			abs = filename
+		}
+		h := fnv.New64a()
+		io.WriteString(h, abs)
+		names = append(names, filepath.Join(dir, "go-readline-skk",
+			fmt.Sprintf("%s-%016x.cache", filepath.Base(filename), h.Sum64())))
+	}
+	return names
+}
+
+// LoadCached is the same as Load, but it reads the binary cache made
+// by the previous call instead of parsing the dictionary when the size
+// and the modification time of the dictionary are not changed.
+// The cache is written next to the dictionary, or into the user cache
+// directory when the directory of the dictionary is not writable.
+func (j Jisyo) LoadCached(filename string) error {
+	filename = expandEnv(filename)
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	caches := cacheFilenames(filename)
+	for _, cache := range caches {
+		if j.readCache(cache, stat) == nil {
+			return nil
+		}
+	}
+	// 空なら j に直接読む
+	fresh, merging := j, len(j) > 0
+	if merging {
+		fresh = Jisyo{}
+	}
+	if err := fresh.Load(filename); err != nil {
+		return err
+	}
+	for _, cache := range caches {
+		if fresh.writeCache(cache, stat) == nil {
+			break
+		}
+	}
+	if merging {
+		j.merge(fresh)
+	}
+	return nil
+}
+
+// merge appends the candidates of other to j as Load does.
+func (j Jisyo) merge(other Jisyo) {
+	for key, list := range other {
+		if values := j[key]; len(values) > 0 {
+			j[key] = append(values[:len(values):len(values)], list...)
+		} else {
+			j[key] = list
+		}
+	}
+}
+
+func (j Jisyo) writeCache(cache string, stat os.FileInfo) error {
+	if err := os.MkdirAll(filepath.Dir(cache), 0777); err != nil {
+		return err
+	}
+	tmp := cache + ".TMP"
+	fd, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	header := jisyoCacheHeader{
+		Size:    stat.Size(),
+		ModTime: stat.ModTime().UnixNano(),
+		Entries: uint64(len(j)),
+	}
+	for _, list := range j {
+		header.Candidates += uint64(len(list))
+	}
+	w := bufio.NewWriter(fd)
+	w.WriteString(jisyoCacheMagic)
+	binary.Write(w, binary.LittleEndian, &header)
+	var buffer [binary.MaxVarintLen64]byte
+	writeString := func(s string) {
+		w.Write(binary.AppendUvarint(buffer[:0], uint64(len(s))))
+		w.WriteString(s)
+	}
+	for key, list := range j {
+		writeString(key)
+		w.Write(binary.AppendUvarint(buffer[:0], uint64(len(list))))
+		for _, s := range list {
+			writeString(s)
+		}
+	}
+	err = w.Flush()
+	if err1 := fd.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = os.Rename(tmp, cache)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// readCache reads the cache made from the dictionary of stat.
+// All the strings share one allocation of the contents of the cache.
+func (j Jisyo) readCache(cache string, stat os.FileInfo) error {
+	data, err := os.ReadFile(cache)
+	if err != nil {
+		return err
+	}
+	var header jisyoCacheHeader
+	headerSize := len(jisyoCacheMagic) + binary.Size(header)
+	if len(data) < headerSize || string(data[:len(jisyoCacheMagic)]) != jisyoCacheMagic {
+		return errCacheInvalid
+	}
+	if _, err := binary.Decode(data[len(jisyoCacheMagic):], binary.LittleEndian, &header); err != nil {
+		return errCacheInvalid
+	}
+	if header.Size != stat.Size() || header.ModTime != stat.ModTime().UnixNano() {
+		return errCacheInvalid
+	}
+	if header.Entries > uint64(len(data)) || header.Candidates > uint64(len(data)) {
+		return errCacheInvalid
+	}
+	text := string(data)
+	pos := headerSize
+	readUvarint := func() (uint64, bool) {
+		n, size := binary.Uvarint(data[pos:])
+		if size <= 0 {
+			return 0, false
+		}
+		pos += size
+		return n, true
+	}
+	readString := func() (string, bool) {
+		n, ok := readUvarint()
+		if !ok || n > uint64(len(text)-pos) {
+			return "", false
+		}
+		s := text[pos : pos+int(n)]
+		pos += int(n)
+		return s, true
+	}
+	// 途中で壊れていても j を汚さないよう、空でなければ別に読んでから反映する
+	fresh, merging := j, len(j) > 0
+	if merging {
+		fresh = make(Jisyo, header.Entries)
+	}
+	invalid := func() error {
+		clear(fresh)
+		return errCacheInvalid
+	}
+	arena := make([]string, header.Candidates)
+	for i := uint64(0); i < header.Entries; i++ {
+		key, ok := readString()
+		if !ok {
+			return invalid()
+		}
+		n, ok := readUvarint()
+		if !ok || n > uint64(len(arena)) {
+			return invalid()
+		}
+		list := arena[:n:n]
+		arena = arena[n:]
+		for k := range list {
+			if list[k], ok = readString(); !ok {
+				return invalid()
+			}
+		}
+		fresh[key] = list
+	}
+	if pos != len(data) {
+		return invalid()
+	}
+	if merging {
+		j.merge(fresh)
+	}
+	return nil
+}
+
+// WithCachedSystemJisyo is the same as WithSystemJisyo,
+// but the dictionaries are loaded by Jisyo.LoadCached.
+func WithCachedSystemJisyo(filenames ...string) Option {
+	return func(M *Mode) error {
+		return loadAll(M.System, filenames, Jisyo.LoadCached)
+	}
+}
@@ -0,0 +1,34 @@
+package skk
+
+import (
+	"context"
+)
+
+// CallOptions is the settings of SKK for one ReadLine call.
+type CallOptions struct {
+	// NoRegistration disables the registration mode.
+	// A midashi not found stays with ▽.
+	NoRegistration bool
+	// HideAnnotation hides the annotations in the candidate listing.
+	HideAnnotation bool
+	// Katakana starts SKK in the katakana mode instead of the hiragana mode.
+	Katakana bool
+}
+
+type callOptionsKey struct{}
+
+// WithCallOptions returns the context which carries opts.
+// Give it to ReadLine to change the behavior of SKK only for that call,
+// such as for a search box or a password-ish field.
+func WithCallOptions(ctx context.Context, opts CallOptions) context.Context {
+	return context.WithValue(ctx, callOptionsKey{}, opts)
+}
+
+// callOptions returns the options carried by ctx.
+func callOptions(ctx context.Context) CallOptions {
+	if ctx == nil {
+		return CallOptions{}
+	}
+	opts, _ := ctx.Value(callOptionsKey{}).(CallOptions)
+	return opts
+}
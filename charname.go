@@ -0,0 +1,130 @@
+package skk
+
+import (
+	"iter"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/runenames"
+)
+
+// emojiShortcodes is the shortcodes of GitHub and Slack whose names
+// differ from the Unicode names of the characters. The other shortcodes
+// are looked up as the Unicode names such as :bouquet: for BOUQUET.
+var emojiShortcodes = map[string]string{
+	"+1":               "👍",
+	"-1":               "👎",
+	"100":              "💯",
+	"angry":            "😠",
+	"beer":             "🍺",
+	"blush":            "😊",
+	"bulb":             "💡",
+	"cat":              "🐱",
+	"clap":             "👏",
+	"coffee":           "☕",
+	"cry":              "😢",
+	"dog":              "🐶",
+	"eyes":             "👀",
+	"fire":             "🔥",
+	"grin":             "😁",
+	"heart":            "❤️",
+	"heart_eyes":       "😍",
+	"heavy_check_mark": "✔️",
+	"innocent":         "😇",
+	"joy":              "😂",
+	"kissing_heart":    "😘",
+	"laughing":         "😆",
+	"memo":             "📝",
+	"muscle":           "💪",
+	"ok_hand":          "👌",
+	"poop":             "💩",
+	"pray":             "🙏",
+	"rage":             "😡",
+	"ramen":            "🍜",
+	"rocket":           "🚀",
+	"scream":           "😱",
+	"shrug":            "🤷",
+	"smile":            "😄",
+	"smiley":           "😃",
+	"sob":              "😭",
+	"sparkles":         "✨",
+	"star":             "⭐",
+	"sunglasses":       "😎",
+	"sunny":            "☀️",
+	"sweat_smile":      "😅",
+	"tada":             "🎉",
+	"thinking":         "🤔",
+	"thumbsdown":       "👎",
+	"thumbsup":         "👍",
+	"umbrella":         "☔",
+	"warning":          "⚠️",
+	"wave":             "👋",
+	"white_check_mark": "✅",
+	"wink":             "😉",
+	"x":                "❌",
+	"zap":              "⚡",
+}
+
+var (
+	runesByName     map[string]rune
+	runesByNameOnce sync.Once
+)
+
+// runeByName returns the character of the Unicode name.
+// The table is made from runenames on the first call.
+func runeByName(name string) (rune, bool) {
+	runesByNameOnce.Do(func() {
+		runesByName = map[string]rune{}
+		for r := rune(0); r <= unicode.MaxRune; r++ {
+			// <CJK Ideograph> などの範囲の名前は除く
+			if n := runenames.Name(r); n != "" && n[0] != '<' {
+				runesByName[n] = r
+			}
+		}
+	})
+	r, ok := runesByName[name]
+	return r, ok
+}
+
+// charByName returns the candidate of the character typed in the abbrev
+// mode as the code point such as U+1F490, the emoji shortcode such as
+// :tada:, or the Unicode name with "_" for the spaces such as :bouquet:
+// and :black_heart_suit:. The Unicode name is the annotation.
+func charByName(s string) (string, bool) {
+	if strings.HasPrefix(s, "U+") || strings.HasPrefix(s, "u+") {
+		r, ok := codeToRune(s)
+		if !ok {
+			return "", false
+		}
+		if name := runenames.Name(r); name != "" && name[0] != '<' {
+			return escapeCandidate(string(r)) + ";" + name, true
+		}
+		return escapeCandidate(string(r)), true
+	}
+	if len(s) < 3 || s[0] != ':' || s[len(s)-1] != ':' {
+		return "", false
+	}
+	code := strings.ToLower(s[1 : len(s)-1])
+	if c, ok := emojiShortcodes[code]; ok {
+		return c, true
+	}
+	name := strings.ToUpper(strings.ReplaceAll(code, "_", " "))
+	// THUMBS UP SIGN や GRINNING FACE は末尾を省いても引けるようにする
+	for _, n := range []string{name, name + " SIGN", name + " FACE"} {
+		if r, ok := runeByName(n); ok {
+			return escapeCandidate(string(r)) + ";" + n, true
+		}
+	}
+	return "", false
+}
+
+// lookupChar returns the candidate of charByName.
+func lookupChar(source string) (iter.Seq[string], bool) {
+	c, ok := charByName(source)
+	if !ok {
+		return nil, false
+	}
+	return slices.Values([]string{c}), true
+}
@@ -0,0 +1,50 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	"context"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	rl "github.com/nyaosorg/go-readline-ny"
+)
+
+func (M *Mode) cmdConvertClipboard(ctx context.Context, B *rl.Buffer) rl.Result {
+	text, err := clipboard.ReadAll()
+	if err != nil {
+		M.message(B, err.Error())
+		return rl.CONTINUE
+	}
+	source := M.clipboardReading(text)
+	if source == "" {
+		return rl.CONTINUE
+	}
+	markerPos := B.Cursor
+	B.InsertAndRepaint(M.white() + source)
+	M.notify(StateMarkerWhite)
+	return M.henkanMode(ctx, B, markerPos, source, "")
+}
+
+// kill runs the kill command of go-readline-ny, which puts text to the clipboard,
+// and replaces the clipboard with text without the markers,
+// so that the reading or the candidate being converted can be yanked back.
+func (M *Mode) kill(ctx context.Context, B *rl.Buffer, command rl.Command, text string) rl.Result {
+	pending := M.seekMarker(surfaceOf(B)) >= 0
+	rc := command.Call(ctx, B)
+	if stripped := strings.NewReplacer(M.white(), "", M.black(), "").Replace(text); stripped != text {
+		clipboard.WriteAll(stripped)
+	}
+	if pending && M.seekMarker(surfaceOf(B)) < 0 {
+		M.notify(M.kanaState(B))
+	}
+	return rc
+}
+
+func (M *Mode) cmdKillLine(ctx context.Context, B *rl.Buffer) rl.Result {
+	return M.kill(ctx, B, rl.CmdKillLine, B.SubString(B.Cursor, len(B.Buffer)))
+}
+
+func (M *Mode) cmdUnixLineDiscard(ctx context.Context, B *rl.Buffer) rl.Result {
+	return M.kill(ctx, B, rl.CmdUnixLineDiscard, B.SubString(0, B.Cursor))
+}
@@ -0,0 +1,33 @@
+package skk
+
+import (
+	"errors"
+	"io"
+)
+
+// onClose registers f to be called by Close, such as to stop
+// a background goroutine.
+func (M *Mode) onClose(f func() error) {
+	M.closers = append(M.closers, f)
+}
+
+// Close saves the user dictionary when it was changed since loaded or saved,
+// stops the background jobs and closes the sources of candidates
+// which implement io.Closer. Defer it on exit of the application.
+// The user dictionary is saved only when it was loaded from a file.
+func (M *Mode) Close() error {
+	var errs []error
+	for i := len(M.closers) - 1; i >= 0; i-- {
+		errs = append(errs, M.closers[i]())
+	}
+	M.closers = nil
+	if M.dirty.Load() && M.userJisyoPath != "" {
+		errs = append(errs, M.SaveUserJisyo(M.userJisyoPath))
+	}
+	for _, s := range M.Sources {
+		if c, ok := s.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,85 @@
+//go:build !js && !plan9
+
+// skkdemo is the interactive demo of go-readline-skk.
+// It reads lines with SKK and prints them until Ctrl-D.
+// Press Ctrl-J to start SKK.
+//
+//	skkdemo [-user ~/.go-skk-jisyo] [-config skk.json] [-placement above] SKK-JISYO.L ...
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
+
+	"github.com/hymkor/go-readline-skk"
+)
+
+var (
+	flagUser      = flag.String("user", "", "the user dictionary")
+	flagConfig    = flag.String("config", "", "the configuration file (JSON)")
+	flagPlacement = flag.String("placement", "below", "where the minibuffer is shown: below or above")
+	flagTutorial  = flag.Bool("tutorial", false, "start the tutorial")
+)
+
+func mains(args []string) error {
+	ctx := context.Background()
+	var editor readline.Editor
+	if *flagTutorial {
+		return skk.Tutorial(ctx, &editor)
+	}
+	var opts []skk.Option
+	if *flagUser != "" {
+		opts = append(opts, skk.WithUserJisyo(*flagUser))
+	}
+	if len(args) > 0 {
+		opts = append(opts, skk.WithSystemJisyo(args...))
+	}
+	if *flagConfig != "" {
+		opts = append(opts, skk.WithConfigFile(*flagConfig))
+	}
+	M, err := skk.NewWithOptions(opts...)
+	if err != nil {
+		return err
+	}
+	defer M.Close()
+	if *flagPlacement == "above" {
+		M.SetMiniBufferPlacement(skk.AboveTheLine)
+	}
+	editor.BindKey(keys.CtrlJ, M)
+	editor.BindKey(keys.Enter, M.CmdAcceptLineWithLatinMode())
+	editor.Coloring = M.Coloring(&editor, nil)
+	editor.PromptWriter = func(w io.Writer) (int, error) {
+		return io.WriteString(w, "skk> ")
+	}
+	for {
+		text, err := editor.ReadLine(ctx)
+		if errors.Is(err, readline.CtrlC) {
+			continue
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		fmt.Printf("TEXT: %s\n", text)
+		if m := M.Metrics(); m.Conversions > 0 {
+			fmt.Printf("(conversions: %d, registrations: %d)\n", m.Conversions, m.Registrations)
+		}
+	}
+}
+
+func main() {
+	flag.Parse()
+	if err := mains(flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,90 @@
+// skkserv is the dictionary server of SKK built on go-readline-skk.
+//
+//	skkserv [-addr :1178] [-utf8] [-v] [-cert FILE -key FILE [-clientca FILE]] SKK-JISYO.L [SKK-JISYO.emoji ...]
+//
+// With -cert and -key, it accepts TLS connections.
+// With -clientca too, it accepts only the clients with the certificates
+// signed by the CA.
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/hymkor/go-readline-skk"
+	"github.com/hymkor/go-readline-skk/skkserv"
+)
+
+var (
+	flagAddr     = flag.String("addr", ":"+skkserv.DefaultPort, "the address to listen")
+	flagUTF8     = flag.Bool("utf8", false, "use UTF-8 instead of EUC-JP for the protocol")
+	flagVerbose  = flag.Bool("v", false, "log the requests")
+	flagCert     = flag.String("cert", "", "the certificate file for TLS")
+	flagKey      = flag.String("key", "", "the private key file for TLS")
+	flagClientCA = flag.String("clientca", "", "the CA file to verify the client certificates")
+)
+
+func tlsConfig() (*tls.Config, error) {
+	if *flagCert == "" && *flagKey == "" {
+		if *flagClientCA != "" {
+			return nil, fmt.Errorf("-clientca requires -cert and -key")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(*flagCert, *flagKey)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if *flagClientCA != "" {
+		pem, err := os.ReadFile(*flagClientCA)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates", *flagClientCA)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+func mains(args []string) error {
+	if len(args) <= 0 {
+		return fmt.Errorf("no dictionaries are given")
+	}
+	config, err := tlsConfig()
+	if err != nil {
+		return err
+	}
+	jisyo := skk.Jisyo{}
+	for _, fn := range args {
+		if err := jisyo.Load(fn); err != nil {
+			return err
+		}
+		log.Printf("%s: loaded", fn)
+	}
+	server := &skkserv.Server{
+		Source:    jisyo,
+		UTF8:      *flagUTF8,
+		TLSConfig: config,
+	}
+	if *flagVerbose {
+		server.Logger = log.Default()
+	}
+	log.Printf("listening on %s", *flagAddr)
+	return server.ListenAndServe(*flagAddr)
+}
+
+func main() {
+	flag.Parse()
+	if err := mains(flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
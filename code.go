@@ -0,0 +1,83 @@
+package skk
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// jisToRune returns the character of the code of JIS X 0208 such as 0x2422,
+// or of EUC-JP such as 0xA4A2.
+func jisToRune(code uint64) (rune, bool) {
+	if code > 0xFFFF {
+		return 0, false
+	}
+	hi, lo := byte(code>>8), byte(code)
+	if 0x21 <= hi && hi <= 0x7E && 0x21 <= lo && lo <= 0x7E {
+		hi, lo = hi|0x80, lo|0x80
+	}
+	if hi < 0xA1 || hi > 0xFE || lo < 0xA1 || lo > 0xFE {
+		return 0, false
+	}
+	decoded, err := japanese.EUCJP.NewDecoder().Bytes([]byte{hi, lo})
+	if err != nil {
+		return 0, false
+	}
+	r, size := utf8.DecodeRune(decoded)
+	if size != len(decoded) || r == utf8.RuneError {
+		return 0, false
+	}
+	return r, true
+}
+
+// codeToRune returns the character of the code typed for SKK_INPUT_BY_CODE
+// like skk-input-by-code-or-menu of ddskk: the code of JIS X 0208 such as
+// "2422", of EUC-JP such as "a4a2", or the code point of Unicode such as
+// "u3042" or "U+3042".
+func codeToRune(code string) (rune, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) > 1 && (code[0] == 'u' || code[0] == 'U') {
+		hex := strings.TrimPrefix(code[1:], "+")
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || hex == "" {
+			return 0, false
+		}
+		r := rune(n)
+		if !utf8.ValidRune(r) || unicode.IsControl(r) {
+			return 0, false
+		}
+		return r, true
+	}
+	if len(code) != 4 {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(code, 16, 16)
+	if err != nil {
+		return 0, false
+	}
+	return jisToRune(n)
+}
+
+var (
+	jisSymbolList []string
+	jisSymbolOnce sync.Once
+)
+
+// jisSymbols returns the symbols of the rows 1 and 2 of JIS X 0208
+// shown by the menu of SKK_INPUT_BY_CODE.
+func jisSymbols() []string {
+	jisSymbolOnce.Do(func() {
+		for hi := uint64(0x21); hi <= 0x22; hi++ {
+			for lo := uint64(0x21); lo <= 0x7E; lo++ {
+				if r, ok := jisToRune(hi<<8 | lo); ok {
+					jisSymbolList = append(jisSymbolList, string(r))
+				}
+			}
+		}
+	})
+	return jisSymbolList
+}
@@ -0,0 +1,197 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	rl "github.com/nyaosorg/go-readline-ny"
+)
+
+// The methods Cmd* return the commands of SKK bound to M,
+// so that the application can bind them with readline.KeyMap.BindKey.
+// Except for CmdEditUserJisyo, CmdConvertClipboard, CmdReset, CmdHiraganaMode,
+// CmdKatakanaMode, CmdAcceptLineWithLatinMode and CmdInterruptWithLatinMode,
+// they are meant for the keys of the kana modes and are bound automatically
+// according to KeyBindings.
+
+// CmdStartHenkan returns SKK_START_HENKAN, which converts the midashi after ▽.
+func (M *Mode) CmdStartHenkan() rl.Command {
+	return &rl.GoCommand{Name: "SKK_START_HENKAN", Func: M.cmdStartHenkan}
+}
+
+// CmdKakutei returns SKK_KAKUTEI, which confirms the text after the marker.
+func (M *Mode) CmdKakutei() rl.Command {
+	return &rl.GoCommand{Name: "SKK_KAKUTEI", Func: M.cmdKakutei}
+}
+
+// CmdBackwardDeleteChar returns SKK_BACKWARD_DELETE_CHAR, which deletes
+// one kana or one romaji before the cursor. Deleting ▽ stops typing
+// the midashi.
+func (M *Mode) CmdBackwardDeleteChar() rl.Command {
+	return &rl.GoCommand{Name: "SKK_BACKWARD_DELETE_CHAR", Func: M.cmdBackwardDeleteChar}
+}
+
+// CmdToggleKana returns SKK_TOGGLE_KANA, which switches hiragana and katakana.
+func (M *Mode) CmdToggleKana() rl.Command {
+	return &rl.GoCommand{Name: "SKK_TOGGLE_KANA", Func: M.cmdToggleKana}
+}
+
+// CmdHiraganaMode returns SKK_HIRAGANA_MODE, which starts the hiragana mode
+// from any input mode. Unlike SKK_TOGGLE_KANA, the result does not depend
+// on the current mode, so that it can be bound to a dedicated key.
+func (M *Mode) CmdHiraganaMode() rl.Command {
+	return &rl.GoCommand{Name: "SKK_HIRAGANA_MODE", Func: M.cmdHiraganaMode}
+}
+
+// CmdKatakanaMode returns SKK_KATAKANA_MODE, which starts the katakana mode
+// from any input mode as CmdHiraganaMode.
+func (M *Mode) CmdKatakanaMode() rl.Command {
+	return &rl.GoCommand{Name: "SKK_KATAKANA_MODE", Func: M.cmdKatakanaMode}
+}
+
+// CmdInputByCode returns SKK_INPUT_BY_CODE, which asks the code of
+// a character like skk-input-by-code-or-menu of ddskk and inserts it.
+// The code is of JIS X 0208 such as 2422, of EUC-JP such as a4a2,
+// or of Unicode such as u3042 or U+3042. An empty code shows the menu
+// of the symbols of JIS X 0208 chosen as the candidates.
+func (M *Mode) CmdInputByCode() rl.Command {
+	return &rl.GoCommand{Name: "SKK_INPUT_BY_CODE", Func: M.cmdInputByCode}
+}
+
+// CmdToday returns SKK_TODAY, which inserts today's date in the first
+// format of DateFormats like skk-today of ddskk.
+func (M *Mode) CmdToday() rl.Command {
+	return &rl.GoCommand{Name: "SKK_TODAY", Func: M.cmdToday}
+}
+
+// CmdAbbrevMode returns SKK_ABBREV_MODE, which starts the abbrev mode.
+func (M *Mode) CmdAbbrevMode() rl.Command {
+	return &rl.GoCommand{Name: "SKK_ABBREV_MODE", Func: M.cmdAbbrevMode}
+}
+
+// CmdLatinMode returns SKK_LATIN_MODE, which returns to the latin mode.
+func (M *Mode) CmdLatinMode() rl.Command {
+	return &rl.GoCommand{Name: "SKK_LATIN_MODE", Func: M.cmdLatinMode}
+}
+
+// CmdJisx0208LatinMode returns SKK_JISX0208_LATIN_MODE,
+// which starts the full-width latin mode.
+func (M *Mode) CmdJisx0208LatinMode() rl.Command {
+	return &rl.GoCommand{Name: "SKK_JISX0208_LATIN_MODE", Func: M.cmdJis0208LatinMode}
+}
+
+// CmdCancel returns SKK_CANCEL, which removes the midashi after ▽,
+// or returns to the latin mode when there is no marker.
+func (M *Mode) CmdCancel() rl.Command {
+	return &rl.GoCommand{Name: "SKK_CANCEL", Func: M.cmdCancel}
+}
+
+// CmdAcceptLine returns SKK_ACCEPT_LINE, which removes the markers
+// and accepts the line. When the host application bound Enter to its own
+// command before SKK started, such as go-multiline-ny inserting a new line,
+// that command is called instead of accepting the line.
+func (M *Mode) CmdAcceptLine() rl.Command {
+	return &rl.GoCommand{Name: "SKK_ACCEPT_LINE", Func: M.cmdAcceptLine}
+}
+
+// CmdInterrupt returns SKK_INTERRUPT, which removes the markers and
+// interrupts the input. When the host application bound Ctrl-C to its own
+// command, that command is called instead of interrupting.
+func (M *Mode) CmdInterrupt() rl.Command {
+	return &rl.GoCommand{Name: "SKK_INTERRUPT", Func: M.cmdInterrupt}
+}
+
+// CmdReset returns SKK_RESET, which removes the markers left in the line
+// and installs the keymap of the current input mode again. It recovers
+// the editor left in an inconsistent state by an error during a conversion.
+func (M *Mode) CmdReset() rl.Command {
+	return &rl.GoCommand{Name: "SKK_RESET", Func: M.cmdReset}
+}
+
+// CmdQuotedInsert returns SKK_QUOTED_INSERT, which inserts the next key as it is.
+func (M *Mode) CmdQuotedInsert() rl.Command {
+	return &rl.GoCommand{Name: "SKK_QUOTED_INSERT", Func: M.cmdQuotedInsert}
+}
+
+// CmdAcceptLineWithLatinMode returns SKK_ACCEPT_LINE_WITH_LATIN_MODE,
+// which accepts the line and returns to the latin mode.
+// It is meant for Enter of the keymap where SKK is started.
+func (M *Mode) CmdAcceptLineWithLatinMode() rl.Command {
+	return &rl.GoCommand{Name: "SKK_ACCEPT_LINE_WITH_LATIN_MODE", Func: M.cmdAcceptLineWithLatinMode}
+}
+
+// CmdInterruptWithLatinMode returns SKK_INTRRUPT_WITH_LATIN_MODE,
+// which interrupts the input and returns to the latin mode.
+// It is meant for Ctrl-C of the keymap where SKK is started.
+func (M *Mode) CmdInterruptWithLatinMode() rl.Command {
+	return &rl.GoCommand{Name: "SKK_INTRRUPT_WITH_LATIN_MODE", Func: M.cmdIntrruptWithLatinMode}
+}
+
+// CmdEditUserJisyo returns SKK_EDIT_USER_JISYO, which is EditUserJisyo.
+func (M *Mode) CmdEditUserJisyo() rl.Command {
+	return &rl.GoCommand{Name: "SKK_EDIT_USER_JISYO", Func: M.EditUserJisyo}
+}
+
+// CmdConvertClipboard returns SKK_CONVERT_CLIPBOARD, which converts
+// the text in the clipboard as the reading and inserts the result.
+// Romaji in the clipboard is converted to hiragana before the conversion.
+func (M *Mode) CmdConvertClipboard() rl.Command {
+	return &rl.GoCommand{Name: "SKK_CONVERT_CLIPBOARD", Func: M.cmdConvertClipboard}
+}
+
+// CmdKillLine returns SKK_KILL_LINE, which is KILL_LINE of go-readline-ny
+// putting the text killed without the markers to the clipboard.
+func (M *Mode) CmdKillLine() rl.Command {
+	return &rl.GoCommand{Name: "SKK_KILL_LINE", Func: M.cmdKillLine}
+}
+
+// CmdUnixLineDiscard returns SKK_UNIX_LINE_DISCARD, which is UNIX_LINE_DISCARD
+// of go-readline-ny putting the text killed without the markers to the clipboard.
+func (M *Mode) CmdUnixLineDiscard() rl.Command {
+	return &rl.GoCommand{Name: "SKK_UNIX_LINE_DISCARD", Func: M.cmdUnixLineDiscard}
+}
+
+// CmdBracketedPaste returns SKK_BRACKETED_PASTE, which inserts the text
+// pasted with the bracketed paste mode as it is, or converted as romaji
+// when PasteAsRomaji is true. It is bound to the start marker of the paste
+// automatically. See EnableBracketedPaste.
+func (M *Mode) CmdBracketedPaste() rl.Command {
+	return &rl.GoCommand{Name: "SKK_BRACKETED_PASTE", Func: M.cmdBracketedPaste}
+}
+
+// commands returns the commands of SKK which can be bound with KeyBindings.
+// They are made on the first call.
+func (M *Mode) commands() map[string]rl.Command {
+	M.bindingMutex.Lock()
+	defer M.bindingMutex.Unlock()
+	if M.bindings.commands != nil {
+		return M.bindings.commands
+	}
+	commands := map[string]rl.Command{}
+	for _, c := range []rl.Command{
+		M.CmdToggleKana(),
+		M.CmdHiraganaMode(),
+		M.CmdKatakanaMode(),
+		M.CmdAbbrevMode(),
+		M.CmdInputByCode(),
+		M.CmdToday(),
+		M.CmdStartHenkan(),
+		M.CmdLatinMode(),
+		M.CmdJisx0208LatinMode(),
+		M.CmdCancel(),
+		M.CmdBackwardDeleteChar(),
+		M.CmdKakutei(),
+		M.CmdAcceptLine(),
+		M.CmdQuotedInsert(),
+		M.CmdEditUserJisyo(),
+		M.CmdConvertClipboard(),
+		M.CmdKillLine(),
+		M.CmdUnixLineDiscard(),
+		M.CmdBracketedPaste(),
+		M.CmdInterrupt(),
+		M.CmdReset(),
+	} {
+		commands[c.String()] = c
+	}
+	M.bindings.commands = commands
+	return commands
+}
@@ -0,0 +1,162 @@
+package skk
+
+import (
+	"fmt"
+	"strings"
+)
+
+// concatPrefix is the start of the candidates written with the concat
+// function of Emacs Lisp such as `(concat "a\057b")`, which the standard
+// dictionaries use for the candidates containing `/`, `;` or the control
+// characters such as the newline.
+const concatPrefix = `(concat "`
+
+// encodeConcat returns s as the concat expression with `/`, `;`, `"`,
+// `\` and the control characters escaped.
+func encodeConcat(s string) string {
+	return "(concat " + quoteLisp(s) + ")"
+}
+
+// quoteLisp returns s as the string literal of Emacs Lisp with `/`, `;`
+// and the control characters written in octal, so that it can be put
+// in the candidates.
+func quoteLisp(s string) string {
+	var buffer strings.Builder
+	buffer.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '/':
+			buffer.WriteString(`\057`)
+		case ';':
+			buffer.WriteString(`\073`)
+		case '"', '\\':
+			buffer.WriteByte('\\')
+			buffer.WriteRune(r)
+		default:
+			if isControl(r) {
+				fmt.Fprintf(&buffer, `\%03o`, r)
+			} else {
+				buffer.WriteRune(r)
+			}
+		}
+	}
+	buffer.WriteByte('"')
+	return buffer.String()
+}
+
+// isControl reports whether r is the control character which can not be
+// written in the dictionary as it is, such as the newline splitting the line.
+func isControl(r rune) bool {
+	return r < 0x20 || r == 0x7F
+}
+
+// hasControl reports whether s contains the control characters.
+func hasControl(s string) bool {
+	return strings.ContainsFunc(s, isControl)
+}
+
+// decodeConcat returns the string made by the concat expression s.
+// Only the string literals with the octal escapes are supported.
+// When s is not such an expression, it returns false.
+func decodeConcat(s string) (string, bool) {
+	if !strings.HasPrefix(s, concatPrefix) {
+		return s, false
+	}
+	list, ok := parseLispStrings(s[len("(concat "):])
+	if !ok {
+		return s, false
+	}
+	return strings.Join(list, ""), true
+}
+
+// parseLispStrings returns the string literals in rest, which are
+// the arguments of a function call ending with `)`.
+func parseLispStrings(rest string) ([]string, bool) {
+	var list []string
+	for {
+		rest = strings.TrimLeft(rest, " ")
+		if rest == ")" {
+			return list, true
+		}
+		if rest == "" || rest[0] != '"' {
+			return nil, false
+		}
+		var buffer []byte
+		i := 1
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] != '\\' {
+				buffer = append(buffer, rest[i])
+				continue
+			}
+			i++
+			if i >= len(rest) {
+				return nil, false
+			}
+			// \057 のような8進数は3桁まで
+			if c := rest[i]; c < '0' || c > '7' {
+				buffer = append(buffer, c)
+				continue
+			}
+			var c byte
+			for n := 0; n < 3 && i < len(rest) && rest[i] >= '0' && rest[i] <= '7'; n++ {
+				c = c*8 + rest[i] - '0'
+				i++
+			}
+			buffer = append(buffer, c)
+			i--
+		}
+		if i >= len(rest) {
+			return nil, false
+		}
+		list = append(list, string(buffer))
+		rest = rest[i+1:]
+	}
+}
+
+// escapeCandidate returns text as a candidate without an annotation.
+// The text containing `;` or the control characters is made the concat
+// expression, so that it is not split as the annotation nor as the lines.
+func escapeCandidate(text string) string {
+	if strings.Contains(text, ";") || hasControl(text) {
+		return encodeConcat(text)
+	}
+	return text
+}
+
+// encodeCandidate returns the candidate in the form to be written to
+// the dictionary file: the text containing `/`, and the annotation
+// containing `/` or `;` are written as the concat expressions, and so are
+// the ones containing the control characters.
+func encodeCandidate(candidate string) string {
+	text, annotation, found := strings.Cut(candidate, ";")
+	if strings.Contains(text, "/") || hasControl(text) {
+		text = encodeConcat(text)
+	}
+	if !found {
+		return text
+	}
+	if strings.ContainsAny(annotation, "/;") || hasControl(annotation) {
+		annotation = encodeConcat(annotation)
+	}
+	return text + ";" + annotation
+}
+
+// decodeCandidate returns the candidate read from the dictionary file
+// with the concat expressions decoded. The text containing `;` is kept
+// as the expression, since `;` in the candidates starts the annotation.
+func decodeCandidate(candidate string) string {
+	if !strings.Contains(candidate, concatPrefix) {
+		return candidate
+	}
+	text, annotation, found := strings.Cut(candidate, ";")
+	if t, ok := decodeConcat(text); ok && !strings.Contains(t, ";") {
+		text = t
+	}
+	if !found {
+		return text
+	}
+	if a, ok := decodeConcat(annotation); ok {
+		annotation = a
+	}
+	return text + ";" + annotation
+}
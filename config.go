@@ -0,0 +1,199 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	rl "github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+// KeyBinder is the destination of key bindings such as *readline.KeyMap and *readline.Editor.
+type KeyBinder interface {
+	BindKey(keys.Code, rl.Command)
+}
+
+// Config is the settings to create an instance of SKK with New or Setup method.
+type Config struct {
+	// UserJisyoPath is the filename of the user dictionary.
+	// It is not an error that the file does not exist.
+	UserJisyoPath string
+	// SystemJisyoPaths is the filenames of the system dictionaries.
+	// All of them which exist are loaded.
+	SystemJisyoPaths []string
+	// BindTo is the keymap where Key is bound to start SKK by Setup.
+	// When it is nil, readline.GlobalKeyMap is used.
+	BindTo KeyBinder
+	// Key is the key to start SKK. When it is empty, Ctrl-J is used.
+	Key keys.Code
+	// MiniBuffer is the area to show messages and prompts.
+	// When it is nil, MiniBufferOnNextLine is used.
+	MiniBuffer MiniBuffer
+	// SelectionKeys is the key table for the candidate listing.
+	SelectionKeys *SelectionKeys
+	// QuotedInsertKey is the key to insert the next character as it is.
+	QuotedInsertKey keys.Code
+	// KeyBindings overrides DefaultKeyBindings.
+	// See Mode.KeyBindings for details.
+	KeyBindings map[keys.Code]string
+	// Layout is the input layout: "romaji" or "azik". See WithLayout.
+	Layout string
+	// ConfigFile is the configuration file applied after the other settings.
+	ConfigFile string
+	// Background loads the system dictionaries in background.
+	// See WithSystemJisyoInBackground.
+	Background bool
+	// AutoSave is the delay of saving the user dictionary after the changes.
+	// When it is zero, the user dictionary is saved only by Close.
+	// See WithAutoSave.
+	AutoSave time.Duration
+}
+
+// New loads the dictionaries and returns a new instance of SKK.
+func (c Config) New() (*Mode, error) {
+	return NewWithOptions(c.Options()...)
+}
+
+// Options returns the settings of c as Option.
+func (c Config) Options() []Option {
+	opts := []Option{
+		WithMiniBuffer(c.MiniBuffer),
+		WithSelectionKeys(c.SelectionKeys),
+		WithQuotedInsertKey(c.QuotedInsertKey),
+		WithKeyBindings(c.KeyBindings),
+	}
+	if c.UserJisyoPath != "" {
+		opts = append(opts, WithUserJisyo(c.UserJisyoPath))
+	}
+	if c.Background {
+		opts = append(opts, WithSystemJisyoInBackground(c.SystemJisyoPaths...))
+	} else {
+		opts = append(opts, WithSystemJisyo(c.SystemJisyoPaths...))
+	}
+	if c.Layout != "" {
+		opts = append(opts, WithLayout(c.Layout))
+	}
+	if c.AutoSave > 0 {
+		opts = append(opts, WithAutoSave(c.AutoSave))
+	}
+	if c.ConfigFile != "" {
+		opts = append(opts, WithConfigFile(c.ConfigFile))
+	}
+	return opts
+}
+
+// ParseConfigString parses the settings written as `name=value;name=value`
+// for the applications which pass through a string given by the user,
+// such as an environment variable:
+//
+//	user=~/.skk-jisyo;system=/usr/share/skk/SKK-JISYO.L;layout=azik
+//
+// The names are below. An item without a name is a system dictionary.
+//
+//	user               the user dictionary
+//	system             a system dictionary (can be repeated)
+//	layout             romaji or azik
+//	config             the configuration file (JSON)
+//	key                the key to start SKK such as C-j
+//	quoted_insert_key  the key to insert the next character as it is
+//	selection_keys     the keys to select the candidates such as asdfjkl
+//	minibuffer         below, above or current (the line being edited)
+//	background         true to load the system dictionaries in background
+//	autosave           the delay of saving the user dictionary such as 5s
+//
+// The filenames may start with ~ and contain %ENV%.
+func ParseConfigString(s string) (Config, error) {
+	var c Config
+	for _, item := range strings.Split(s, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			c.SystemJisyoPaths = append(c.SystemJisyoPaths, item)
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return Config{}, fmt.Errorf("%s: empty value", name)
+		}
+		switch name {
+		case "user":
+			c.UserJisyoPath = value
+		case "system":
+			c.SystemJisyoPaths = append(c.SystemJisyoPaths, value)
+		case "layout":
+			if _, ok := layouts[strings.ToLower(value)]; !ok {
+				return Config{}, fmt.Errorf("%q: unknown layout", value)
+			}
+			c.Layout = value
+		case "config":
+			c.ConfigFile = value
+		case "background":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return Config{}, fmt.Errorf("background: %w", err)
+			}
+			c.Background = b
+		case "autosave":
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return Config{}, fmt.Errorf("autosave: %w", err)
+			}
+			c.AutoSave = d
+		case "key", "quoted_insert_key":
+			code, err := keyCode(value)
+			if err != nil {
+				return Config{}, err
+			}
+			if name == "key" {
+				c.Key = code
+			} else {
+				c.QuotedInsertKey = code
+			}
+		case "selection_keys":
+			sk := *DefaultSelectionKeys
+			sk.Select = value
+			c.SelectionKeys = &sk
+		case "minibuffer":
+			switch strings.ToLower(value) {
+			case "below":
+				c.MiniBuffer = MiniBufferOnNextLine{}
+			case "above":
+				c.MiniBuffer = MiniBufferOnPrevLine{}
+			case "current":
+				c.MiniBuffer = &MiniBufferOnCurrentLine{}
+			default:
+				return Config{}, fmt.Errorf("%q: unknown minibuffer", value)
+			}
+		default:
+			return Config{}, fmt.Errorf("%q: unknown setting", name)
+		}
+	}
+	return c, nil
+}
+
+// Setup creates a new instance of SKK with New method,
+// and binds Key of BindTo to it.
+func (c Config) Setup() (*Mode, error) {
+	M, err := c.New()
+	if err != nil {
+		return nil, err
+	}
+	var bindTo KeyBinder = rl.GlobalKeyMap
+	if c.BindTo != nil {
+		bindTo = c.BindTo
+	}
+	key := c.Key
+	if key == "" {
+		key = keys.CtrlJ
+	}
+	bindTo.BindKey(key, M)
+	return M, nil
+}
@@ -0,0 +1,191 @@
+package skk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"unicode/utf8"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+// ConfigFile is the contents of the configuration file read by
+// ReadConfigFile. It is JSON like below. All fields can be omitted.
+//
+//	{
+//	  "user_jisyo": "~/.skk-jisyo",
+//	  "system_jisyo": ["SKK-JISYO.L"],
+//	  "bindings": { "SKK_LATIN_MODE": ["C-l"], "SKK_ABBREV_MODE": [] },
+//	  "white_marker": "▽",
+//	  "black_marker": "▼",
+//	  "punctuation": "jp",
+//	  "layout": "azik",
+//	  "hiragana": { "z,": "‥" },
+//	  "katakana": { "z,": "‥" },
+//	  "selection_keys": "asdfjkl;",
+//	  "quoted_insert_key": "C-q",
+//	  "normalization": ["nfc", "vu", "width"],
+//	  "date_formats": ["{gengo}{nen}年1月2日({youbi})", "2006-01-02"]
+//	}
+//
+// The keys of "bindings" are the names of the commands in DefaultKeyBindings
+// and SKK_QUOTED_INSERT. The keys listed replace the default keys of
+// the command. An empty list unbinds the command.
+// The key names are those of go-readline-ny such as "C-g", "Enter",
+// "SPACE" or one character.
+// "layout" is "romaji"(default) or "azik".
+// "punctuation" is one of "jp"(、。), "en"(，．), "jp-en"(，。) and "en-jp"(、．).
+// "normalization" is the names of Normalization: "nfc", "vu" and "width".
+// "date_formats" is the formats of FormatDate for SKK_TODAY.
+type ConfigFile struct {
+	UserJisyo       string              `json:"user_jisyo"`
+	SystemJisyo     []string            `json:"system_jisyo"`
+	Bindings        map[string][]string `json:"bindings"`
+	WhiteMarker     string              `json:"white_marker"`
+	BlackMarker     string              `json:"black_marker"`
+	Punctuation     string              `json:"punctuation"`
+	Layout          string              `json:"layout"`
+	Hiragana        map[string]string   `json:"hiragana"`
+	Katakana        map[string]string   `json:"katakana"`
+	SelectionKeys   string              `json:"selection_keys"`
+	QuotedInsertKey string              `json:"quoted_insert_key"`
+	Normalization   []string            `json:"normalization"`
+	DateFormats     []string            `json:"date_formats"`
+}
+
+// punctuations is the table of "punctuation": the values for "," and ".".
+var punctuations = map[string][2]string{
+	"jp":    {"、", "。"},
+	"en":    {"，", "．"},
+	"jp-en": {"，", "。"},
+	"en-jp": {"、", "．"},
+}
+
+// ReadConfigFile reads the configuration file written in JSON.
+func ReadConfigFile(filename string) (*ConfigFile, error) {
+	data, err := os.ReadFile(expandEnv(filename))
+	if err != nil {
+		return nil, err
+	}
+	var cf ConfigFile
+	if err := json.Unmarshal(data, &cf); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return &cf, nil
+}
+
+// keyCode returns the code of the key named name.
+func keyCode(name string) (keys.Code, error) {
+	normalized := keys.NormalizeName(name)
+	if normalized == "SPACE" {
+		return " ", nil
+	}
+	if code, ok := keys.NameToCode[normalized]; ok {
+		return code, nil
+	}
+	if utf8.RuneCountInString(name) == 1 {
+		return keys.Code(name), nil
+	}
+	return "", fmt.Errorf("%q: unknown key name", name)
+}
+
+// Options returns the settings of cf as Option.
+func (cf *ConfigFile) Options() ([]Option, error) {
+	var opts []Option
+	if cf.UserJisyo != "" {
+		opts = append(opts, WithUserJisyo(cf.UserJisyo))
+	}
+	if len(cf.SystemJisyo) > 0 {
+		opts = append(opts, WithSystemJisyo(cf.SystemJisyo...))
+	}
+	if len(cf.Bindings) > 0 {
+		bindings := map[keys.Code]string{}
+		for key, name := range DefaultKeyBindings {
+			if _, ok := cf.Bindings[name]; ok {
+				bindings[key] = ""
+			}
+		}
+		for name, keyNames := range cf.Bindings {
+			for _, keyName := range keyNames {
+				code, err := keyCode(keyName)
+				if err != nil {
+					return nil, err
+				}
+				bindings[code] = name
+			}
+		}
+		opts = append(opts, WithKeyBindings(bindings))
+	}
+	if cf.WhiteMarker != "" || cf.BlackMarker != "" {
+		opts = append(opts, WithMarkers(cf.WhiteMarker, cf.BlackMarker))
+	}
+	if cf.Layout != "" {
+		opts = append(opts, WithLayout(cf.Layout))
+	}
+	hiragana := map[string]string{}
+	katakana := map[string]string{}
+	if cf.Punctuation != "" {
+		p, ok := punctuations[cf.Punctuation]
+		if !ok {
+			return nil, fmt.Errorf("%q: unknown punctuation", cf.Punctuation)
+		}
+		hiragana[","], hiragana["."] = p[0], p[1]
+		katakana[","], katakana["."] = p[0], p[1]
+	}
+	for key, value := range cf.Hiragana {
+		hiragana[key] = value
+	}
+	for key, value := range cf.Katakana {
+		katakana[key] = value
+	}
+	if len(hiragana) > 0 || len(katakana) > 0 {
+		opts = append(opts, WithKanaTable(hiragana, katakana))
+	}
+	if cf.SelectionKeys != "" {
+		sk := *DefaultSelectionKeys
+		sk.Select = cf.SelectionKeys
+		opts = append(opts, WithSelectionKeys(&sk))
+	}
+	if cf.QuotedInsertKey != "" {
+		code, err := keyCode(cf.QuotedInsertKey)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithQuotedInsertKey(code))
+	}
+	if len(cf.Normalization) > 0 {
+		n, err := parseNormalization(cf.Normalization)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithNormalization(n))
+	}
+	if len(cf.DateFormats) > 0 {
+		opts = append(opts, WithDateFormats(cf.DateFormats...))
+	}
+	return opts, nil
+}
+
+// WithConfigFile applies the settings of the configuration file.
+// It is not an error that the file does not exist.
+func WithConfigFile(filename string) Option {
+	return func(M *Mode) error {
+		cf, err := ReadConfigFile(filename)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		opts, err := cf.Options()
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		for _, opt := range opts {
+			if err := opt(M); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,195 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrNoEditor is an error that means no editor has called SKK yet,
+// so the control request to switch the mode has no target.
+var ErrNoEditor = errors.New("no editor is using SKK")
+
+// ListenControl creates the unix domain socket named path and serves
+// the control requests on it in a goroutine, so that external tools
+// such as the key bindings of window managers can operate SKK
+// like fcitx-remote. The socket is closed and removed by Close.
+//
+// Each request is one line and each reply is one line starting with
+// "ok" or "error":
+//
+//	hiragana, katakana, latin, toggle  switch the input mode
+//	save                               save the user dictionary
+//	compact                            compact the user dictionary as Compact does
+//	state                              reply the state as State does
+//	stats                              reply the statistics as Metrics does
+//
+// The user dictionary is synchronized as Synchronize does, so that
+// saving and compacting it do not race with the registrations.
+// The socket left at path is removed only when no one listens on it.
+func (M *Mode) ListenControl(path string) error {
+	removeStaleSocket(path)
+	M.Synchronize()
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	M.setControlled()
+	go M.ServeControl(l)
+	M.onClose(func() error {
+		err := l.Close()
+		os.Remove(path)
+		return err
+	})
+	return nil
+}
+
+// removeStaleSocket removes the unix domain socket path left by
+// a process which does not listen on it any more.
+func removeStaleSocket(path string) {
+	fi, err := os.Lstat(path)
+	if err != nil || fi.Mode().Type() != os.ModeSocket {
+		return
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return
+	}
+	os.Remove(path)
+}
+
+// setControlled makes the editors wrap their terminals with _EditorTty
+// when they call SKK, so that they apply the control requests.
+func (M *Mode) setControlled() {
+	M.statesMutex.Lock()
+	M.controlled = true
+	M.statesMutex.Unlock()
+}
+
+// ServeControl accepts connections on l and serves the control requests.
+// See ListenControl for the requests. It returns when l is closed.
+// The requests switching the input mode are applied by the editor
+// before it dispatches the next key, and the others are done at once.
+func (M *Mode) ServeControl(l net.Listener) error {
+	M.setControlled()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			M.serveControlConn(conn)
+		}()
+	}
+}
+
+func (M *Mode) serveControlConn(conn io.ReadWriter) {
+	sc := bufio.NewScanner(conn)
+	for sc.Scan() {
+		request := strings.TrimSpace(sc.Text())
+		if request == "" {
+			continue
+		}
+		M.debugf("control %q", request)
+		reply, err := M.control(request)
+		if err != nil {
+			fmt.Fprintf(conn, "error %s\n", err.Error())
+		} else if reply != "" {
+			fmt.Fprintf(conn, "ok %s\n", reply)
+		} else {
+			fmt.Fprintln(conn, "ok")
+		}
+	}
+}
+
+// control executes one control request and returns the reply.
+// The requests switching the input mode are queued for the editor
+// which called SKK last, and applyControls applies them.
+func (M *Mode) control(request string) (string, error) {
+	switch request {
+	case "hiragana", "katakana", "latin", "toggle":
+		M.statesMutex.Lock()
+		defer M.statesMutex.Unlock()
+		st := M.current
+		if st == nil || st.buffer == nil {
+			return "", ErrNoEditor
+		}
+		st.controls = append(st.controls, request)
+		return "", nil
+	case "save":
+		if M.userJisyoPath == "" {
+			return "", ErrJisyoNotFound
+		}
+		return "", M.SaveUserJisyo(M.userJisyoPath)
+	case "compact":
+		n, err := M.Compact()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("removed=%d", n), nil
+	case "state":
+		s := M.State()
+		return fmt.Sprintf("mode=%s pending=%s loading=%v reading=%s", s.Mode, s.Pending, s.Loading, s.Reading), nil
+	case "stats":
+		m := M.Metrics()
+		var buffer strings.Builder
+		fmt.Fprintf(&buffer, "conversions=%d registrations=%d purges=%d pageviews=%d",
+			m.Conversions, m.Registrations, m.Purges, m.PageViews)
+		states := make([]State, 0, len(m.KeyStrokes))
+		for s := range m.KeyStrokes {
+			states = append(states, s)
+		}
+		sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
+		for _, s := range states {
+			fmt.Fprintf(&buffer, " keystrokes.%s=%d", s, m.KeyStrokes[s])
+		}
+		return buffer.String(), nil
+	}
+	return "", fmt.Errorf("%q: unknown request", request)
+}
+
+// applyControls switches the input mode of the editor of st by the
+// control requests queued. It is called by the goroutine of the editor.
+func (M *Mode) applyControls(st *_EditorState) {
+	M.statesMutex.Lock()
+	requests := st.controls
+	st.controls = nil
+	B := st.buffer
+	M.statesMutex.Unlock()
+	if len(requests) == 0 {
+		return
+	}
+	ctx := context.Background()
+	for _, request := range requests {
+		M.debugf("control %q applied", request)
+		switch request {
+		case "hiragana":
+			M.cmdHiraganaMode(ctx, B)
+		case "katakana":
+			M.cmdKatakanaMode(ctx, B)
+		case "latin":
+			if st.active {
+				M.cmdLatinMode(ctx, B)
+			}
+		case "toggle":
+			if st.active {
+				M.cmdToggleKana(ctx, B)
+			} else {
+				M.Call(ctx, B)
+			}
+		}
+	}
+	B.Out.Flush()
+}
@@ -0,0 +1,155 @@
+package skk
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// ErrNoCandidate is an error that means no candidate is found for the reading.
+var ErrNoCandidate = errors.New("no candidate")
+
+// Candidate is a result of Convert.
+type Candidate struct {
+	// Text is the converted text. The okurigana is appended to it.
+	Text string
+	// Annotation is the text after `;` in the dictionary. It may be empty.
+	Annotation string
+}
+
+// String returns the candidate in the form of the dictionary such as
+// `text;annotation`. The text containing `;` is given as the concat
+// expression, so that the form is split into the same candidate again.
+func (c Candidate) String() string {
+	if c.Annotation != "" {
+		return escapeCandidate(c.Text) + ";" + c.Annotation
+	}
+	return escapeCandidate(c.Text)
+}
+
+// parseCandidate splits the candidate in the dictionary into
+// the text and the annotation. The text given as the concat expression,
+// which may contain `;`, is decoded.
+func parseCandidate(s string) Candidate {
+	text, annotation, _ := strings.Cut(s, ";")
+	if t, ok := decodeConcat(text); ok {
+		text = t
+	}
+	return Candidate{Text: text, Annotation: annotation}
+}
+
+// okuriOverride is the okuri character for kana which are typed
+// with some consonants.
+var okuriOverride = map[string]string{
+	"っ": "t",
+	"ふ": "h",
+	"ん": "n",
+}
+
+// okuriChar returns the alphabet which represents the kana
+// as the okurigana in the dictionary. ("く" -> "k")
+func okuriChar(kana string) (string, bool) {
+	if c, ok := okuriOverride[kana]; ok {
+		return c, true
+	}
+	best := ""
+	for romaji, value := range hiragana.table {
+		if value != kana || romaji[0] < 'a' || romaji[0] > 'z' {
+			continue
+		}
+		if best == "" || len(romaji) < len(best) || (len(romaji) == len(best) && romaji < best) {
+			best = romaji
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	return best[:1], true
+}
+
+// Convert returns the candidates for reading from the dictionaries
+// without the terminal. A reading with okurigana is given as
+// `stem*okurigana` such as "か*く". The numeric conversion is applied.
+func (M *Mode) Convert(reading string) ([]Candidate, error) {
+	source := reading
+	postfix := ""
+	if stem, okuri, ok := strings.Cut(reading, "*"); ok && okuri != "" {
+		first := string([]rune(okuri)[:1])
+		c, ok := okuriChar(first)
+		if !ok {
+			return nil, ErrNoCandidate
+		}
+		source = stem + c
+		postfix = okuri
+	}
+	list, ok := M.lookup(source)
+	if !ok || len(list) <= 0 {
+		return nil, ErrNoCandidate
+	}
+	result := make([]Candidate, 0, len(list))
+	for _, s := range list {
+		c := parseCandidate(s)
+		c.Text += postfix
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// romajiToKana converts the romaji in s to hiragana
+// as if s were typed in the hiragana mode.
+func (M *Mode) romajiToKana(s string) string {
+	var line lineSurface
+	for i := 0; i < len(s); i++ {
+		M.inputRomaji(&line, M.kanas()[0], strings.ToLower(s[i:i+1]))
+	}
+	return string(line.line)
+}
+
+// clipboardReading returns the reading to convert for the text
+// in the clipboard: the first line, whose romaji is converted to hiragana.
+func (M *Mode) clipboardReading(text string) string {
+	text, _, _ = strings.Cut(strings.TrimSpace(text), "\n")
+	text = strings.TrimSpace(text)
+	for i := 0; i < len(text); i++ {
+		if text[i] >= 0x80 {
+			return text
+		}
+	}
+	return M.romajiToKana(text)
+}
+
+// Register adds word to the user dictionary as the first candidate
+// for source as the registration mode does. A source with okurigana
+// is written as the dictionary such as "かk". The word may have
+// an annotation after `;`. When a candidate with the same text exists
+// already, the word is not added even if the annotations differ.
+func (M *Mode) Register(source, word string) error {
+	found, _ := M.lookup(source)
+	duplicated := false
+	text := parseCandidate(word).Text
+	err := M.updateUser(source, func(list []string, ok bool) []string {
+		if !ok {
+			list = slices.Clone(found)
+		}
+		// 二重登録よけ(注釈は比べない)
+		for _, candidate := range list {
+			if parseCandidate(candidate).Text == text {
+				duplicated = true
+				return list
+			}
+		}
+		// リストの先頭に挿入
+		return unshift(list, word)
+	})
+	if err != nil || duplicated {
+		return err
+	}
+	if err := M.registerToSources(source, word); err != nil {
+		return err
+	}
+	M.count(func(m *Metrics) { m.Registrations++ })
+	if M.onRegister != nil {
+		M.onRegister(source, word)
+	}
+	return nil
+}
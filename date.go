@@ -0,0 +1,93 @@
+package skk
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDateFormats is the formats of the date used when Mode.DateFormats
+// is nil: 令和6年6月1日(土), 2024年6月1日(土) and 2024-06-01.
+var DefaultDateFormats = []string{
+	"{gengo}{nen}年1月2日({youbi})",
+	"2006年1月2日({youbi})",
+	"2006-01-02",
+}
+
+// _Era is an era of the Japanese calendar.
+type _Era struct {
+	name  string
+	start time.Time
+}
+
+// eras is the eras of the Japanese calendar from the newest.
+var eras = []_Era{
+	{name: "令和", start: time.Date(2019, 5, 1, 0, 0, 0, 0, time.Local)},
+	{name: "平成", start: time.Date(1989, 1, 8, 0, 0, 0, 0, time.Local)},
+	{name: "昭和", start: time.Date(1926, 12, 25, 0, 0, 0, 0, time.Local)},
+	{name: "大正", start: time.Date(1912, 7, 30, 0, 0, 0, 0, time.Local)},
+	{name: "明治", start: time.Date(1868, 10, 23, 0, 0, 0, 0, time.Local)},
+}
+
+// eraOf returns the name of the era of t and the year in it.
+// The first year is "元" as the dates are written in Japan.
+func eraOf(t time.Time) (string, string) {
+	date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	for _, e := range eras {
+		if !date.Before(e.start) {
+			year := t.Year() - e.start.Year() + 1
+			if year == 1 {
+				return e.name, "元"
+			}
+			return e.name, strconv.Itoa(year)
+		}
+	}
+	return "西暦", strconv.Itoa(t.Year())
+}
+
+// youbi is the days of the week in kanji from Sunday.
+var youbi = []string{"日", "月", "火", "水", "木", "金", "土"}
+
+// FormatDate returns t formatted by format, which is the layout of
+// time.Format where {gengo} is the era such as 令和, {nen} is the year
+// of the era and {youbi} is the day of the week such as 土.
+func FormatDate(t time.Time, format string) string {
+	s := t.Format(format)
+	// 数字がレイアウトとして解釈されないよう整形後に置き換える
+	if strings.Contains(s, "{") {
+		gengo, nen := eraOf(t)
+		s = strings.NewReplacer(
+			"{gengo}", gengo,
+			"{nen}", nen,
+			"{youbi}", youbi[t.Weekday()],
+		).Replace(s)
+	}
+	return s
+}
+
+// WithDateFormats sets the formats of the date. See Mode.DateFormats.
+func WithDateFormats(formats ...string) Option {
+	return func(M *Mode) error {
+		M.DateFormats = formats
+		return nil
+	}
+}
+
+// dateFormats returns DateFormats or DefaultDateFormats.
+func (M *Mode) dateFormats() []string {
+	if len(M.DateFormats) > 0 {
+		return M.DateFormats
+	}
+	return DefaultDateFormats
+}
+
+// Today returns the date of t in the formats of DateFormats.
+// SKK_TODAY inserts the first one.
+func (M *Mode) Today(t time.Time) []string {
+	formats := M.dateFormats()
+	dates := make([]string, len(formats))
+	for i, format := range formats {
+		dates[i] = FormatDate(t, format)
+	}
+	return dates
+}
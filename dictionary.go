@@ -0,0 +1,141 @@
+package skk
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Dictionary is the interface of dictionaries used by the conversion.
+// Jisyo implements it. Other implementations such as server-backed
+// dictionaries can be set to Mode.UserDictionary or Mode.SystemDictionary.
+type Dictionary interface {
+	// Lookup returns the candidates for source.
+	Lookup(source string) ([]string, bool)
+	// Store replaces the candidates for source.
+	Store(source string, candidates []string) error
+	// Delete removes the entry for source.
+	Delete(source string) error
+}
+
+// Updater is the interface of dictionaries which can replace an entry
+// atomically. f receives the current candidates and returns the new ones.
+// When f returns an empty list, the entry is deleted.
+type Updater interface {
+	Update(source string, f func(candidates []string, ok bool) []string) error
+}
+
+// PrefixSearcher is the interface of dictionaries which can enumerate
+// the midashi starting with a prefix.
+type PrefixSearcher interface {
+	PrefixSearch(prefix string) []string
+}
+
+// Lookup returns the candidates for source.
+func (j Jisyo) Lookup(source string) ([]string, bool) {
+	list, ok := j[source]
+	return list, ok
+}
+
+// Store replaces the candidates for source.
+// candidates must not be modified after stored,
+// because they are shared with the snapshots.
+func (j Jisyo) Store(source string, candidates []string) error {
+	j[source] = candidates
+	return nil
+}
+
+// Delete removes the entry for source.
+func (j Jisyo) Delete(source string) error {
+	delete(j, source)
+	return nil
+}
+
+// Update replaces the candidates for source with the result of f.
+func (j Jisyo) Update(source string, f func(candidates []string, ok bool) []string) error {
+	list, ok := j[source]
+	if newList := f(list, ok); len(newList) > 0 {
+		j[source] = newList
+	} else {
+		delete(j, source)
+	}
+	return nil
+}
+
+// updateUser replaces the entry of the user dictionary with the result of f.
+// When the user dictionary is an Updater, it is done atomically
+// against the other Mode sharing it. The limits of WithUserJisyoLimit
+// are applied after that.
+func (M *Mode) updateUser(source string, f func(candidates []string, ok bool) []string) error {
+	M.markDirty()
+	M.touch(source, false)
+	user, unlock := M.lockUser()
+	defer unlock()
+	if u, ok := user.(Updater); ok {
+		err := u.Update(source, func(candidates []string, ok bool) []string {
+			return M.limitCandidates(f(candidates, ok))
+		})
+		if err != nil {
+			return err
+		}
+		return M.evict(user, source)
+	}
+	list, ok := user.Lookup(source)
+	if newList := M.limitCandidates(f(list, ok)); len(newList) > 0 {
+		if err := user.Store(source, newList); err != nil {
+			return err
+		}
+		return M.evict(user, source)
+	}
+	return user.Delete(source)
+}
+
+// clone returns a copy of j. The lists of candidates are shared.
+func (j Jisyo) clone() Jisyo {
+	newJisyo := make(Jisyo, len(j))
+	for key, list := range j {
+		newJisyo[key] = list
+	}
+	return newJisyo
+}
+
+// PrefixSearch returns the sorted midashi starting with prefix.
+func (j Jisyo) PrefixSearch(prefix string) []string {
+	var result []string
+	for key := range j {
+		if strings.HasPrefix(key, prefix) {
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// user returns the user dictionary used by the conversion.
+func (M *Mode) user() Dictionary {
+	if M.UserDictionary != nil {
+		return M.UserDictionary
+	}
+	return M.User
+}
+
+// system returns the system dictionary used by the conversion.
+func (M *Mode) system() Dictionary {
+	if M.SystemDictionary != nil {
+		return M.SystemDictionary
+	}
+	return M.System
+}
+
+// inSystem reports whether the system dictionary has the text of
+// candidate for source.
+func (M *Mode) inSystem(source, candidate string) bool {
+	list, ok := M.system().Lookup(source)
+	if !ok {
+		return false
+	}
+	text := parseCandidate(candidate).Text
+	return slices.ContainsFunc(list, func(s string) bool {
+		return parseCandidate(s).Text == text
+	})
+}
@@ -0,0 +1,131 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	"sync"
+
+	rl "github.com/nyaosorg/go-readline-ny"
+)
+
+// editorFields is the part of Mode depending on go-readline-ny.
+type editorFields struct {
+	// PromptTty is the terminal of the editors for the registration mode
+	// and the questions. When it is nil, go-readline-ny opens the terminal.
+	// It is for tests driving Mode with a fake terminal.
+	PromptTty   rl.ITty
+	states      map[*rl.KeyMap]*_EditorState
+	statesMutex sync.Mutex
+	// current is the state of the editor which called SKK last.
+	current *_EditorState
+	// macro is the keys recorded since StartRecording.
+	macro     Macro
+	recording bool
+	// replaying is the keys of the macro not replayed yet.
+	replaying []string
+	// bindings is the commands made once for the mode switches.
+	bindings     bindingCache
+	bindingMutex sync.Mutex
+	// sub is the editor for the questions and the registration.
+	sub *_SubEditor
+	// controlled is true while ServeControl is serving, and the terminals
+	// of the editors are wrapped by _EditorTty to apply the requests.
+	controlled bool
+}
+
+// _EditorState is the state of SKK kept for each editor,
+// so that one Mode can serve some editors.
+type _EditorState struct {
+	layers _Layers
+	active bool
+	kana   *_Kana
+	// mode is the input mode shown by the minibuffer:
+	// StateLatin, StateHiragana, StateKatakana, StateAbbrev or StateJisx0208Latin.
+	mode State
+	// source is the reading being converted while ▼ is shown.
+	source string
+	// okuri is the midashi with the okurigana restored by the cancel
+	// of the last conversion.
+	okuri _Okuri
+	// buffer is the last buffer given to the commands of SKK.
+	buffer *rl.Buffer
+	// typeAhead is the keys typed while ContextSource was looked up,
+	// which readKey returns first.
+	typeAhead []string
+	// pendingKey is the key being read in a goroutine started while
+	// ContextSource was looked up or by getKey canceled.
+	pendingKey <-chan keyResult
+	// controls is the control requests switching the input mode,
+	// which the goroutine of the editor applies before the next key.
+	// It is guarded by statesMutex.
+	controls []string
+	// released is true after releaseMode gave back what modeHook changed,
+	// until the next key of SKK.
+	released bool
+}
+
+// keyMapOf returns the keymap of the editor X belongs to.
+// The keymap identifies the editor because *readline.Buffer is
+// created for each ReadLine call.
+func keyMapOf(X any) *rl.KeyMap {
+	switch x := X.(type) {
+	case *rl.Buffer:
+		return &x.Editor.KeyMap
+	case *rl.Editor:
+		return &x.KeyMap
+	case *rl.KeyMap:
+		return x
+	}
+	return nil
+}
+
+// stateOf returns the state of SKK for the editor X belongs to.
+func (M *Mode) stateOf(X any) *_EditorState {
+	M.statesMutex.Lock()
+	defer M.statesMutex.Unlock()
+	km := keyMapOf(X)
+	st, ok := M.states[km]
+	if !ok {
+		if M.states == nil {
+			M.states = map[*rl.KeyMap]*_EditorState{}
+		}
+		st = &_EditorState{kana: M.kanas()[0]}
+		M.states[km] = st
+	}
+	if B, ok := X.(*rl.Buffer); ok {
+		st.buffer = B
+		M.current = st
+		if M.controlled {
+			wrapTty(B, M, st)
+		}
+	}
+	return st
+}
+
+// releaseMode gives back what modeHook changed for the input mode
+// of the editor, such as when the line is accepted.
+func (M *Mode) releaseMode(B *rl.Buffer) {
+	if st := M.stateOf(B); modeHook != nil && st.active && !st.released {
+		st.released = true
+		modeHook(M, StateLatin)
+	}
+}
+
+// resumeMode calls modeHook again with the input mode of the editor
+// when releaseMode gave it back.
+func (M *Mode) resumeMode(B *rl.Buffer) {
+	if st := M.stateOf(B); st.released {
+		st.released = false
+		if modeHook != nil && st.active {
+			modeHook(M, st.mode)
+		}
+	}
+}
+
+// kanaState returns the state of the current kana input mode of the editor.
+func (M *Mode) kanaState(B any) State {
+	if M.stateOf(B).kana == M.kanas()[1] {
+		return StateKatakana
+	}
+	return StateHiragana
+}
@@ -0,0 +1,7 @@
+//go:build js || plan9
+
+package skk
+
+// editorFields is empty where go-readline-ny is not available.
+// Only the conversion engine and the dictionaries are built there.
+type editorFields struct{}
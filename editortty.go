@@ -0,0 +1,57 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	"bufio"
+	"io"
+
+	rl "github.com/nyaosorg/go-readline-ny"
+)
+
+// _EditorTty is readline.ITty which wraps the terminal of an editor,
+// so that the goroutine of the editor does what SKK has to do between
+// reading a key and dispatching it, such as applying the control requests.
+type _EditorTty struct {
+	rl.ITty
+	M  *Mode
+	st *_EditorState
+}
+
+// wrapTty wraps the terminal of the editor of B with _EditorTty
+// unless it is wrapped already.
+func wrapTty(B *rl.Buffer, M *Mode, st *_EditorState) {
+	if B.Tty == nil {
+		return
+	}
+	if _, ok := B.Tty.(*_EditorTty); !ok {
+		B.Tty = &_EditorTty{ITty: B.Tty, M: M, st: st}
+	}
+}
+
+// Raw starts reading a key. The function returned is called when the key
+// is read and before it is dispatched, and it applies the control requests
+// so that the key is dispatched in the mode they switched to.
+func (T *_EditorTty) Raw() (func() error, error) {
+	restore, err := T.ITty.Raw()
+	if err != nil {
+		return restore, err
+	}
+	return func() error {
+		err := restore()
+		T.M.applyControls(T.st)
+		return err
+	}, nil
+}
+
+// getKeyUnwrapped reads a key from the terminal of B without _EditorTty,
+// since the keys read by the commands of SKK are not dispatched by the editor.
+func getKeyUnwrapped(B *rl.Buffer) (string, error) {
+	T, ok := B.Tty.(*_EditorTty)
+	if !ok {
+		return B.GetKey()
+	}
+	B.Out.Flush()
+	reader := rl.Buffer{Editor: &rl.Editor{Tty: T.ITty, Out: bufio.NewWriterSize(io.Discard, 16)}}
+	return reader.GetKey()
+}
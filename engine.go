@@ -0,0 +1,414 @@
+package skk
+
+import (
+	"context"
+	"iter"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+const (
+	markerWhite = "▽"
+	markerBlack = "▼"
+)
+
+// Mode is an instance of SKK. It contains system dictionaries and user dictionaries.
+// A Mode must not be used by two ReadLine at the same time.
+// To share the user dictionary with other goroutines, call Synchronize.
+type Mode struct {
+	User   Jisyo
+	System Jisyo
+	// UserDictionary and SystemDictionary are used by the conversion
+	// instead of User and System when they are not nil.
+	// SaveUserJisyo and WriteTo always output User.
+	UserDictionary   Dictionary
+	SystemDictionary Dictionary
+	// Sources is the ordered list of the sources of candidates.
+	// The first source which has the entry is used.
+	// When it is nil, the user dictionary and the system dictionary are used.
+	// The words registered are stored into the user dictionary
+	// whether it is in Sources or not.
+	Sources []CandidateSource
+	// Normalization is the conventions of Unicode matched by the lookups
+	// such as NormalizeNFC. When it is zero, the readings are looked up
+	// only as they are.
+	Normalization Normalization
+	// RemoteTimeout is the limit of a lookup of ContextSource such as
+	// the servers. When it is over, the source is skipped and the sources
+	// after it are looked up. When it is zero, the limits of the sources
+	// are used.
+	RemoteTimeout time.Duration
+	MiniBuffer    MiniBuffer
+	editorFields
+	// Terminal is the control of the terminal for the messages and the
+	// questions. When it is nil, ANSITerminal is used.
+	// The minibuffers have their own Terminal.
+	Terminal Terminal
+	// SelectionKeys is the key table for the candidate listing.
+	// When it is nil, DefaultSelectionKeys is used.
+	SelectionKeys *SelectionKeys
+	// QuotedInsertKey is the key to insert the next typed character as it is
+	// in the SKK modes. It must be a single-byte key such as Ctrl-Q.
+	// When it is empty, Ctrl-Q is used.
+	QuotedInsertKey keys.Code
+	// KeyBindings overrides DefaultKeyBindings. A key bound to an empty
+	// string is left as the original binding of the editor.
+	// The keys must be single-byte keys as QuotedInsertKey.
+	// While ▼ is shown, the keys of SKK_START_HENKAN show the next candidate
+	// and the keys of SKK_TOGGLE_KANA convert the reading to katakana.
+	KeyBindings map[keys.Code]string
+	// PasteAsRomaji converts the text pasted with the bracketed paste mode
+	// in the kana modes as the romaji typed. When it is false,
+	// the text is inserted as it is. See EnableBracketedPaste.
+	PasteAsRomaji bool
+	// ConfirmOverwrite is called by SaveUserJisyo when the user dictionary
+	// file was changed by others since loaded. Returning false cancels saving.
+	ConfirmOverwrite func(filename string) bool
+	// DateFormats is the formats of the date for FormatDate. SKK_TODAY
+	// inserts the date in the first one. When it is nil,
+	// DefaultDateFormats is used.
+	DateFormats []string
+	// MaxRegistrationDepth is the limit of the nesting of the registration
+	// mode started in the registration mode. When it is zero, 8 is used.
+	MaxRegistrationDepth int
+	// Logger receives the trace of the key dispatch, the dictionary lookups
+	// and the state transitions. When it is nil, nothing is traced.
+	Logger         Logger
+	whiteMarker    string
+	blackMarker    string
+	kanaTable      []*_Kana
+	recent         []Conversion
+	recentMutex    sync.Mutex
+	numConvs       map[byte]func(string) string
+	dirty          atomic.Bool
+	closers        []func() error
+	metrics        Metrics
+	metricsMutex   sync.Mutex
+	userJisyoPath  string
+	userJisyoStamp time.Time
+	usage          userUsage
+	autoSaver      *autoSaver
+	sharedBy       *Mode
+	depth          int
+	onStateChange  func(State)
+	onModeChange   func(State)
+	reportedMode   State
+	onKakutei      func(string)
+	onRegister     func(source, word string)
+	onPurge        func(source, candidate string)
+	onError        func(error)
+}
+
+var rxNumber = regexp.MustCompile(`[0-9]+`)
+
+var rxToNumber = regexp.MustCompile(`#[0-9]`)
+
+var kansuji = map[rune]string{
+	'0': "〇",
+	'1': "一",
+	'2': "二",
+	'3': "三",
+	'4': "四",
+	'5': "五",
+	'6': "六",
+	'7': "七",
+	'8': "八",
+	'9': "九",
+}
+
+func numberToKanji(s string) string {
+	var buffer strings.Builder
+	for _, r := range s {
+		buffer.WriteString(kansuji[r])
+	}
+	return buffer.String()
+}
+
+// hanToZenString converts the characters of s with hanToZen.
+// The half-width katakana followed by the half-width (semi-)voiced
+// sound mark is converted into one full-width katakana such as ｶﾞ to ガ.
+func hanToZenString(s string) string {
+	var buffer strings.Builder
+	var last rune
+	for _, r := range s {
+		z := hanToZen(r)
+		if v, ok := voiced(last, z); ok {
+			last = v
+			continue
+		}
+		if last != 0 {
+			buffer.WriteRune(last)
+		}
+		last = z
+	}
+	if last != 0 {
+		buffer.WriteRune(last)
+	}
+	return buffer.String()
+}
+
+// voiced returns the katakana r with the (semi-)voiced sound mark mark.
+func voiced(r, mark rune) (rune, bool) {
+	switch mark {
+	case '゛':
+		if r == 'ウ' {
+			return 'ヴ', true
+		}
+		if strings.ContainsRune("カキクケコサシスセソタチツテトハヒフヘホ", r) {
+			return r + 1, true
+		}
+	case '゜':
+		if strings.ContainsRune("ハヒフヘホ", r) {
+			return r + 2, true
+		}
+	}
+	return r, false
+}
+
+// _lookup returns the candidates of the first source which has source.
+// list is set for the plain sources, and seq for StreamSource.
+// list is shared with the dictionary and must not be modified.
+// The words hidden by skk-ignore-dic-word are dropped from the sources
+// after it, and the entry with nothing but it is skipped.
+// Each source is looked up with the forms of source by Normalization.
+// ContextSource is given up by ctx and RemoteTimeout.
+func (M *Mode) _lookup(ctx context.Context, source string) (list []string, seq iter.Seq[string], ok bool) {
+	n := M.Normalization
+	forms := []string{source}
+	if n != 0 {
+		forms = n.readings(source)
+	}
+	var ignored []string
+	for _, s := range M.sources() {
+		for _, form := range forms {
+			if ctx.Err() != nil {
+				return nil, nil, false
+			}
+			if cs, ok := s.(ContextSource); ok {
+				if list, ok = M.lookupRemote(ctx, cs, form); !ok {
+					continue
+				}
+				words := ignoredWords(list)
+				if list = dropIgnored(list, ignored); len(list) > 0 || len(words) == 0 {
+					return n.candidates(list), nil, true
+				}
+				ignored = append(ignored, words...)
+			} else if ss, ok := s.(StreamSource); ok {
+				if seq, ok := ss.LookupSeq(form); ok {
+					return nil, n.candidateSeq(dropIgnoredSeq(seq, ignored)), true
+				}
+			} else if list, ok := s.Lookup(form); ok {
+				words := ignoredWords(list)
+				if list = dropIgnored(list, ignored); len(list) > 0 || len(words) == 0 {
+					return n.candidates(list), nil, true
+				}
+				ignored = append(ignored, words...)
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// lookupRemote looks up cs with the deadline of RemoteTimeout.
+func (M *Mode) lookupRemote(ctx context.Context, cs ContextSource, source string) ([]string, bool) {
+	if M.RemoteTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, M.RemoteTimeout)
+		defer cancel()
+	}
+	list, ok := cs.LookupContext(ctx, source)
+	if err := ctx.Err(); err != nil && M.Logger != nil {
+		M.debugf("lookup %q: %T: %v", source, cs, err)
+	}
+	return list, ok
+}
+
+func (M *Mode) _lookupSeq(ctx context.Context, source string) (iter.Seq[string], bool) {
+	list, seq, ok := M._lookup(ctx, source)
+	if ok && seq == nil {
+		seq = slices.Values(list)
+	}
+	return seq, ok
+}
+
+// hasDigit reports whether s contains an ASCII digit
+// without the regular expression.
+func hasDigit(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if '0' <= s[i] && s[i] <= '9' {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupNumber looks up source with the number replaced by "#"
+// and returns the candidates with the numeric conversion applied.
+func (M *Mode) lookupNumber(ctx context.Context, source string) (iter.Seq[string], bool) {
+	if !hasDigit(source) {
+		return nil, false
+	}
+	loc := rxNumber.FindStringIndex(source)
+	number := source[loc[0]:loc[1]]
+	source = source[:loc[0]] + "#" + source[loc[1]:]
+	seq, ok := M._lookupSeq(ctx, source)
+	if M.Logger != nil {
+		M.debugf("lookup %q: %v", source, ok)
+	}
+	if !ok {
+		return nil, false
+	}
+	return func(yield func(string) bool) {
+		for s := range seq {
+			if strings.IndexByte(s, '#') >= 0 {
+				s = rxToNumber.ReplaceAllStringFunc(s, func(ss string) string {
+					return M.numConv(ss[1])(number)
+				})
+			}
+			if !yield(s) {
+				return
+			}
+		}
+	}, true
+}
+
+func (M *Mode) lookup(source string) ([]string, bool) {
+	ctx := context.Background()
+	list, seq, ok := M._lookup(ctx, source)
+	if M.Logger != nil {
+		M.debugf("lookup %q: %v", source, ok)
+	}
+	if ok && seq == nil {
+		return list, true
+	}
+	if !ok {
+		if seq, ok = M.lookupNumber(ctx, source); !ok {
+			if seq, ok = lookupChar(source); !ok {
+				return nil, false
+			}
+		}
+	}
+	return slices.Collect(seq), true
+}
+
+// lookupHenkan returns _Henkan with the candidates for source.
+// The list of a plain source is used as it is without iter.Pull.
+// When no source has it, the numeric conversion and charByName are tried.
+func (M *Mode) lookupHenkan(ctx context.Context, source string) (*_Henkan, bool) {
+	list, seq, ok := M._lookup(ctx, source)
+	if M.Logger != nil {
+		M.debugf("lookup %q: %v", source, ok)
+	}
+	var h *_Henkan
+	if ok && seq == nil {
+		h = newHenkan(list, M.selectionKeys())
+	} else {
+		if !ok {
+			if seq, ok = M.lookupNumber(ctx, source); !ok {
+				if seq, ok = lookupChar(source); !ok {
+					return nil, false
+				}
+			}
+		}
+		h = newHenkanSeq(seq, M.selectionKeys())
+	}
+	h.bindings = M.keyBindings()
+	return h, true
+}
+
+// unshift returns a new slice with value followed by list.
+// The underlying array of list is not modified because it may be shared
+// with the dictionary.
+func unshift[T any](list []T, value T) []T {
+	newList := make([]T, 0, len(list)+1)
+	newList = append(newList, value)
+	return append(newList, list...)
+}
+
+// maxRegistrationDepth is the default limit of the nesting of
+// the registration mode. The registration mode can start another
+// registration mode when a word typed in it is not found in dictionaries.
+const maxRegistrationDepth = 8
+
+// maxDepth returns the limit of the nesting of the registration mode.
+func (M *Mode) maxDepth() int {
+	if M.MaxRegistrationDepth > 0 {
+		return M.MaxRegistrationDepth
+	}
+	return maxRegistrationDepth
+}
+
+// registrationPrompt returns the prompt for the registration mode.
+// For okuri-ari entries, the reading is shown as `stem*okurigana`.
+func registrationPrompt(depth int, source, postfix string) string {
+	if postfix != "" {
+		source = source[:len(source)-1] + "*" + postfix
+	}
+	return strings.Repeat("[", depth+1) + "辞書登録" + strings.Repeat("]", depth+1) + " " + source
+}
+
+// white returns the marker shown while the midashi is being typed.
+func (M *Mode) white() string {
+	if M.whiteMarker != "" {
+		return M.whiteMarker
+	}
+	return markerWhite
+}
+
+// black returns the marker shown while the candidate is being selected.
+func (M *Mode) black() string {
+	if M.blackMarker != "" {
+		return M.blackMarker
+	}
+	return markerBlack
+}
+
+// hanToZenSpecial is the characters whose full-width forms defined by
+// JIS X 0208 are not at the offset of U+FF00, as DDSKK converts them.
+var hanToZenSpecial = map[rune]rune{
+	' ':  '　',
+	'"':  '”',
+	'\'': '’',
+	'~':  '￣',
+	'¢':  '￠',
+	'£':  '￡',
+	'¥':  '￥',
+	'¬':  '￢',
+	'¯':  '￣',
+}
+
+// hanKana is the full-width forms of the half-width katakana
+// from U+FF61 to U+FF9F.
+var hanKana = []rune("。「」、・ヲァィゥェォャュョッーアイウエオカキクケコサシスセソタチツテトナニヌネノハヒフヘホマミムメモヤユヨラリルレロワン゛゜")
+
+// hanToZen returns the full-width form of c in JIS X 0208.
+// The characters which have no such form are returned as they are.
+func hanToZen(c rune) rune {
+	if z, ok := hanToZenSpecial[c]; ok {
+		return z
+	}
+	if c > ' ' && c < '\x7f' {
+		return c - ' ' + '\uFF00'
+	}
+	if c >= 0xFF61 && c <= 0xFF9F {
+		return hanKana[c-0xFF61]
+	}
+	return c
+}
+
+// toKatakana returns s with the hiragana replaced by the katakana.
+func toKatakana(s string) string {
+	return strings.Map(func(r rune) rune {
+		// ぁ-ゖ と ゝゞ はカタカナと同じ並び
+		if (r >= 'ぁ' && r <= 'ゖ') || r == 'ゝ' || r == 'ゞ' {
+			return r + 'ァ' - 'ぁ'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,59 @@
+package skk
+
+import (
+	"iter"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// isOkuriAri returns true when key is the midashi of an okuri-ari entry.
+func isOkuriAri(key string) bool {
+	r, _ := utf8.DecodeLastRuneInString(key)
+	return 'a' <= r && r <= 'z'
+}
+
+// filter enumerates the entries whose midashi satisfies f
+// in the order of the midashi.
+func (j Jisyo) filter(f func(string) bool) iter.Seq2[string, []Candidate] {
+	return func(yield func(string, []Candidate) bool) {
+		keys := make([]string, 0, len(j))
+		for key := range j {
+			if f(key) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			list := j[key]
+			candidates := make([]Candidate, 0, len(list))
+			for _, s := range list {
+				candidates = append(candidates, parseCandidate(s))
+			}
+			if !yield(key, candidates) {
+				return
+			}
+		}
+	}
+}
+
+// All enumerates all the entries in the order of the midashi.
+func (j Jisyo) All() iter.Seq2[string, []Candidate] {
+	return j.filter(func(string) bool { return true })
+}
+
+// OkuriAri enumerates the okuri-ari entries such as "かk" in the order of the midashi.
+func (j Jisyo) OkuriAri() iter.Seq2[string, []Candidate] {
+	return j.filter(isOkuriAri)
+}
+
+// OkuriNasi enumerates the okuri-nasi entries in the order of the midashi.
+func (j Jisyo) OkuriNasi() iter.Seq2[string, []Candidate] {
+	return j.filter(func(key string) bool { return !isOkuriAri(key) })
+}
+
+// WithPrefix enumerates the entries whose midashi starts with prefix
+// in the order of the midashi.
+func (j Jisyo) WithPrefix(prefix string) iter.Seq2[string, []Candidate] {
+	return j.filter(func(key string) bool { return strings.HasPrefix(key, prefix) })
+}
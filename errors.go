@@ -0,0 +1,30 @@
+package skk
+
+import "fmt"
+
+// JisyoError is the error of an operation on a dictionary
+// reported to the function set by OnError.
+type JisyoError struct {
+	// Op is the operation: "register", "purge", "edit" or "save"
+	Op string
+	// Source is the midashi of the entry. It is empty for "save".
+	Source string
+	Err    error
+}
+
+func (e *JisyoError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("SKK-ERROR: %s: %s", e.Op, e.Err.Error())
+	}
+	return fmt.Sprintf("SKK-ERROR: %s %s: %s", e.Op, e.Source, e.Err.Error())
+}
+
+func (e *JisyoError) Unwrap() error {
+	return e.Err
+}
+
+// OnError sets the function called when an operation on a dictionary fails.
+// When it is not set, the error is shown on the minibuffer.
+func (M *Mode) OnError(f func(error)) {
+	M.onError = f
+}
@@ -0,0 +1,66 @@
+package skk
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// defaultCommandTimeout is the limit of a lookup by CommandSource
+// when its Timeout is zero.
+const defaultCommandTimeout = 3 * time.Second
+
+// commandWaitDelay is the time to wait for the output closed after
+// the program is killed, which the children of it may keep open.
+const commandWaitDelay = 100 * time.Millisecond
+
+// CommandSource is CandidateSource which runs an external program
+// such as kakasi or a script for each lookup. The reading is written to
+// its standard input with a newline, and each non-empty line of its
+// standard output is a candidate. The text is UTF-8.
+// It enables conversions by morphological analyzers or LLMs
+// without linking them.
+type CommandSource struct {
+	// Path and Args are the program and its arguments as exec.Command.
+	Path string
+	Args []string
+	// Timeout is the limit of a lookup. The program is killed after it.
+	// When it is zero, 3 seconds is used.
+	Timeout time.Duration
+	// Logger receives the errors of the program. It may be nil.
+	Logger Logger
+}
+
+// Lookup runs the program with source and returns its output lines.
+func (c *CommandSource) Lookup(source string) ([]string, bool) {
+	return c.LookupContext(context.Background(), source)
+}
+
+// LookupContext is Lookup which kills the program when ctx is canceled.
+func (c *CommandSource) LookupContext(ctx context.Context, source string) ([]string, bool) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, c.Path, c.Args...)
+	cmd.Stdin = strings.NewReader(source + "\n")
+	cmd.WaitDelay = commandWaitDelay
+	output, err := cmd.Output()
+	if err != nil {
+		if c.Logger != nil {
+			c.Logger.Printf("%s %q: %v", c.Path, source, err)
+		}
+		return nil, false
+	}
+	var list []string
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line != "" {
+			list = append(list, line)
+		}
+	}
+	return list, len(list) > 0
+}
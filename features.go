@@ -0,0 +1,57 @@
+package skk
+
+import (
+	"runtime/debug"
+	"sort"
+)
+
+// FeatureSet is the capabilities of this package returned by Features.
+type FeatureSet struct {
+	// Version is the version of this module linked to the application.
+	// It is "(devel)" or empty when unknown.
+	Version string
+	// NumericConversions is the numeric conversion types such as "#0".
+	NumericConversions []string
+	// LispFunctions is the Lisp functions evaluated in candidates.
+	LispFunctions []string
+	// Layouts is the input layouts of kana.
+	Layouts []string
+	// Punctuations is the values of "punctuation" in the configuration file.
+	Punctuations []string
+	// Backends is the kinds of the sources of candidates.
+	Backends []string
+	// ConfigFormats is the formats of the configuration file.
+	ConfigFormats []string
+}
+
+const modulePath = "github.com/hymkor/go-readline-skk"
+
+// lispFunctions is the names of the Lisp functions supported.
+var lispFunctions = []string{}
+
+// Features returns the capabilities of this package, so that the application
+// can adapt its help text and the validation of its configuration.
+func Features() FeatureSet {
+	f := FeatureSet{
+		NumericConversions: builtinNumConvs(),
+		LispFunctions:      append([]string{}, lispFunctions...),
+		Layouts:            layoutNames(),
+		Backends:           []string{"jisyo", "sync", "source", "stream", "command", "http", "mmap"},
+		ConfigFormats:      []string{"json"},
+	}
+	for name := range punctuations {
+		f.Punctuations = append(f.Punctuations, name)
+	}
+	sort.Strings(f.Punctuations)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Path == modulePath {
+			f.Version = info.Main.Version
+		}
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				f.Version = dep.Version
+			}
+		}
+	}
+	return f
+}
@@ -1,17 +1,18 @@
 module github.com/hymkor/go-readline-skk
 
-go 1.20
+go 1.23
 
 require (
+	github.com/atotto/clipboard v0.1.4
+	github.com/mattn/go-runewidth v0.0.14
 	github.com/nyaosorg/go-readline-ny v0.13.1
 	golang.org/x/text v0.9.0
 )
 
 require (
-	github.com/atotto/clipboard v0.1.4 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
-	github.com/mattn/go-runewidth v0.0.14 // indirect
 	github.com/mattn/go-tty v0.0.5 // indirect
 	github.com/rivo/uniseg v0.4.4 // indirect
 	golang.org/x/sys v0.8.0 // indirect
+	golang.org/x/term v0.7.0 // indirect
 )
@@ -0,0 +1,318 @@
+package skk
+
+import (
+	"fmt"
+	"iter"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+const listingStartIndex = 4
+
+// _HenkanAction is what the editor has to do after _Henkan.step.
+type _HenkanAction int
+
+const (
+	// henkanNone means nothing to do.
+	henkanNone _HenkanAction = iota
+	// henkanShow means to show the current candidate after ▼.
+	henkanShow
+	// henkanList means to show the listing page returned by listingPrompt.
+	henkanList
+	// henkanKakutei means to confirm the text shown after ▼.
+	henkanKakutei
+	// henkanKakuteiAndEval means to confirm the text after ▼
+	// and to process the key as usual.
+	henkanKakuteiAndEval
+	// henkanSelect means to confirm the current candidate chosen on the listing.
+	henkanSelect
+	// henkanCancel means to return to ▽ with the midashi.
+	henkanCancel
+	// henkanRegister means to start the registration mode.
+	henkanRegister
+	// henkanPurge means to confirm purging the current candidate.
+	henkanPurge
+	// henkanKakuteiAndInsert means to confirm the text after ▼
+	// and to insert the key as it is, such as the pasted text.
+	henkanKakuteiAndInsert
+	// henkanInterrupt means to leave the midashi without the marker
+	// and to interrupt the editor by Ctrl-C.
+	henkanInterrupt
+	// henkanKatakana means to confirm the text after ▼ in katakana.
+	henkanKatakana
+)
+
+// The sequences of the bracketed paste mode of the terminals.
+const (
+	bracketedPasteOn  = "\x1B[?2004h"
+	bracketedPasteOff = "\x1B[?2004l"
+	// pasteStart and pasteEnd enclose the pasted text.
+	pasteStart = "\x1B[200~"
+	pasteEnd   = "\x1B[201~"
+)
+
+// _KeyClass is the kind of a key read in the conversion.
+type _KeyClass int
+
+const (
+	// keyPrintable is one printable character.
+	keyPrintable _KeyClass = iota
+	// keyControl is one control character such as Ctrl-J or DEL.
+	keyControl
+	// keySequence is the escape sequence of a special key such as an arrow key.
+	keySequence
+	// keyPaste is some characters read at once such as the pasted text.
+	keyPaste
+)
+
+// classifyKey returns the kind of key, so that the conversion neither
+// runs the pasted text as the commands nor inserts the escape sequences.
+func classifyKey(key string) _KeyClass {
+	switch {
+	case len(key) == 1 && (key[0] < ' ' || key[0] == 0x7F):
+		return keyControl
+	case strings.HasPrefix(key, pasteStart):
+		return keyPaste
+	case len(key) > 1 && key[0] == 0x1B:
+		return keySequence
+	case utf8.RuneCountInString(key) > 1:
+		return keyPaste
+	}
+	return keyPrintable
+}
+
+// _Henkan is the state machine of the conversion of one midashi.
+// It does not touch the terminal or the buffer: the caller reads keys,
+// gives them to step and applies the action returned.
+// The candidates are read from the iterator only as many as needed.
+type _Henkan struct {
+	list []string
+	// parsed caches the candidates of list split from the annotations.
+	parsed  []Candidate
+	next    func() (string, bool)
+	stop    func()
+	current int
+	listing bool
+	keys    *SelectionKeys
+	// bindings is the key bindings of the kana modes, which give the keys
+	// of the next candidate and the katakana. When it is nil,
+	// DefaultKeyBindings is used.
+	bindings map[keys.Code]string
+	// annotation shows the annotations in the listing.
+	annotation bool
+	// menu lists the candidates from the first one without ▼,
+	// such as the symbols of SKK_INPUT_BY_CODE.
+	menu bool
+}
+
+func newHenkan(list []string, sk *SelectionKeys) *_Henkan {
+	return &_Henkan{list: list, keys: sk}
+}
+
+// newMenu returns _Henkan listing list from the first item.
+func newMenu(list []string, sk *SelectionKeys) *_Henkan {
+	return &_Henkan{list: list, keys: sk, listing: true, menu: true}
+}
+
+func newHenkanSeq(seq iter.Seq[string], sk *SelectionKeys) *_Henkan {
+	next, stop := iter.Pull(seq)
+	return &_Henkan{next: next, stop: stop, keys: sk}
+}
+
+// close stops reading the candidates.
+func (h *_Henkan) close() {
+	if h.stop != nil {
+		h.stop()
+		h.next, h.stop = nil, nil
+	}
+}
+
+// has reads the candidates until the index i and
+// returns true when the candidate of i exists.
+func (h *_Henkan) has(i int) bool {
+	for i >= len(h.list) && h.next != nil {
+		s, ok := h.next()
+		if !ok {
+			h.close()
+			break
+		}
+		h.list = append(h.list, s)
+	}
+	return i < len(h.list)
+}
+
+// all reads all the candidates and returns them.
+func (h *_Henkan) all() []string {
+	for h.next != nil {
+		h.has(len(h.list))
+	}
+	return h.list
+}
+
+// at returns the candidate of the index i split from the annotation.
+// i must be read by has already.
+func (h *_Henkan) at(i int) Candidate {
+	for len(h.parsed) <= i {
+		h.parsed = append(h.parsed, parseCandidate(h.list[len(h.parsed)]))
+	}
+	return h.parsed[i]
+}
+
+// candidate returns the current candidate without the annotation.
+func (h *_Henkan) candidate() string {
+	return h.at(h.current).Text
+}
+
+// pageEnd returns the index next to the last candidate on the listing page.
+func (h *_Henkan) pageEnd() int {
+	end := h.current
+	for n := len([]rune(h.keys.Select)); n > 0 && h.has(end); n-- {
+		end++
+	}
+	return end
+}
+
+// listingPrompt returns the text of the current listing page.
+// When the candidates are not read to the end,
+// the number of the rest is shown as the least one with "+".
+func (h *_Henkan) listingPrompt() string {
+	var buffer strings.Builder
+	end := h.pageEnd()
+	keys := []rune(h.keys.Select)
+	for i := h.current; i < end; i++ {
+		c := h.at(i)
+		if h.annotation && c.Annotation != "" {
+			fmt.Fprintf(&buffer, "%c:%s(%s) ", unicode.ToUpper(keys[i-h.current]), c.Text, c.Annotation)
+		} else {
+			fmt.Fprintf(&buffer, "%c:%s ", unicode.ToUpper(keys[i-h.current]), c.Text)
+		}
+	}
+	h.has(end)
+	if h.next != nil {
+		fmt.Fprintf(&buffer, "[残り %d+]", len(h.list)-end)
+	} else {
+		fmt.Fprintf(&buffer, "[残り %d]", len(h.list)-end)
+	}
+	return buffer.String()
+}
+
+// purged returns a new list without the current candidate.
+func (h *_Henkan) purged() []string {
+	list := h.all()
+	newList := make([]string, 0, len(list))
+	newList = append(newList, list[:h.current]...)
+	return append(newList, list[h.current+1:]...)
+}
+
+// step changes the state by key and returns what to do.
+func (h *_Henkan) step(key string) _HenkanAction {
+	if key == string(keys.CtrlC) {
+		return henkanInterrupt
+	}
+	if h.listing {
+		return h.stepListing(key)
+	}
+	switch key {
+	case string(keys.Down), string(keys.CtrlN):
+		// カーソル移動にせず SPC と同じく次の候補にする
+		return h.forward()
+	case string(keys.Up), string(keys.CtrlP):
+		return h.backward()
+	}
+	switch classifyKey(key) {
+	case keyControl:
+		switch key {
+		case string(keys.CtrlG):
+			return henkanCancel
+		case string(keys.Backspace):
+			return henkanKakuteiAndEval
+		}
+		return henkanKakutei
+	case keySequence:
+		return henkanKakuteiAndEval
+	case keyPaste:
+		return henkanKakuteiAndInsert
+	}
+	bindings := h.bindings
+	if bindings == nil {
+		bindings = DefaultKeyBindings
+	}
+	switch bindings[keys.Code(key)] {
+	case "SKK_START_HENKAN":
+		return h.forward()
+	case "SKK_TOGGLE_KANA":
+		return henkanKatakana
+	}
+	if h.keys.PrevPage.has(key) {
+		return h.backward()
+	} else if h.keys.Purge.has(key) {
+		return henkanPurge
+	}
+	return henkanKakuteiAndEval
+}
+
+// forward moves to the next candidate, which may start the listing
+// or the registration mode.
+func (h *_Henkan) forward() _HenkanAction {
+	h.current++
+	if !h.has(h.current) {
+		return henkanRegister
+	}
+	if h.current >= listingStartIndex {
+		h.listing = true
+		return henkanList
+	}
+	return henkanShow
+}
+
+// backward moves to the previous candidate, or back to ▽ from the first one.
+func (h *_Henkan) backward() _HenkanAction {
+	h.current--
+	if h.current < 0 {
+		return henkanCancel
+	}
+	return henkanShow
+}
+
+func (h *_Henkan) stepListing(key string) _HenkanAction {
+	if classifyKey(key) == keyPaste {
+		return henkanKakuteiAndInsert
+	}
+	sk := h.keys
+	end := h.pageEnd()
+	if index := indexRune([]rune(sk.Select), key); index >= 0 && h.current+index < end {
+		h.current += index
+		return henkanSelect
+	} else if sk.NextPage.has(key) {
+		if !h.menu && !h.has(end) {
+			// 最後のページの次は ddskk と同じく辞書登録に入る
+			return henkanRegister
+		}
+		h.current = end
+	} else if sk.PrevPage.has(key) {
+		h.current -= len([]rune(sk.Select))
+	} else if sk.NextItem.has(key) || key == string(keys.Down) {
+		if h.has(h.current + 1) {
+			h.current++
+		}
+	} else if sk.PrevItem.has(key) || key == string(keys.Up) {
+		h.current--
+	} else if sk.Cancel.has(key) {
+		return henkanCancel
+	} else {
+		return henkanNone
+	}
+	if h.menu && (h.current < 0 || !h.has(h.current)) {
+		// メニューには一覧表示の前の候補がないので先頭に戻る
+		h.current = 0
+	} else if !h.menu && h.current < listingStartIndex {
+		// 一覧表示の前の候補に戻る
+		h.listing = false
+		h.current = listingStartIndex - 1
+		return henkanShow
+	}
+	return henkanList
+}
@@ -0,0 +1,301 @@
+package skk
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+func TestHenkanCycle(t *testing.T) {
+	h := newHenkan([]string{"漢字", "感じ;feeling", "幹事"}, DefaultSelectionKeys)
+	for i, tc := range []struct {
+		key       string
+		action    _HenkanAction
+		candidate string
+	}{
+		{" ", henkanShow, "感じ"},
+		{" ", henkanShow, "幹事"},
+		{"x", henkanShow, "感じ"},
+		{"x", henkanShow, "漢字"},
+		{"a", henkanKakuteiAndEval, "漢字"},
+		{string(keys.CtrlJ), henkanKakutei, "漢字"},
+		{"X", henkanPurge, "漢字"},
+		{"q", henkanKatakana, "漢字"},
+	} {
+		if action := h.step(tc.key); action != tc.action {
+			t.Fatalf("%d: %q: action %d, expected %d", i, tc.key, action, tc.action)
+		}
+		if c := h.candidate(); c != tc.candidate {
+			t.Fatalf("%d: %q: candidate %q, expected %q", i, tc.key, c, tc.candidate)
+		}
+	}
+	if action := h.step("x"); action != henkanCancel {
+		t.Fatalf("x on the first candidate: action %d", action)
+	}
+}
+
+func TestHenkanCustomKeys(t *testing.T) {
+	h := newHenkan([]string{"漢字", "感じ", "幹事"}, &SelectionKeys{
+		Select:   "asdfjkl",
+		PrevPage: KeyList{"p"},
+		Purge:    KeyList{"D"},
+	})
+	h.bindings = map[keys.Code]string{"n": "SKK_START_HENKAN", "k": "SKK_TOGGLE_KANA"}
+	for i, tc := range []struct {
+		key       string
+		action    _HenkanAction
+		candidate string
+	}{
+		{"n", henkanShow, "感じ"},
+		{" ", henkanKakuteiAndEval, "感じ"},
+		{"p", henkanShow, "漢字"},
+		{"x", henkanKakuteiAndEval, "漢字"},
+		{"D", henkanPurge, "漢字"},
+		{"X", henkanKakuteiAndEval, "漢字"},
+		{"k", henkanKatakana, "漢字"},
+		{"q", henkanKakuteiAndEval, "漢字"},
+	} {
+		if action := h.step(tc.key); action != tc.action {
+			t.Fatalf("%d: %q: action %d, expected %d", i, tc.key, action, tc.action)
+		}
+		if c := h.candidate(); c != tc.candidate {
+			t.Fatalf("%d: %q: candidate %q, expected %q", i, tc.key, c, tc.candidate)
+		}
+	}
+}
+
+func TestHenkanRegister(t *testing.T) {
+	h := newHenkan([]string{"書", "欠"}, DefaultSelectionKeys)
+	h.step(" ")
+	if action := h.step(" "); action != henkanRegister {
+		t.Fatalf("action %d, expected henkanRegister", action)
+	}
+}
+
+func TestHenkanListing(t *testing.T) {
+	list := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		list = append(list, string(rune('A'+i)))
+	}
+	h := newHenkan(list, DefaultSelectionKeys)
+	for i := 0; i < listingStartIndex-1; i++ {
+		h.step(" ")
+	}
+	if action := h.step(" "); action != henkanList || !h.listing {
+		t.Fatalf("action %d, expected henkanList", action)
+	}
+	if p := h.listingPrompt(); p != "A:E S:F D:G F:H J:I K:J L:K ::L [残り 8]" {
+		t.Fatalf("prompt %q", p)
+	}
+	h.step(" ")
+	if p := h.listingPrompt(); p != "A:M S:N D:O F:P J:Q K:R L:S ::T [残り 0]" {
+		t.Fatalf("prompt %q", p)
+	}
+	if action := h.step(" "); action != henkanRegister {
+		t.Fatalf("action %d on the last page, expected henkanRegister", action)
+	}
+	if action := h.step("s"); action != henkanSelect || h.candidate() != "N" {
+		t.Fatalf("action %d, candidate %q", action, h.candidate())
+	}
+	h = newHenkan(list, DefaultSelectionKeys)
+	for i := 0; i < listingStartIndex; i++ {
+		h.step(" ")
+	}
+	if action := h.step("x"); action != henkanShow || h.listing || h.candidate() != "D" {
+		t.Fatalf("action %d, candidate %q", action, h.candidate())
+	}
+	h.step(" ")
+	if action := h.step(string(keys.CtrlG)); action != henkanCancel {
+		t.Fatalf("action %d, expected henkanCancel", action)
+	}
+}
+
+func TestHenkanPurged(t *testing.T) {
+	list := []string{"漢字", "感じ", "幹事"}
+	h := newHenkan(list, DefaultSelectionKeys)
+	h.step(" ")
+	purged := h.purged()
+	if len(purged) != 2 || purged[0] != "漢字" || purged[1] != "幹事" {
+		t.Fatalf("purged %q", purged)
+	}
+	if list[1] != "感じ" {
+		t.Fatal("the original list is changed")
+	}
+}
+
+func TestHenkanSeq(t *testing.T) {
+	pulled := 0
+	seq := func(yield func(string) bool) {
+		for i := 0; i < 1000; i++ {
+			pulled++
+			if !yield(string(rune('A' + i%26))) {
+				return
+			}
+		}
+	}
+	h := newHenkanSeq(seq, DefaultSelectionKeys)
+	defer h.close()
+	if !h.has(0) || h.candidate() != "A" || pulled != 1 {
+		t.Fatalf("candidate %q, pulled %d", h.candidate(), pulled)
+	}
+	for i := 0; i < listingStartIndex; i++ {
+		h.step(" ")
+	}
+	if p := h.listingPrompt(); p != "A:E S:F D:G F:H J:I K:J L:K ::L [残り 1+]" {
+		t.Fatalf("prompt %q", p)
+	}
+	if pulled != 13 {
+		t.Fatalf("pulled %d", pulled)
+	}
+	if n := len(h.all()); n != 1000 {
+		t.Fatalf("all %d", n)
+	}
+}
+
+func TestHenkanAnnotation(t *testing.T) {
+	h := newHenkan([]string{"A", "B", "C", "D", "E;e", "F"}, DefaultSelectionKeys)
+	h.annotation = true
+	for i := 0; i < listingStartIndex; i++ {
+		h.step(" ")
+	}
+	if p := h.listingPrompt(); p != "A:E(e) S:F [残り 0]" {
+		t.Fatalf("prompt %q", p)
+	}
+}
+
+func TestLookupAllocs(t *testing.T) {
+	M := New()
+	M.System["かんじ"] = []string{"漢字", "感じ;feeling"}
+	M.System["#かい"] = []string{"#1回", "#3回"}
+	allocs := testing.AllocsPerRun(100, func() {
+		M.lookup("かんじ")
+	})
+	if allocs > 0 {
+		t.Fatalf("lookup allocates %v times", allocs)
+	}
+	if list, ok := M.lookup("12かい"); !ok || list[0] != "１２回" || list[1] != "一二回" {
+		t.Fatalf("%v %v", list, ok)
+	}
+	if _, ok := M.lookup("なし"); ok {
+		t.Fatal("なし was found")
+	}
+}
+
+func TestNormalization(t *testing.T) {
+	M := New()
+	M.System["う゛ぁいおりん"] = []string{"ウ゛ァイオリン"}
+	M.System["か\u3099いこく"] = []string{"外国"}
+	M.System["abc"] = []string{"ABC"}
+	for _, source := range []string{"ゔぁいおりん", "がいこく", "ａｂｃ"} {
+		if _, ok := M.lookup(source); ok {
+			t.Fatalf("%s is found without Normalization", source)
+		}
+	}
+	M.Normalization = NormalizeNFC | NormalizeVu | NormalizeWidth
+	for _, c := range []struct {
+		source   string
+		expected string
+	}{
+		{"ゔぁいおりん", "ヴァイオリン"},
+		{"がいこく", "外国"},
+		{"ａｂｃ", "ABC"},
+	} {
+		if list, ok := M.lookup(c.source); !ok || len(list) != 1 || list[0] != c.expected {
+			t.Fatalf("%s: %q %v", c.source, list, ok)
+		}
+	}
+	if list := M.System["う゛ぁいおりん"]; list[0] != "ウ゛ァイオリン" {
+		t.Fatalf("the dictionary is modified: %q", list)
+	}
+	if _, err := parseNormalization([]string{"nfc", "NFKC"}); err == nil {
+		t.Fatal("NFKC is accepted")
+	}
+}
+
+// manyCandidates returns n candidates with the annotations.
+func manyCandidates(n int) []string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = fmt.Sprintf("候補%d;注釈%d", i, i)
+	}
+	return list
+}
+
+// BenchmarkHenkanPage measures one page of the listing, which must not
+// depend on the number of the candidates.
+func BenchmarkHenkanPage(b *testing.B) {
+	for _, n := range []int{10, 1000, 100000} {
+		list := manyCandidates(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.ReportAllocs()
+			h := newHenkan(list, DefaultSelectionKeys)
+			h.annotation = true
+			for i := 0; i < b.N; i++ {
+				if !h.listing {
+					h.current = 0
+					for h.step(" ") != henkanList {
+					}
+				}
+				h.listingPrompt()
+				if h.step(" ") != henkanList || !h.has(h.current) {
+					h.listing = false
+				}
+			}
+		})
+	}
+}
+
+func TestHenkanSpecialKeys(t *testing.T) {
+	for _, tc := range []struct {
+		key    string
+		class  _KeyClass
+		action _HenkanAction
+	}{
+		{"a", keyPrintable, henkanKakuteiAndEval},
+		{"あ", keyPrintable, henkanKakuteiAndEval},
+		{string(keys.CtrlJ), keyControl, henkanKakutei},
+		{string(keys.Backspace), keyControl, henkanKakuteiAndEval},
+		{string(keys.CtrlC), keyControl, henkanInterrupt},
+		{string(keys.F5), keySequence, henkanKakuteiAndEval},
+		{"https://example.com/", keyPaste, henkanKakuteiAndInsert},
+		{"日本語", keyPaste, henkanKakuteiAndInsert},
+		{pasteStart, keyPaste, henkanKakuteiAndInsert},
+		{pasteStart + "x" + pasteEnd, keyPaste, henkanKakuteiAndInsert},
+	} {
+		if c := classifyKey(tc.key); c != tc.class {
+			t.Fatalf("classifyKey(%q)=%d, expected %d", tc.key, c, tc.class)
+		}
+		h := newHenkan([]string{"漢字", "感じ"}, DefaultSelectionKeys)
+		if action := h.step(tc.key); action != tc.action {
+			t.Fatalf("%q: action %d, expected %d", tc.key, action, tc.action)
+		}
+	}
+}
+
+func TestCharByName(t *testing.T) {
+	for source, expected := range map[string]Candidate{
+		"U+1F490":            {Text: "💐", Annotation: "BOUQUET"},
+		"u+3b":               {Text: ";", Annotation: "SEMICOLON"},
+		":bouquet:":          {Text: "💐", Annotation: "BOUQUET"},
+		":black_heart_suit:": {Text: "♥", Annotation: "BLACK HEART SUIT"},
+		":thumbs_up:":        {Text: "👍", Annotation: "THUMBS UP SIGN"},
+		":Grinning:":         {Text: "😀", Annotation: "GRINNING FACE"},
+		":tada:":             {Text: "🎉"},
+	} {
+		c, ok := charByName(source)
+		if !ok || parseCandidate(c) != expected {
+			t.Fatalf("%s: %q %v", source, c, ok)
+		}
+	}
+	for _, source := range []string{"bouquet", ":no_such_name:", "::", "U+", "U+D800", "かんじ"} {
+		if c, ok := charByName(source); ok {
+			t.Fatalf("%s: %q", source, c)
+		}
+	}
+	M := New()
+	M.User[":tada:"] = []string{"祝"}
+	if list, ok := M.lookup(":tada:"); !ok || list[0] != "祝" {
+		t.Fatalf("the dictionary is not preferred: %q", list)
+	}
+}
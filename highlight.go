@@ -0,0 +1,147 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	rl "github.com/nyaosorg/go-readline-ny"
+)
+
+// Region returns the range of the cells [start,end) being converted
+// in the editor X belongs to, and the state of the conversion:
+// StateMarkerWhite or StateMarkerBlack. The range starts with the marker
+// and ends at the cursor. When there is no conversion, ok is false.
+func (M *Mode) Region(X any) (start, end int, state State, ok bool) {
+	B := M.stateOf(X).buffer
+	if B == nil {
+		return 0, 0, 0, false
+	}
+	start = M.seekMarker(surfaceOf(B))
+	if start < 0 {
+		return 0, 0, 0, false
+	}
+	state = StateMarkerWhite
+	if B.Buffer[start].String() == M.black() {
+		state = StateMarkerBlack
+	}
+	return start, B.Cursor, state, true
+}
+
+// Coloring is readline.Coloring which paints the region being converted
+// over the colors of the host's Coloring.
+// Set it to readline.Editor.Coloring made by Mode.Coloring.
+type Coloring struct {
+	// Base is the coloring of the host application. It may be nil.
+	Base rl.Coloring
+	// White and Black are the colors of the region after ▽ and ▼.
+	White rl.ColorSequence
+	Black rl.ColorSequence
+
+	mode   *Mode
+	editor *rl.Editor
+	index  int
+	start  int
+	end    int
+	color  rl.ColorSequence
+}
+
+// Coloring returns the coloring for editor which paints the region being
+// converted with underline(▽) or reverse(▼) over base.
+// base may be nil.
+func (M *Mode) Coloring(editor *rl.Editor, base rl.Coloring) *Coloring {
+	return &Coloring{
+		Base:   base,
+		White:  rl.SGR2(39, 4),
+		Black:  rl.SGR2(39, 7),
+		mode:   M,
+		editor: editor,
+	}
+}
+
+// Init is called by go-readline-ny before painting the line.
+func (C *Coloring) Init() rl.ColorSequence {
+	C.index = 0
+	C.start, C.end = -1, -1
+	if start, end, state, ok := C.mode.Region(C.editor); ok {
+		C.start, C.end = start, end
+		if state == StateMarkerBlack {
+			C.color = C.Black
+		} else {
+			C.color = C.White
+		}
+	}
+	if C.Base != nil {
+		return C.Base.Init()
+	}
+	return rl.DefaultForeGroundColor
+}
+
+// Next is called by go-readline-ny for each character of the line.
+func (C *Coloring) Next(r rune) rl.ColorSequence {
+	color := rl.DefaultForeGroundColor
+	if C.Base != nil {
+		color = C.Base.Next(r)
+	}
+	i := C.index
+	C.index++
+	if i == C.start {
+		// 古いバッファの位置でないことを確かめる
+		if m, _ := utf8.DecodeRuneInString(C.mode.white()); r != m {
+			if m, _ := utf8.DecodeRuneInString(C.mode.black()); r != m {
+				C.start, C.end = -1, -1
+			}
+		}
+	}
+	if C.start <= i && i < C.end {
+		return C.color
+	}
+	if i == C.end && C.start >= 0 {
+		// 下線や反転を解除してから元の色に戻す
+		return withReset(color)
+	}
+	return color
+}
+
+// withReset returns the color sequence which resets all attributes
+// before setting c. The parameters of c are taken from the escape
+// sequence it writes, and ColorReset is returned when they do not fit
+// in SGR4 with the reset.
+func withReset(c rl.ColorSequence) rl.ColorSequence {
+	var buffer strings.Builder
+	c.WriteTo(&buffer)
+	s := strings.TrimSuffix(strings.TrimPrefix(buffer.String(), "\x1B["), "m")
+	var p []int
+	for _, f := range strings.Split(s, ";") {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return rl.ColorReset
+		}
+		p = append(p, n)
+	}
+	switch len(p) {
+	case 1:
+		return rl.SGR2(0, p[0])
+	case 2:
+		return rl.SGR3(0, p[0], p[1])
+	case 3:
+		return rl.SGR4(0, p[0], p[1], p[2])
+	}
+	return rl.ColorReset
+}
+
+// SuppressPrediction wraps predict, the function of the host application
+// which returns the predicted text (ghost text) shown after the line,
+// so that nothing is predicted while the reading or the candidate is
+// pending after ▽ or ▼. The prediction for the line with the markers
+// would be wrong and would be drawn over the region being converted.
+func (M *Mode) SuppressPrediction(predict func(B *rl.Buffer) string) func(B *rl.Buffer) string {
+	return func(B *rl.Buffer) string {
+		if M.seekMarker(surfaceOf(B)) >= 0 {
+			return ""
+		}
+		return predict(B)
+	}
+}
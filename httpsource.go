@@ -0,0 +1,156 @@
+package skk
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultHTTPTimeout is the limit of a lookup by HTTPSource
+// when its Timeout is zero.
+const defaultHTTPTimeout = 3 * time.Second
+
+// HTTPSource is CandidateSource which posts the reading to an HTTP endpoint,
+// so that organizations can serve their terminology dictionaries centrally.
+// The request body is {"reading":"..."} and the response body is
+// {"candidates":["...",...]} or a JSON array of the candidates.
+// The results are cached for CacheTTL.
+type HTTPSource struct {
+	// URL is the endpoint.
+	URL string
+	// Client is used for the requests. When it is nil, http.DefaultClient is used.
+	Client *http.Client
+	// Header is added to the requests, such as Authorization.
+	Header http.Header
+	// Token is sent as "Authorization: Bearer Token" when it is not empty.
+	Token string
+	// TLSConfig is used for https when Client is nil, such as the one
+	// made by NewTLSConfig to trust a private CA.
+	TLSConfig *tls.Config
+	// Timeout is the limit of a lookup. When it is zero, 3 seconds is used.
+	Timeout time.Duration
+	// CacheTTL is the time to keep the results including "not found".
+	// When it is zero, the results are not cached.
+	CacheTTL time.Duration
+	// Logger receives the errors of the requests. It may be nil.
+	Logger Logger
+
+	cache      map[string]httpCacheEntry
+	cacheMutex sync.Mutex
+	tlsClient  *http.Client
+	tlsOnce    sync.Once
+}
+
+type httpCacheEntry struct {
+	list    []string
+	expires time.Time
+}
+
+type httpRequest struct {
+	Reading string `json:"reading"`
+}
+
+type httpResponse struct {
+	Candidates []string `json:"candidates"`
+}
+
+// Lookup returns the candidates for source from the cache or the endpoint.
+func (h *HTTPSource) Lookup(source string) ([]string, bool) {
+	return h.LookupContext(context.Background(), source)
+}
+
+// LookupContext is Lookup which is canceled with ctx.
+func (h *HTTPSource) LookupContext(ctx context.Context, source string) ([]string, bool) {
+	if h.CacheTTL > 0 {
+		h.cacheMutex.Lock()
+		entry, ok := h.cache[source]
+		h.cacheMutex.Unlock()
+		if ok && time.Now().Before(entry.expires) {
+			return entry.list, len(entry.list) > 0
+		}
+	}
+	list, err := h.request(ctx, source)
+	if err != nil {
+		if h.Logger != nil {
+			h.Logger.Printf("%s %q: %v", h.URL, source, err)
+		}
+		return nil, false
+	}
+	if h.CacheTTL > 0 {
+		h.cacheMutex.Lock()
+		if h.cache == nil {
+			h.cache = map[string]httpCacheEntry{}
+		}
+		h.cache[source] = httpCacheEntry{list: list, expires: time.Now().Add(h.CacheTTL)}
+		h.cacheMutex.Unlock()
+	}
+	return list, len(list) > 0
+}
+
+func (h *HTTPSource) client() *http.Client {
+	if h.Client != nil {
+		return h.Client
+	}
+	if h.TLSConfig == nil {
+		return http.DefaultClient
+	}
+	h.tlsOnce.Do(func() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = h.TLSConfig
+		h.tlsClient = &http.Client{Transport: transport}
+	})
+	return h.tlsClient
+}
+
+func (h *HTTPSource) request(ctx context.Context, source string) ([]string, error) {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	body, err := json.Marshal(httpRequest{Reading: source})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range h.Header {
+		req.Header[key] = values
+	}
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list, nil
+	}
+	var r httpResponse
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return nil, err
+	}
+	return r.Candidates, nil
+}
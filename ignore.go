@@ -0,0 +1,100 @@
+package skk
+
+import (
+	"iter"
+	"slices"
+	"strings"
+)
+
+// ignoreDicWordPrefix is the start of the candidate of the user dictionary
+// written by the purge of a candidate of the system dictionary such as
+// `(skk-ignore-dic-word "漢字")`. It hides the words from the dictionaries
+// after the user dictionary as ddskk does.
+const ignoreDicWordPrefix = `(skk-ignore-dic-word `
+
+// isIgnoreDicWord reports whether the candidate is skk-ignore-dic-word.
+func isIgnoreDicWord(candidate string) bool {
+	return strings.HasPrefix(candidate, ignoreDicWordPrefix)
+}
+
+// ignoreDicWord returns the candidate skk-ignore-dic-word hiding words.
+func ignoreDicWord(words []string) string {
+	var buffer strings.Builder
+	buffer.WriteString(ignoreDicWordPrefix[:len(ignoreDicWordPrefix)-1])
+	for _, word := range words {
+		buffer.WriteByte(' ')
+		buffer.WriteString(quoteLisp(word))
+	}
+	buffer.WriteByte(')')
+	return buffer.String()
+}
+
+// ignoredWords returns the words hidden by the skk-ignore-dic-word in list.
+func ignoredWords(list []string) []string {
+	var words []string
+	for _, candidate := range list {
+		if isIgnoreDicWord(candidate) {
+			if w, ok := parseLispStrings(candidate[len(ignoreDicWordPrefix):]); ok {
+				words = append(words, w...)
+			}
+		}
+	}
+	return words
+}
+
+// withIgnoredWord returns a new list with word added to
+// the skk-ignore-dic-word of list, which is put at the end.
+func withIgnoredWord(list []string, word string) []string {
+	words := ignoredWords(list)
+	if !slices.Contains(words, word) {
+		words = append(words, word)
+	}
+	newList := make([]string, 0, len(list)+1)
+	for _, candidate := range list {
+		if !isIgnoreDicWord(candidate) {
+			newList = append(newList, candidate)
+		}
+	}
+	return append(newList, ignoreDicWord(words))
+}
+
+// hasIgnoreDicWord reports whether list has skk-ignore-dic-word.
+// It does not allocate for the lists without it.
+func hasIgnoreDicWord(list []string) bool {
+	for _, candidate := range list {
+		if isIgnoreDicWord(candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// isIgnored reports whether the text of candidate is in ignored.
+func isIgnored(candidate string, ignored []string) bool {
+	return len(ignored) > 0 && slices.Contains(ignored, parseCandidate(candidate).Text)
+}
+
+// dropIgnored returns list without skk-ignore-dic-word and the candidates
+// in ignored. list is returned as it is when nothing is dropped.
+func dropIgnored(list []string, ignored []string) []string {
+	if len(ignored) == 0 && !hasIgnoreDicWord(list) {
+		return list
+	}
+	return slices.DeleteFunc(slices.Clone(list), func(s string) bool {
+		return isIgnoreDicWord(s) || isIgnored(s, ignored)
+	})
+}
+
+// dropIgnoredSeq is dropIgnored for the candidates of StreamSource.
+func dropIgnoredSeq(seq iter.Seq[string], ignored []string) iter.Seq[string] {
+	if len(ignored) == 0 {
+		return seq
+	}
+	return func(yield func(string) bool) {
+		for s := range seq {
+			if !isIgnored(s, ignored) && !yield(s) {
+				return
+			}
+		}
+	}
+}
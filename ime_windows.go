@@ -0,0 +1,93 @@
+//go:build windows && imecontrol
+
+package skk
+
+// Build with `-tags imecontrol` to turn off the IME of Windows for
+// the console window while SKK is active, because the native IME fights
+// with SKK for the keys. The open status of the IME is restored
+// when SKK returns to the latin mode, when the line is accepted
+// and by Mode.Close.
+
+import (
+	"sync"
+	"syscall"
+)
+
+var (
+	imm32    = syscall.NewLazyDLL("imm32.dll")
+	user32   = syscall.NewLazyDLL("user32.dll")
+	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	procImmGetDefaultIMEWnd = imm32.NewProc("ImmGetDefaultIMEWnd")
+	procSendMessageW        = user32.NewProc("SendMessageW")
+	procGetConsoleWindow    = kernel32.NewProc("GetConsoleWindow")
+)
+
+const (
+	wmImeControl     = 0x0283
+	imcGetOpenStatus = 0x0005
+	imcSetOpenStatus = 0x0006
+)
+
+var (
+	imeMutex sync.Mutex
+	// imeSaved is the open status of the IME before SKK turned it off.
+	imeSaved    uintptr
+	imeDisabled bool
+	// imeClosers is the instances which registered restoreIME to Close.
+	imeClosers = map[*Mode]bool{}
+)
+
+// imeWindow returns the default IME window of the console or 0.
+func imeWindow() uintptr {
+	hwnd, _, _ := procGetConsoleWindow.Call()
+	if hwnd == 0 {
+		return 0
+	}
+	ime, _, _ := procImmGetDefaultIMEWnd.Call(hwnd)
+	return ime
+}
+
+func controlIME(M *Mode, s State) {
+	imeMutex.Lock()
+	defer imeMutex.Unlock()
+	if s == StateLatin {
+		restoreIME()
+		return
+	}
+	ime := imeWindow()
+	if ime == 0 {
+		return
+	}
+	if !imeDisabled {
+		imeSaved, _, _ = procSendMessageW.Call(ime, wmImeControl, imcGetOpenStatus, 0)
+		imeDisabled = true
+	}
+	procSendMessageW.Call(ime, wmImeControl, imcSetOpenStatus, 0)
+	if !imeClosers[M] {
+		imeClosers[M] = true
+		M.onClose(func() error {
+			imeMutex.Lock()
+			defer imeMutex.Unlock()
+			delete(imeClosers, M)
+			restoreIME()
+			return nil
+		})
+	}
+}
+
+// restoreIME sets the open status saved back when SKK turned it off.
+// imeMutex must be held.
+func restoreIME() {
+	if !imeDisabled {
+		return
+	}
+	if ime := imeWindow(); ime != 0 {
+		procSendMessageW.Call(ime, wmImeControl, imcSetOpenStatus, imeSaved)
+	}
+	imeDisabled = false
+}
+
+func init() {
+	modeHook = controlIME
+}
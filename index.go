@@ -0,0 +1,109 @@
+package skk
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// PrefixIndexer is the interface of dictionaries which have an index
+// for PrefixSearch. Without it, PrefixSearch scans all the entries,
+// so callers may avoid the completion on each key with a large dictionary.
+type PrefixIndexer interface {
+	HasPrefixIndex() bool
+}
+
+// HasPrefixIndex reports whether PrefixSearch of d uses an index.
+func HasPrefixIndex(d any) bool {
+	if x, ok := d.(PrefixIndexer); ok {
+		return x.HasPrefixIndex()
+	}
+	return false
+}
+
+// IndexedJisyo is Jisyo with the sorted list of the midashi,
+// so that PrefixSearch takes O(log n) instead of scanning all the entries.
+// The list is maintained by Store, Delete and Update.
+// Do not modify Jisyo directly after NewIndexedJisyo.
+type IndexedJisyo struct {
+	Jisyo
+	keys []string
+}
+
+// NewIndexedJisyo builds the index of j.
+func NewIndexedJisyo(j Jisyo) *IndexedJisyo {
+	keys := make([]string, 0, len(j))
+	for key := range j {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return &IndexedJisyo{Jisyo: j, keys: keys}
+}
+
+// HasPrefixIndex returns true.
+func (x *IndexedJisyo) HasPrefixIndex() bool {
+	return true
+}
+
+func (x *IndexedJisyo) addKey(key string) {
+	if i, found := slices.BinarySearch(x.keys, key); !found {
+		x.keys = slices.Insert(x.keys, i, key)
+	}
+}
+
+func (x *IndexedJisyo) removeKey(key string) {
+	if i, found := slices.BinarySearch(x.keys, key); found {
+		x.keys = slices.Delete(x.keys, i, i+1)
+	}
+}
+
+// Store replaces the candidates for source.
+func (x *IndexedJisyo) Store(source string, candidates []string) error {
+	x.addKey(source)
+	return x.Jisyo.Store(source, candidates)
+}
+
+// Delete removes the entry for source.
+func (x *IndexedJisyo) Delete(source string) error {
+	x.removeKey(source)
+	return x.Jisyo.Delete(source)
+}
+
+// Update replaces the candidates for source with the result of f.
+func (x *IndexedJisyo) Update(source string, f func(candidates []string, ok bool) []string) error {
+	err := x.Jisyo.Update(source, f)
+	if _, ok := x.Jisyo[source]; ok {
+		x.addKey(source)
+	} else {
+		x.removeKey(source)
+	}
+	return err
+}
+
+// PrefixSearch returns the sorted midashi starting with prefix.
+func (x *IndexedJisyo) PrefixSearch(prefix string) []string {
+	start, _ := slices.BinarySearch(x.keys, prefix)
+	end := start
+	for end < len(x.keys) && strings.HasPrefix(x.keys[end], prefix) {
+		end++
+	}
+	if start == end {
+		return nil
+	}
+	return slices.Clone(x.keys[start:end])
+}
+
+// Complete is the same as PrefixSearch.
+func (x *IndexedJisyo) Complete(prefix string) []string {
+	return x.PrefixSearch(prefix)
+}
+
+// WithPrefixIndex makes the system dictionary IndexedJisyo.
+// Give it after WithSystemJisyo because the index is built
+// with the entries loaded at that time.
+func WithPrefixIndex() Option {
+	return func(M *Mode) error {
+		M.SystemDictionary = NewIndexedJisyo(M.System)
+		return nil
+	}
+}
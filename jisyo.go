@@ -3,11 +3,14 @@ package skk
 import (
 	"bufio"
 	"io"
+	"iter"
+	"maps"
 	"os"
 	"os/user"
 	"regexp"
 	"strings"
 	"unicode/utf8"
+	"unique"
 
 	"golang.org/x/text/encoding/japanese"
 )
@@ -32,14 +35,85 @@ func expandEnv(s string) string {
 	})
 }
 
+// LoadProgress is the progress of loading a dictionary.
+type LoadProgress struct {
+	// Bytes is the size of the source read so far.
+	Bytes int64
+	// Total is the size of the whole source. It is zero when unknown.
+	Total int64
+	// Entries is the count of the entries parsed so far.
+	Entries int
+	// Skipped is the count of the malformed lines skipped so far,
+	// such as the truncated entries and the lines with the bytes
+	// invalid in the encoding. The comments are not counted.
+	Skipped int
+	// SkippedLines is the line numbers (from 1) of the first
+	// maxSkippedLines lines of them.
+	SkippedLines []int
+}
+
+// maxSkippedLines is the count of the line numbers of the malformed
+// lines kept in LoadProgress.
+const maxSkippedLines = 100
+
+// lineKind is the kind of a line of a dictionary.
+type lineKind int
+
+const (
+	// lineComment is a comment or an empty line.
+	lineComment lineKind = iota
+	// lineEntry is an entry such as `かんじ /漢字/感じ/`.
+	lineEntry
+	// lineMalformed is a line which is neither of them.
+	lineMalformed
+)
+
+// parseLine splits the entry line into the midashi and the text of
+// the candidates without the first `/`. A line cut before the last `/`,
+// an entry without candidates and a line with the bytes invalid in
+// the encoding, which are decoded to U+FFFD, are lineMalformed.
+func parseLine(line string) (source, lists string, kind lineKind) {
+	if len(line) <= 0 || line[0] == ';' {
+		return "", "", lineComment
+	}
+	source, lists, ok := strings.Cut(line, " /")
+	if !ok || source == "" || !strings.HasSuffix(lists, "/") || strings.Trim(lists, "/") == "" {
+		return "", "", lineMalformed
+	}
+	if strings.ContainsRune(line, utf8.RuneError) {
+		return "", "", lineMalformed
+	}
+	return source, lists, lineEntry
+}
+
+// progressInterval is the count of lines between calls of the progress callback.
+const progressInterval = 1000
+
 // Load reads the contents of an dictionary from a file as EUC-JP.
 func (j Jisyo) Load(filename string) error {
+	return j.LoadWithProgress(filename, nil)
+}
+
+// LoadWithProgress is the same as Load, but it calls progress periodically
+// while reading and once at the end.
+func (j Jisyo) LoadWithProgress(filename string, progress func(LoadProgress)) error {
+	return j.load(filename, progress, nil)
+}
+
+// load reads the dictionary filename calling seen with each midashi
+// in the order of the lines when it is not nil.
+func (j Jisyo) load(filename string, progress func(LoadProgress), seen func(string)) error {
 	fd, err := os.Open(expandEnv(filename))
 	if err != nil {
 		return err
 	}
 	defer fd.Close()
-	return j.ReadWithPragma(fd)
+	var total int64
+	if stat, err := fd.Stat(); err == nil {
+		total = stat.Size()
+	}
+	p := jisyoParser{j: j, seen: seen}
+	return scanWithPragma(fd, total, progress, p.readOne)
 }
 
 // Load reads the contents of an dictionary from io.Reader as EUC-JP
@@ -48,26 +122,71 @@ func (j Jisyo) ReadEucJp(r io.Reader) error {
 	return j.Read(decoder.Reader(r))
 }
 
-func (j Jisyo) readOne(line string) {
-	if len(line) <= 0 || line[0] == ';' {
-		return
+// arenaSize is the count of the candidates allocated at once by jisyoParser.
+const arenaSize = 4096
+
+// maxInternLength is the length in bytes of the longest candidate
+// interned on loading: three kanji in UTF-8.
+const maxInternLength = 9
+
+// jisyoParser parses the lines of a dictionary into Jisyo.
+// The slices of the candidates are cut from an arena
+// to avoid an allocation for each entry.
+type jisyoParser struct {
+	j     Jisyo
+	arena []string
+	// seen is called with the midashi of each entry when it is not nil.
+	seen func(string)
+}
+
+// alloc returns an empty slice whose capacity is n.
+func (p *jisyoParser) alloc(n int) []string {
+	if n > arenaSize/4 {
+		return make([]string, 0, n)
 	}
-	source, lists, ok := strings.Cut(line, " /")
-	if !ok {
-		return
+	if len(p.arena) < n {
+		p.arena = make([]string, arenaSize)
+	}
+	values := p.arena[:0:n]
+	p.arena = p.arena[n:]
+	return values
+}
+
+func (p *jisyoParser) readOne(line string) lineKind {
+	source, lists, kind := parseLine(line)
+	if kind != lineEntry {
+		return kind
 	}
-	values := j[source]
+	values := p.j[source]
+	if len(values) <= 0 {
+		values = p.alloc(strings.Count(lists, "/") + 1)
+	}
+	// 短い候補は辞書をまたいで重複しやすいので共有する.
+	// 全候補を共有できた行は見出しを複製し、行自体を解放できるようにする
+	shared := true
 	for {
 		one, rest, ok := strings.Cut(lists, "/")
-		if one != "" {
+		one = decodeCandidate(one)
+		if len(one) > maxInternLength {
 			values = append(values, one)
+			shared = false
+		} else if one != "" {
+			values = append(values, unique.Make(one).Value())
 		}
 		if !ok {
 			break
 		}
 		lists = rest
 	}
-	j[source] = values
+	if shared {
+		source = strings.Clone(source)
+	}
+	// 共有されている配列に追記しないよう容量を切り詰める
+	p.j[source] = values[:len(values):len(values)]
+	if p.seen != nil {
+		p.seen(source)
+	}
+	return lineEntry
 }
 
 func pragma(line string) map[string]string {
@@ -90,40 +209,103 @@ func pragma(line string) map[string]string {
 	return m
 }
 
-// Load reads the contents of an dictionary from io.Reader as UTF8
+// Load reads the contents of an dictionary from io.Reader as UTF8.
+// The malformed lines are skipped.
 func (j Jisyo) Read(r io.Reader) error {
-	sc := bufio.NewScanner(r)
+	p := jisyoParser{j: j}
+	sc := newJisyoScanner(r)
 	for sc.Scan() {
-		line := sc.Text()
-		j.readOne(line)
+		p.readOne(sc.Text())
 	}
 	return sc.Err()
 }
 
-func (j Jisyo) ReadWithPragma(r io.Reader) error {
+// newJisyoScanner returns bufio.Scanner with a buffer large enough
+// for the long lines of the large dictionaries.
+func newJisyoScanner(r io.Reader) *bufio.Scanner {
 	sc := bufio.NewScanner(r)
-	decoder := japanese.EUCJP.NewDecoder()
-	f := func(s string) string {
-		if utf8, err := decoder.String(s); err == nil {
-			return utf8
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	return sc
+}
+
+// byteCounter counts the bytes read through it.
+type byteCounter struct {
+	r io.Reader
+	n int64
+}
+
+func (c *byteCounter) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// ReadWithPragma reads the contents of an dictionary from io.Reader.
+// The encoding is UTF8 when the first line has the pragma `-*- coding: utf-8 -*-`,
+// otherwise EUC-JP.
+func (j Jisyo) ReadWithPragma(r io.Reader) error {
+	return j.readWithPragma(r, 0, nil)
+}
+
+// ReadWithProgress is the same as ReadWithPragma, but it calls progress
+// periodically while reading and once at the end.
+func (j Jisyo) ReadWithProgress(r io.Reader, progress func(LoadProgress)) error {
+	return j.readWithPragma(r, 0, progress)
+}
+
+func (j Jisyo) readWithPragma(r io.Reader, total int64, progress func(LoadProgress)) error {
+	p := jisyoParser{j: j}
+	return scanWithPragma(r, total, progress, p.readOne)
+}
+
+// scanWithPragma calls readOne with each line of the dictionary r
+// decoded by the encoding of the pragma. readOne returns the kind of
+// the line, and the malformed lines are counted in the progress.
+func scanWithPragma(r io.Reader, total int64, progress func(LoadProgress), readOne func(string) lineKind) error {
+	counter := &byteCounter{r: r}
+	br := bufio.NewReaderSize(counter, 64*1024)
+
+	// 先頭行のプラグマで文字コードを決め、以降はまとめてデコードする
+	first, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	first = strings.TrimRight(first, "\r\n")
+	var src io.Reader = br
+	if m := pragma(first); !strings.HasPrefix(first, ";") || m == nil || m["coding"] != "utf-8" {
+		decoder := japanese.EUCJP.NewDecoder()
+		if utf8, err := decoder.String(first); err == nil {
+			first = utf8
 		}
-		return s
-	}
-	if sc.Scan() {
-		line := f(sc.Text())
-		if len(line) > 0 && line[0] == ';' {
-			if m := pragma(line[1:]); m != nil && m["coding"] == "utf-8" {
-				f = func(s string) string {
-					return s
-				}
+		src = decoder.Reader(br)
+	}
+	lp := LoadProgress{Total: total}
+	lines := 1
+	count := func(kind lineKind) {
+		switch kind {
+		case lineEntry:
+			lp.Entries++
+		case lineMalformed:
+			// 壊れた行は読み飛ばして行番号を報告する
+			lp.Skipped++
+			if len(lp.SkippedLines) < maxSkippedLines {
+				lp.SkippedLines = append(lp.SkippedLines, lines)
 			}
-		} else {
-			j.readOne(line)
 		}
 	}
-
+	count(readOne(first))
+	sc := newJisyoScanner(src)
 	for sc.Scan() {
-		j.readOne(f(sc.Text()))
+		lines++
+		count(readOne(sc.Text()))
+		if progress != nil && lines%progressInterval == 0 {
+			lp.Bytes = counter.n - int64(br.Buffered())
+			progress(lp)
+		}
+	}
+	if progress != nil {
+		lp.Bytes = counter.n
+		progress(lp)
 	}
 	return sc.Err()
 }
@@ -155,7 +337,7 @@ func dumpPair(key string, list []string, w io.Writer) (n int64, err error) {
 		return wc.Result()
 	}
 	for _, candidate := range list {
-		if wc.Try(io.WriteString(w, candidate)) || wc.Try(io.WriteString(w, "/")) {
+		if wc.Try(io.WriteString(w, encodeCandidate(candidate))) || wc.Try(io.WriteString(w, "/")) {
 			return wc.Result()
 		}
 	}
@@ -165,13 +347,19 @@ func dumpPair(key string, list []string, w io.Writer) (n int64, err error) {
 
 // WriteTo outputs the contents of dictonary with UTF8
 func (j Jisyo) WriteTo(w io.Writer) (n int64, err error) {
+	return j.writeInOrder(w, maps.Keys(j))
+}
+
+// writeInOrder outputs the entries of keys in the order of keys
+// into the sections of okuri-ari and okuri-nasi.
+func (j Jisyo) writeInOrder(w io.Writer, keys iter.Seq[string]) (n int64, err error) {
 	var wc writeCounter
 	if wc.Try(io.WriteString(w, ";; okuri-ari entries.\n")) {
 		return wc.Result()
 	}
-	for key, list := range j {
-		if r, _ := utf8.DecodeLastRuneInString(key); 'a' <= r && r <= 'z' {
-			if wc.Try64(dumpPair(key, list, w)) {
+	for key := range keys {
+		if isOkuriAri(key) {
+			if wc.Try64(dumpPair(key, j[key], w)) {
 				return wc.Result()
 			}
 		}
@@ -179,9 +367,9 @@ func (j Jisyo) WriteTo(w io.Writer) (n int64, err error) {
 	if wc.Try(io.WriteString(w, "\n;; okuri-nasi entries.\n")) {
 		return wc.Result()
 	}
-	for key, list := range j {
-		if r, _ := utf8.DecodeLastRuneInString(key); r < 'a' || 'z' < r {
-			if wc.Try64(dumpPair(key, list, w)) {
+	for key := range keys {
+		if !isOkuriAri(key) {
+			if wc.Try64(dumpPair(key, j[key], w)) {
 				return wc.Result()
 			}
 		}
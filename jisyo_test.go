@@ -0,0 +1,418 @@
+package skk
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestReadWithProgress(t *testing.T) {
+	source := ";; -*- coding: utf-8 -*-\nかんじ /漢字/感じ/\nあい /愛/\n"
+	var last LoadProgress
+	calls := 0
+	jisyo := Jisyo{}
+	err := jisyo.ReadWithProgress(strings.NewReader(source), func(p LoadProgress) {
+		last = p
+		calls++
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if calls != 1 {
+		t.Fatalf("progress was called %d times", calls)
+	}
+	if last.Entries != 2 {
+		t.Fatalf("Entries=%d", last.Entries)
+	}
+	if last.Bytes != int64(len(source)) {
+		t.Fatalf("Bytes=%d (expected %d)", last.Bytes, len(source))
+	}
+	if list := jisyo["かんじ"]; len(list) != 2 || list[1] != "感じ" {
+		t.Fatalf("かんじ=%v", list)
+	}
+}
+
+func TestReadMalformed(t *testing.T) {
+	source := strings.Join([]string{
+		";; -*- coding: utf-8 -*-",
+		"",
+		"かんじ /漢字/",
+		"かんじ",
+		"あい /愛/哀",
+		"こわれ /\xff/",
+		"から //",
+		"かんじ /感じ/",
+	}, "\n") + "\n"
+	var last LoadProgress
+	jisyo := Jisyo{}
+	err := jisyo.ReadWithProgress(strings.NewReader(source), func(p LoadProgress) { last = p })
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if last.Entries != 2 || last.Skipped != 4 || !slices.Equal(last.SkippedLines, []int{4, 5, 6, 7}) {
+		t.Fatalf("%+v", last)
+	}
+	if len(jisyo) != 1 || !slices.Equal(jisyo["かんじ"], []string{"漢字", "感じ"}) {
+		t.Fatalf("%q", jisyo)
+	}
+	z := NewLazyJisyo()
+	if err := z.ReadWithPragma(strings.NewReader(source)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if keys := z.PrefixSearch(""); !slices.Equal(keys, []string{"かんじ"}) {
+		t.Fatalf("%q", keys)
+	}
+}
+
+func TestJisyoAll(t *testing.T) {
+	j := Jisyo{
+		"かんじ": {"漢字", "感じ;feeling"},
+		"かk":  {"書"},
+		"あい":  {"愛"},
+	}
+	var keys []string
+	for key, candidates := range j.All() {
+		keys = append(keys, key)
+		if key == "かんじ" && candidates[1] != (Candidate{Text: "感じ", Annotation: "feeling"}) {
+			t.Fatalf("%#v", candidates)
+		}
+	}
+	if s := strings.Join(keys, " "); s != "あい かk かんじ" {
+		t.Fatalf("All: %s", s)
+	}
+	keys = keys[:0]
+	for key := range j.OkuriAri() {
+		keys = append(keys, key)
+	}
+	if s := strings.Join(keys, " "); s != "かk" {
+		t.Fatalf("OkuriAri: %s", s)
+	}
+	keys = keys[:0]
+	for key := range j.WithPrefix("か") {
+		keys = append(keys, key)
+	}
+	if s := strings.Join(keys, " "); s != "かk かんじ" {
+		t.Fatalf("WithPrefix: %s", s)
+	}
+}
+
+func TestReadEucJp(t *testing.T) {
+	source, err := japanese.EUCJP.NewEncoder().String(";; okuri-nasi entries.\r\nかんじ /漢字/感じ/\r\nあい /愛/\r\nかんじ /幹事/\r\n")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	jisyo := Jisyo{}
+	if err := jisyo.ReadWithPragma(strings.NewReader(source)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if list := jisyo["かんじ"]; len(list) != 3 || list[2] != "幹事" {
+		t.Fatalf("かんじ=%v", list)
+	}
+	if list := jisyo["あい"]; len(list) != 1 || cap(list) != 1 {
+		t.Fatalf("あい=%v (cap %d)", list, cap(list))
+	}
+}
+
+// benchmarkJisyo returns a dictionary in EUC-JP as large as SKK-JISYO.L.
+func benchmarkJisyo(b *testing.B) []byte {
+	var buffer strings.Builder
+	buffer.WriteString(";; -*- coding: euc-jp -*-\n")
+	kana := []rune("あいうえおかきくけこさしすせそたちつてとなにぬねの")
+	kanji := []rune("亜唖娃阿哀愛挨姶逢葵茜穐悪握渥旭葦芦鯵梓圧斡扱宛姐虻飴絢綾鮎或粟袷安庵按暗案闇")
+	for i := 0; i < 170000; i++ {
+		n := i
+		for j := 0; j < 4; j++ {
+			buffer.WriteRune(kana[n%len(kana)])
+			n /= len(kana)
+		}
+		buffer.WriteString(" /")
+		for j := 0; j <= i%5; j++ {
+			buffer.WriteRune(kanji[(i+j)%len(kanji)])
+			buffer.WriteRune(kanji[(i*7+j)%len(kanji)])
+			buffer.WriteString("/")
+		}
+		buffer.WriteString("\n")
+	}
+	source, err := japanese.EUCJP.NewEncoder().String(buffer.String())
+	if err != nil {
+		b.Fatal(err.Error())
+	}
+	return []byte(source)
+}
+
+func BenchmarkReadWithPragma(b *testing.B) {
+	source := benchmarkJisyo(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		jisyo := Jisyo{}
+		if err := jisyo.ReadWithPragma(bytes.NewReader(source)); err != nil {
+			b.Fatal(err.Error())
+		}
+	}
+}
+
+func TestIndexedJisyo(t *testing.T) {
+	x := NewIndexedJisyo(Jisyo{
+		"かんじ":  {"漢字"},
+		"かんじゃ": {"患者"},
+		"かk":   {"書"},
+		"あい":   {"愛"},
+	})
+	if !HasPrefixIndex(x) || HasPrefixIndex(x.Jisyo) {
+		t.Fatal("HasPrefixIndex")
+	}
+	if s := strings.Join(x.PrefixSearch("かん"), " "); s != "かんじ かんじゃ" {
+		t.Fatalf("PrefixSearch: %s", s)
+	}
+	x.Store("かんき", []string{"換気"})
+	x.Delete("かんじゃ")
+	x.Update("かんじょう", func([]string, bool) []string { return []string{"感情"} })
+	x.Update("かんじ", func([]string, bool) []string { return nil })
+	if s := strings.Join(x.PrefixSearch("かん"), " "); s != "かんき かんじょう" {
+		t.Fatalf("PrefixSearch after the updates: %s", s)
+	}
+	if list := x.PrefixSearch("さ"); list != nil {
+		t.Fatalf("PrefixSearch: %v", list)
+	}
+	if !HasPrefixIndex(NewSyncDictionary(x)) {
+		t.Fatal("HasPrefixIndex of SyncDictionary")
+	}
+}
+
+func TestLoadCached(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	fname := filepath.Join(t.TempDir(), "SKK-JISYO.S")
+	if err := os.WriteFile(fname, []byte(";; -*- coding: utf-8 -*-\nかんじ /漢字/感じ/\nあい /愛/\n"), 0666); err != nil {
+		t.Fatal(err.Error())
+	}
+	for i := 0; i < 2; i++ {
+		jisyo := Jisyo{"かんじ": {"幹事"}}
+		if err := jisyo.LoadCached(fname); err != nil {
+			t.Fatal(err.Error())
+		}
+		if list := jisyo["かんじ"]; len(list) != 3 || list[2] != "感じ" || len(jisyo["あい"]) != 1 {
+			t.Fatalf("%d: %v", i, jisyo)
+		}
+	}
+	if _, err := os.Stat(fname + ".cache"); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// 辞書が更新されたらキャッシュは使わない
+	future := time.Now().Add(time.Hour)
+	os.WriteFile(fname, []byte(";; -*- coding: utf-8 -*-\nかんじ /漢字/\n"), 0666)
+	os.Chtimes(fname, future, future)
+	jisyo := Jisyo{}
+	if err := jisyo.LoadCached(fname); err != nil {
+		t.Fatal(err.Error())
+	}
+	if list := jisyo["かんじ"]; len(list) != 1 || len(jisyo) != 1 {
+		t.Fatalf("after the update: %v", jisyo)
+	}
+
+	// 壊れたキャッシュは使わない
+	data, _ := os.ReadFile(fname + ".cache")
+	os.WriteFile(fname+".cache", data[:len(data)-3], 0666)
+	jisyo = Jisyo{}
+	if err := jisyo.LoadCached(fname); err != nil {
+		t.Fatal(err.Error())
+	}
+	if list := jisyo["かんじ"]; len(list) != 1 || len(jisyo) != 1 {
+		t.Fatalf("broken cache: %v", jisyo)
+	}
+}
+
+func BenchmarkLoadCached(b *testing.B) {
+	b.Setenv("XDG_CACHE_HOME", b.TempDir())
+	fname := filepath.Join(b.TempDir(), "SKK-JISYO.L")
+	if err := os.WriteFile(fname, benchmarkJisyo(b), 0666); err != nil {
+		b.Fatal(err.Error())
+	}
+	if err := (Jisyo{}).LoadCached(fname); err != nil {
+		b.Fatal(err.Error())
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := (Jisyo{}).LoadCached(fname); err != nil {
+			b.Fatal(err.Error())
+		}
+	}
+}
+
+func TestMappedJisyo(t *testing.T) {
+	j := Jisyo{
+		"かんじ":  {"漢字", "感じ;feeling"},
+		"かんじゃ": {"患者"},
+		"かk":   {"書"},
+		"あい":   {"愛"},
+	}
+	var buffer bytes.Buffer
+	j.WriteSortedTo(&buffer)
+	eucjp, err := japanese.EUCJP.NewEncoder().Bytes(bytes.Replace(buffer.Bytes(), []byte("utf-8"), []byte("euc-jp"), 1))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{"utf-8": buffer.Bytes(), "euc-jp": eucjp} {
+		fname := filepath.Join(dir, name)
+		os.WriteFile(fname, data, 0666)
+		m, err := OpenMappedJisyo(fname)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		for source, expected := range j {
+			if list, ok := m.Lookup(source); !ok || strings.Join(list, "/") != strings.Join(expected, "/") {
+				t.Fatalf("%s: %s: %v %v", name, source, list, ok)
+			}
+		}
+		for _, source := range []string{"あ", "かん", "ん", ""} {
+			if list, ok := m.Lookup(source); ok {
+				t.Fatalf("%s: %s: %v", name, source, list)
+			}
+		}
+		if s := strings.Join(m.Complete("かん"), " "); s != "かんじ かんじゃ" {
+			t.Fatalf("%s: Complete: %s", name, s)
+		}
+		if err := m.Close(); err != nil {
+			t.Fatal(err.Error())
+		}
+		if list, ok := m.Lookup("かんじ"); ok {
+			t.Fatalf("%s: Lookup after Close: %v", name, list)
+		}
+	}
+}
+
+func TestIntern(t *testing.T) {
+	j1 := Jisyo{}
+	j2 := Jisyo{}
+	j1.Read(strings.NewReader("かん /缶/巻/\n"))
+	j2.Read(strings.NewReader("かん /缶/間/\nまき /巻/\n"))
+	if unsafe.StringData(j1["かん"][0]) != unsafe.StringData(j2["かん"][0]) ||
+		unsafe.StringData(j1["かん"][1]) != unsafe.StringData(j2["まき"][0]) {
+		t.Fatal("the candidates are not shared")
+	}
+}
+
+func TestLazyJisyo(t *testing.T) {
+	source := ";; -*- coding: utf-8 -*-\nかんじ /漢字/感じ;feeling/\nあい /愛/\nかんじ /幹事/\n"
+	z := NewLazyJisyo()
+	if err := z.ReadWithPragma(strings.NewReader(source)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if entries, parsed := z.Len(); entries != 2 || parsed != 0 {
+		t.Fatalf("Len()=%d,%d", entries, parsed)
+	}
+	list, ok := z.Lookup("かんじ")
+	if !ok || strings.Join(list, "/") != "漢字/感じ;feeling/幹事" {
+		t.Fatalf("Lookup: %v %v", list, ok)
+	}
+	if entries, parsed := z.Len(); entries != 2 || parsed != 1 {
+		t.Fatalf("Len()=%d,%d after Lookup", entries, parsed)
+	}
+	if again, _ := z.Lookup("かんじ"); &again[0] != &list[0] {
+		t.Fatal("the entry was split again")
+	}
+	candidates, ok := z.LookupCandidates("かんじ")
+	if !ok || candidates[1] != (Candidate{Text: "感じ", Annotation: "feeling"}) {
+		t.Fatalf("LookupCandidates: %#v", candidates)
+	}
+	if err := z.ReadWithPragma(strings.NewReader(";; -*- coding: utf-8 -*-\nかんじ /監事/\n")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if list, _ := z.Lookup("かんじ"); len(list) != 4 || list[3] != "監事" {
+		t.Fatalf("appended: %v", list)
+	}
+	if s := strings.Join(z.Complete("か"), " "); s != "かんじ" {
+		t.Fatalf("Complete: %s", s)
+	}
+	z.Delete("あい")
+	if _, ok := z.Lookup("あい"); ok {
+		t.Fatal("Delete failed")
+	}
+}
+
+func BenchmarkLazyJisyo(b *testing.B) {
+	source := benchmarkJisyo(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		z := NewLazyJisyo()
+		if err := z.ReadWithPragma(bytes.NewReader(source)); err != nil {
+			b.Fatal(err.Error())
+		}
+	}
+}
+
+func TestConcat(t *testing.T) {
+	j := Jisyo{
+		"ほーむ": {"~/home", "a/b;path/name", `"q"\`},
+		"せみ":  {`(concat "a\073b")`},
+		"むし":  {ignoreDicWord([]string{"a/b", "c;d"})},
+		"くぎり": {"あ\nい", "う;え\rお"},
+	}
+	var buffer strings.Builder
+	if _, err := j.WriteTo(&buffer); err != nil {
+		t.Fatal(err.Error())
+	}
+	text := buffer.String()
+	for _, expected := range []string{
+		`ほーむ /(concat "~\057home")/(concat "a\057b");(concat "path\057name")/"q"\/`,
+		`せみ /(concat "a\073b")/`,
+		`くぎり /(concat "あ\012い")/う;(concat "え\015お")/`,
+	} {
+		if !strings.Contains(text, expected) {
+			t.Fatalf("%q does not contain %q", text, expected)
+		}
+	}
+	for _, loaded := range []Dictionary{Jisyo{}, NewLazyJisyo()} {
+		var err error
+		switch d := loaded.(type) {
+		case Jisyo:
+			err = d.Read(strings.NewReader(text))
+		case *LazyJisyo:
+			err = d.ReadWithPragma(strings.NewReader(";; -*- coding: utf-8 -*-\n" + text))
+		}
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		for source, list := range j {
+			if got, _ := loaded.Lookup(source); !slices.Equal(got, list) {
+				t.Fatalf("%T %s: %q expected %q", loaded, source, got, list)
+			}
+		}
+	}
+	if s, ok := decodeConcat(`(concat "a" "\57b\"" "\\")`); !ok || s != `a/b"\` {
+		t.Fatalf("%q %v", s, ok)
+	}
+	if s := escapeCandidate("あ\nい"); s != `(concat "あ\012い")` {
+		t.Fatalf("%q", s)
+	}
+	for _, c := range []Candidate{{"a;b", ""}, {"a;b/c", "x;y"}, {"abc", "x"}, {"a\nb", "c\rd"}} {
+		var buffer strings.Builder
+		if _, err := (Jisyo{"え": {c.String()}}).WriteTo(&buffer); err != nil {
+			t.Fatal(err.Error())
+		}
+		j := Jisyo{}
+		j.Read(strings.NewReader(buffer.String()))
+		if got := parseCandidate(j["え"][0]); got != c {
+			t.Fatalf("%q: %#v expected %#v", buffer.String(), got, c)
+		}
+	}
+	if words := ignoredWords(j["むし"]); !slices.Equal(words, []string{"a/b", "c;d"}) {
+		t.Fatalf("%q", words)
+	}
+	for _, s := range []string{`(concat "a`, `(concat a)`, `(concat "a" b)`} {
+		if _, ok := decodeConcat(s); ok {
+			t.Fatalf("%q is decoded", s)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	rl "github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+// choose shows items with the selection keys and returns the index chosen.
+// It returns -1 when canceled.
+func (M *Mode) choose(ctx context.Context, B *rl.Buffer, items []string) (int, error) {
+	sk := M.selectionKeys()
+	selectKeys := []rune(sk.Select)
+	current := 0
+	for {
+		var buffer strings.Builder
+		_current := current
+		for _, key := range selectKeys {
+			if _current >= len(items) {
+				break
+			}
+			fmt.Fprintf(&buffer, "%c:%s ", unicode.ToUpper(key), items[_current])
+			_current++
+		}
+		fmt.Fprintf(&buffer, "[残り %d]", len(items)-_current)
+		key, err := M.ask1(ctx, B, buffer.String())
+		if err != nil {
+			return -1, err
+		}
+		if index := indexRune(selectKeys, key); index >= 0 && current+index < _current {
+			return current + index, nil
+		} else if sk.NextPage.has(key) {
+			if _current < len(items) {
+				current = _current
+			}
+		} else if sk.PrevPage.has(key) {
+			current -= len(selectKeys)
+			if current < 0 {
+				current = 0
+			}
+		} else if sk.Cancel.has(key) {
+			return -1, nil
+		}
+	}
+}
+
+// editEntry edits the candidates of one entry of the user dictionary.
+// It returns true when the candidates are changed.
+func (M *Mode) editEntry(ctx context.Context, B *rl.Buffer, source string) (bool, error) {
+	original, _ := M.user().Lookup(source)
+	list := append([]string{}, original...)
+	changed := false
+	current := 0
+	for {
+		var buffer strings.Builder
+		buffer.WriteString(source)
+		buffer.WriteString(" /")
+		for i, candidate := range list {
+			if i == current {
+				fmt.Fprintf(&buffer, "[%s]/", candidate)
+			} else {
+				fmt.Fprintf(&buffer, "%s/", candidate)
+			}
+		}
+		buffer.WriteString(" (d:削除 k:前へ j:後へ C-g:終了)")
+		key, err := M.ask1(ctx, B, buffer.String())
+		if err != nil {
+			return false, err
+		}
+		switch key {
+		case " ", string(keys.CtrlN), string(keys.CtrlF):
+			if current+1 < len(list) {
+				current++
+			}
+		case "x", string(keys.CtrlP), string(keys.CtrlB):
+			if current > 0 {
+				current--
+			}
+		case "d":
+			if len(list) > 0 {
+				copy(list[current:], list[current+1:])
+				list = list[:len(list)-1]
+				if current >= len(list) && current > 0 {
+					current--
+				}
+				changed = true
+			}
+		case "k":
+			if current > 0 {
+				list[current-1], list[current] = list[current], list[current-1]
+				current--
+				changed = true
+			}
+		case "j":
+			if current+1 < len(list) {
+				list[current+1], list[current] = list[current], list[current+1]
+				current++
+				changed = true
+			}
+		case string(keys.CtrlG), string(keys.Enter), string(keys.CtrlJ):
+			if changed {
+				M.markDirty()
+				user, unlock := M.lockUser()
+				if len(list) <= 0 {
+					err = user.Delete(source)
+				} else {
+					err = user.Store(source, list)
+				}
+				unlock()
+				if err != nil {
+					M.reportError(B, "edit", source, err)
+					return false, nil
+				}
+			}
+			return changed, nil
+		}
+	}
+}
+
+// EditUserJisyo is the command to search the user dictionary,
+// and delete or reorder the candidates of the entry found.
+// Bind it to a key with readline.GoCommand to use it.
+func (M *Mode) EditUserJisyo(ctx context.Context, B *rl.Buffer) rl.Result {
+	prefix, err := M.ask(ctx, B, "辞書編集 見出し:", true)
+	if err != nil {
+		return rl.CONTINUE
+	}
+	source := prefix
+	if _, ok := M.user().Lookup(source); !ok {
+		var found []string
+		if ps, ok := M.user().(PrefixSearcher); ok {
+			found = ps.PrefixSearch(prefix)
+		}
+		if len(found) <= 0 {
+			M.message(B, fmt.Sprintf("%s: 見つかりません", prefix))
+			return rl.CONTINUE
+		}
+		index, err := M.choose(ctx, B, found)
+		if err != nil || index < 0 {
+			return resultOnError(ctx)
+		}
+		source = found[index]
+	}
+	changed, err := M.editEntry(ctx, B, source)
+	if err != nil || !changed || M.userJisyoPath == "" {
+		return resultOnError(ctx)
+	}
+	ans, err := M.ask(ctx, B, fmt.Sprintf("%s に保存しますか?(yes or no)", M.userJisyoPath), false)
+	if err == nil && (ans == "y" || ans == "yes") {
+		M.reportError(B, "save", "", M.SaveUserJisyo(M.userJisyoPath))
+	}
+	return rl.CONTINUE
+}
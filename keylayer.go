@@ -0,0 +1,141 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	"maps"
+
+	rl "github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+// _Layers is the keymaps of SKK for an editor. While SKK is active,
+// the keymap of the editor is replaced with one of them, and the keymap
+// of the host application is kept in host, so the mode switches only
+// assign a keymap instead of binding every key again.
+//
+// A layer is made once with the bindings of the host application for
+// the keys from 0x00 to 0x80, the keys named by go-readline-ny such as
+// the arrow keys and Alt-F, and the bindings of SKK over them.
+// The keys bound by the host application to the keymap of the editor
+// after the layer was made are not seen while SKK is active, and
+// the keys bound while SKK is active are lost when SKK stops.
+// The bindings of readline.GlobalKeyMap are always seen.
+type _Layers struct {
+	host   rl.KeyMap
+	pushed bool
+	kana   map[*_Kana]*rl.KeyMap
+	abbrev *rl.KeyMap
+	// jisx0208 is made on the hiragana layer since the keys of the kana
+	// modes which are not bound for JIS X 0208 are the same for both.
+	jisx0208 *rl.KeyMap
+	// keyBindings and quotedInsertKey are what the layers were made with.
+	// The layers are made again when they are changed.
+	keyBindings     map[keys.Code]string
+	quotedInsertKey keys.Code
+}
+
+// hostKeyMap returns the keymap of the host application of the editor X.
+func (M *Mode) hostKeyMap(X any) *rl.KeyMap {
+	st := M.stateOf(X)
+	if st.layers.pushed {
+		return &st.layers.host
+	}
+	return keyMapOf(X)
+}
+
+// pushLayer replaces the keymap of the editor X with layer.
+// The keymap of the host application is kept only on the first push,
+// so switching the layers of SKK does not stack them.
+func (M *Mode) pushLayer(X any, layer *rl.KeyMap) {
+	km := keyMapOf(X)
+	st := M.stateOf(X)
+	if !st.layers.pushed {
+		st.layers.host = *km
+		st.layers.pushed = true
+	}
+	*km = *layer
+}
+
+// popLayer puts the keymap of the host application back to the editor X.
+func (M *Mode) popLayer(X any) {
+	st := M.stateOf(X)
+	if st.layers.pushed {
+		*keyMapOf(X) = st.layers.host
+		st.layers.host = rl.KeyMap{}
+		st.layers.pushed = false
+	}
+}
+
+// newLayer returns a keymap with the bindings of the host application
+// of X and bindings over them.
+func (M *Mode) newLayer(X any, bindings ...[]_Binding) *rl.KeyMap {
+	host := M.hostKeyMap(X)
+	layer := &rl.KeyMap{}
+	for i := '\x00'; i <= '\x80'; i++ {
+		key := keys.Code(string(i))
+		if command, ok := host.Lookup(key); ok {
+			layer.BindKey(key, command)
+		}
+	}
+	// KeyMap は列挙できないので名前のあるキーを調べる
+	for _, key := range keys.NameToCode {
+		if command, ok := host.Lookup(key); ok {
+			layer.BindKey(key, command)
+		}
+	}
+	for _, list := range bindings {
+		for _, b := range list {
+			layer.BindKey(b.key, b.command)
+		}
+	}
+	return layer
+}
+
+// validateLayers drops the layers of X made with the key bindings
+// which are changed after that.
+func (M *Mode) validateLayers(X any) *_Layers {
+	L := &M.stateOf(X).layers
+	keyBindings := M.keyBindings()
+	if maps.Equal(L.keyBindings, keyBindings) && L.quotedInsertKey == M.QuotedInsertKey {
+		return L
+	}
+	L.kana = nil
+	L.abbrev = nil
+	L.jisx0208 = nil
+	L.keyBindings = keyBindings
+	L.quotedInsertKey = M.QuotedInsertKey
+	return L
+}
+
+// kanaLayer returns the layer of the kana mode K for the editor X.
+func (M *Mode) kanaLayer(X any, K *_Kana) *rl.KeyMap {
+	L := M.validateLayers(X)
+	if layer, ok := L.kana[K]; ok {
+		return layer
+	}
+	layer := M.newLayer(X, M.kanaBindings(K))
+	if L.kana == nil {
+		L.kana = map[*_Kana]*rl.KeyMap{}
+	}
+	L.kana[K] = layer
+	return layer
+}
+
+// abbrevLayer returns the layer of the abbrev mode for the editor X.
+func (M *Mode) abbrevLayer(X any) *rl.KeyMap {
+	L := M.validateLayers(X)
+	if L.abbrev == nil {
+		L.abbrev = M.newLayer(X, M.abbrevBindings())
+	}
+	return L.abbrev
+}
+
+// jisx0208Layer returns the layer of the JIS X 0208 latin mode for the editor X.
+func (M *Mode) jisx0208Layer(X any) *rl.KeyMap {
+	L := M.validateLayers(X)
+	if L.jisx0208 == nil {
+		L.jisx0208 = M.newLayer(X, M.kanaBindings(M.kanas()[0]), M.jisx0208Bindings())
+	}
+	return L.jisx0208
+}
@@ -0,0 +1,73 @@
+package skk
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// layouts is the input layouts of kana: the functions returning
+// the entries added to the romaji table.
+var layouts = map[string]func(base *_Kana) map[string]string{
+	"romaji": func(*_Kana) map[string]string { return nil },
+	"azik":   azik,
+}
+
+// layoutNames returns the sorted names of the layouts.
+func layoutNames() []string {
+	names := make([]string, 0, len(layouts))
+	for name := range layouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// azikExtensions is the keys of AZIK typed after a consonant:
+// the romaji of the vowel and that of the kana following it.
+var azikExtensions = map[string][2]string{
+	"z": {"a", "nn"}, // かん
+	"k": {"i", "nn"}, // きん
+	"j": {"u", "nn"}, // くん
+	"d": {"e", "nn"}, // けん
+	"l": {"o", "nn"}, // こん
+	"q": {"a", "i"},  // かい
+	"h": {"u", "u"},  // くう
+	"w": {"e", "i"},  // けい
+	"p": {"o", "u"},  // こう
+}
+
+// azik returns the entries of AZIK, the extension of romaji
+// typing ん and the double vowels with one key. ";" is っ.
+// The extensions with q and l work only when these keys are
+// unbound from SKK_TOGGLE_KANA and SKK_LATIN_MODE with KeyBindings.
+func azik(base *_Kana) map[string]string {
+	add := map[string]string{";": base.table["xtu"]}
+	for key := range base.table {
+		prefix, ok := strings.CutSuffix(key, "a")
+		if !ok || prefix == "" || strings.ContainsAny(prefix, "aiueo'") {
+			continue
+		}
+		for ext, romaji := range azikExtensions {
+			vowel, ok1 := base.table[prefix+romaji[0]]
+			follow, ok2 := base.table[romaji[1]]
+			if ok1 && ok2 {
+				add[prefix+ext] = vowel + follow
+			}
+		}
+	}
+	return add
+}
+
+// WithLayout adds the entries of the input layout named name,
+// "romaji"(default) or "azik", to the kana tables.
+func WithLayout(name string) Option {
+	return func(M *Mode) error {
+		layout, ok := layouts[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("%q: unknown layout", name)
+		}
+		base := M.kanas()
+		return WithKanaTable(layout(base[0]), layout(base[1]))(M)
+	}
+}
@@ -0,0 +1,201 @@
+package skk
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LazyJisyo is Dictionary which keeps the candidates of each entry
+// as the text in the dictionary such as `/c1;a1/c2/`, and splits them
+// only on the first lookup of the entry. The result is kept for the next
+// lookups, so the cost of loading does not include splitting the entries
+// never used in the session.
+// It can be used from goroutines concurrently.
+type LazyJisyo struct {
+	mutex sync.Mutex
+	// raw is the text of the candidates of the entries not split yet.
+	raw    map[string]string
+	parsed map[string]*lazyEntry
+}
+
+// lazyEntry is an entry of LazyJisyo split already.
+type lazyEntry struct {
+	list       []string
+	candidates []Candidate
+}
+
+// NewLazyJisyo returns an empty LazyJisyo.
+func NewLazyJisyo() *LazyJisyo {
+	return &LazyJisyo{
+		raw:    map[string]string{},
+		parsed: map[string]*lazyEntry{},
+	}
+}
+
+// Load reads the dictionary filename. The encoding is decided by
+// the pragma as Jisyo.ReadWithPragma does. The candidates for the same
+// midashi are appended to the ones read already.
+func (z *LazyJisyo) Load(filename string) error {
+	fd, err := os.Open(expandEnv(filename))
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	return z.ReadWithPragma(fd)
+}
+
+// ReadWithPragma reads the dictionary from r.
+func (z *LazyJisyo) ReadWithPragma(r io.Reader) error {
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+	return scanWithPragma(r, 0, nil, z.readOne)
+}
+
+func (z *LazyJisyo) readOne(line string) lineKind {
+	source, lists, kind := parseLine(line)
+	if kind != lineEntry {
+		return kind
+	}
+	if e, ok := z.parsed[source]; ok {
+		// 分割済みの見出しには分割して追加する
+		e.list = append(e.list[:len(e.list):len(e.list)], splitCandidates(lists)...)
+		e.candidates = nil
+		return lineEntry
+	}
+	if old, ok := z.raw[source]; ok {
+		if !strings.HasSuffix(old, "/") {
+			old += "/"
+		}
+		lists = old + lists
+	}
+	z.raw[source] = lists
+	return lineEntry
+}
+
+// splitCandidates splits the text of the candidates such as `c1;a1/c2/`.
+func splitCandidates(lists string) []string {
+	values := make([]string, 0, strings.Count(lists, "/")+1)
+	for {
+		one, rest, ok := strings.Cut(lists, "/")
+		if one != "" {
+			values = append(values, decodeCandidate(one))
+		}
+		if !ok {
+			return values
+		}
+		lists = rest
+	}
+}
+
+// entry returns the entry of source splitting it on the first call.
+// It must be called with z.mutex locked.
+func (z *LazyJisyo) entry(source string) (*lazyEntry, bool) {
+	if e, ok := z.parsed[source]; ok {
+		return e, true
+	}
+	lists, ok := z.raw[source]
+	if !ok {
+		return nil, false
+	}
+	e := &lazyEntry{list: splitCandidates(lists)}
+	delete(z.raw, source)
+	z.parsed[source] = e
+	return e, true
+}
+
+// Lookup returns the candidates for source.
+func (z *LazyJisyo) Lookup(source string) ([]string, bool) {
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+	if e, ok := z.entry(source); ok {
+		return e.list, true
+	}
+	return nil, false
+}
+
+// LookupCandidates returns the candidates for source split from
+// the annotations. The result is kept with the entry.
+func (z *LazyJisyo) LookupCandidates(source string) ([]Candidate, bool) {
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+	e, ok := z.entry(source)
+	if !ok {
+		return nil, false
+	}
+	if e.candidates == nil {
+		e.candidates = make([]Candidate, len(e.list))
+		for i, s := range e.list {
+			e.candidates[i] = parseCandidate(s)
+		}
+	}
+	return e.candidates, true
+}
+
+// Store replaces the candidates for source.
+func (z *LazyJisyo) Store(source string, candidates []string) error {
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+	delete(z.raw, source)
+	z.parsed[source] = &lazyEntry{list: candidates}
+	return nil
+}
+
+// Delete removes the entry for source.
+func (z *LazyJisyo) Delete(source string) error {
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+	delete(z.raw, source)
+	delete(z.parsed, source)
+	return nil
+}
+
+// Len returns the count of the entries and the ones split already.
+func (z *LazyJisyo) Len() (entries, parsed int) {
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+	return len(z.raw) + len(z.parsed), len(z.parsed)
+}
+
+// PrefixSearch returns the sorted midashi starting with prefix.
+// The entries are not split.
+func (z *LazyJisyo) PrefixSearch(prefix string) []string {
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+	var result []string
+	for key := range z.raw {
+		if strings.HasPrefix(key, prefix) {
+			result = append(result, key)
+		}
+	}
+	for key := range z.parsed {
+		if strings.HasPrefix(key, prefix) {
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Complete returns the sorted midashi starting with prefix.
+func (z *LazyJisyo) Complete(prefix string) []string {
+	return z.PrefixSearch(prefix)
+}
+
+// WithLazySystemJisyo is the same as WithSystemJisyo, but the dictionaries
+// are read into LazyJisyo set to Mode.SystemDictionary, so the candidates
+// are split only for the entries looked up.
+func WithLazySystemJisyo(filenames ...string) Option {
+	return func(M *Mode) error {
+		z := NewLazyJisyo()
+		for _, fn := range filenames {
+			if err := z.Load(fn); err != nil {
+				return err
+			}
+		}
+		M.SystemDictionary = z
+		return nil
+	}
+}
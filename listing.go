@@ -0,0 +1,66 @@
+package skk
+
+import (
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+// KeyList is a set of keys bound to one operation.
+type KeyList []keys.Code
+
+func (K KeyList) has(key string) bool {
+	for _, k := range K {
+		if string(k) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectionKeys is the key table used in the candidate listing
+// and while ▼ is shown.
+type SelectionKeys struct {
+	// Select is the keys to choose candidates.
+	// The n-th key chooses the n-th candidate on the listing.
+	Select string
+	// NextPage and PrevPage are the keys to show the next or previous page.
+	// NextPage on the last page of the candidates starts the registration.
+	// PrevPage also shows the previous candidate while ▼ is shown.
+	NextPage KeyList
+	PrevPage KeyList
+	// NextItem and PrevItem are the keys to shift the listing by one candidate.
+	NextItem KeyList
+	PrevItem KeyList
+	// Cancel is the keys to quit the conversion.
+	Cancel KeyList
+	// Purge is the keys to delete the candidate shown by ▼
+	// from the user dictionary.
+	Purge KeyList
+}
+
+// DefaultSelectionKeys is the key table used when Mode.SelectionKeys is nil.
+var DefaultSelectionKeys = &SelectionKeys{
+	Select:   "asdfjkl:",
+	NextPage: KeyList{" ", keys.CtrlV},
+	PrevPage: KeyList{"x", keys.AltV},
+	NextItem: KeyList{keys.CtrlN},
+	PrevItem: KeyList{keys.CtrlP},
+	Cancel:   KeyList{keys.CtrlG},
+	Purge:    KeyList{"X"},
+}
+
+func (M *Mode) selectionKeys() *SelectionKeys {
+	if M.SelectionKeys != nil {
+		return M.SelectionKeys
+	}
+	return DefaultSelectionKeys
+}
+
+// indexRune returns the index of key in list, or -1 if key is not one rune in list.
+func indexRune(list []rune, key string) int {
+	for i, r := range list {
+		if string(r) == key {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,14 @@
+package skk
+
+// Logger is the destination of the trace of SKK.
+// *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+// debugf writes the trace to M.Logger when it is set.
+func (M *Mode) debugf(format string, v ...any) {
+	if M != nil && M.Logger != nil {
+		M.Logger.Printf(format, v...)
+	}
+}
@@ -0,0 +1,107 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	"context"
+
+	rl "github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+// Macro is the sequence of the keys typed while SKK is active:
+// the kana, the conversions and the kakutei.
+// The keys bound by the host application are not contained.
+type Macro []string
+
+// _Recorder is the command bound by SKK which records its key to the macro.
+type _Recorder struct {
+	rl.Command
+	key keys.Code
+	M   *Mode
+}
+
+func (r *_Recorder) Call(ctx context.Context, B *rl.Buffer) rl.Result {
+	r.M.record(string(r.key))
+	r.M.resumeMode(B)
+	return r.Command.Call(ctx, B)
+}
+
+// bindRecorded binds command to key of X so that the key is recorded.
+func (M *Mode) bindRecorded(X KeyBinder, key keys.Code, command rl.Command) {
+	M.bindingMutex.Lock()
+	r := M.recorder(key, command)
+	M.bindingMutex.Unlock()
+	X.BindKey(key, r)
+}
+
+func (M *Mode) record(key string) {
+	if M.recording {
+		M.macro = append(M.macro, key)
+	}
+}
+
+// readKey reads a key for SKK from the macro being replayed, the keys typed
+// while ContextSource was looked up, or the terminal by getKey.
+func (M *Mode) readKey(ctx context.Context, B *rl.Buffer) (string, error) {
+	var key string
+	st := M.stateOf(B)
+	if len(M.replaying) > 0 {
+		key = M.replaying[0]
+		M.replaying = M.replaying[1:]
+	} else if len(st.typeAhead) > 0 {
+		key = st.typeAhead[0]
+		st.typeAhead = st.typeAhead[1:]
+	} else {
+		var err error
+		key, err = M.getKey(ctx, B)
+		if err != nil {
+			return "", err
+		}
+	}
+	M.record(key)
+	return key, nil
+}
+
+// StartRecording starts to record the keys typed in SKK.
+// The macro recorded before is discarded.
+func (M *Mode) StartRecording() {
+	M.macro = nil
+	M.recording = true
+}
+
+// StopRecording stops recording and returns the macro recorded.
+// Save it to replay it later, or to report a bug with the keys reproducing it.
+func (M *Mode) StopRecording() Macro {
+	M.recording = false
+	macro := M.macro
+	M.macro = nil
+	return macro
+}
+
+// Replay types the keys of macro on B as if they were typed.
+// The keys read by the conversion such as the selection of
+// the candidates are also given from macro.
+func (M *Mode) Replay(ctx context.Context, B *rl.Buffer, macro Macro) rl.Result {
+	M.replaying = append(M.replaying, macro...)
+	defer func() { M.replaying = nil }()
+	for len(M.replaying) > 0 {
+		key := M.replaying[0]
+		M.replaying = M.replaying[1:]
+		if rc := eval(ctx, B, key); rc != rl.CONTINUE {
+			return rc
+		}
+	}
+	return rl.CONTINUE
+}
+
+// CmdReplayMacro returns SKK_REPLAY_MACRO, which replays macro.
+// Bind it to a key to use macro as an abbreviation.
+func (M *Mode) CmdReplayMacro(macro Macro) rl.Command {
+	return &rl.GoCommand{
+		Name: "SKK_REPLAY_MACRO",
+		Func: func(ctx context.Context, B *rl.Buffer) rl.Result {
+			return M.Replay(ctx, B, macro)
+		},
+	}
+}
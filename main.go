@@ -1,25 +1,21 @@
+//go:build !js && !plan9
+
 package skk
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"regexp"
+	"io"
+	"slices"
 	"strings"
-	"unicode"
+	"time"
 
 	rl "github.com/nyaosorg/go-readline-ny"
 	"github.com/nyaosorg/go-readline-ny/keys"
-	// "github.com/nyaosorg/go-windows-dbg"
 )
 
-func debug(text string) {
-	// dbg.Println(text)
-}
-
 const (
-	markerWhite = "▽"
-	markerBlack = "▼"
-
 	msgHiragana = "[か]"
 	msgKatakana = "[カ]"
 	msgLatin    = ""
@@ -36,239 +32,279 @@ func (trig *_Trigger) String() string {
 	return "SKK_HENKAN_TRIGGER_" + string(trig.Key)
 }
 
-// Mode is an instance of SKK. It contains system dictionaries and user dictionaries.
-type Mode struct {
-	User       Jisyo
-	System     Jisyo
-	MiniBuffer MiniBuffer
-	saveMap    []rl.Command
-	kana       *_Kana
+// String returns the name as the command starting SKK
+func (M *Mode) String() string {
+	return "SKK_MODE"
 }
 
-var rxNumber = regexp.MustCompile(`[0-9]+`)
+// Call is readline.Command to start SKK henkan mode.
+func (M *Mode) Call(ctx context.Context, B *rl.Buffer) rl.Result {
+	return M.startKana(B, callOptions(ctx).Katakana)
+}
 
-var rxToNumber = regexp.MustCompile(`#[0123459]`)
+// startKana starts the katakana mode when katakana is true,
+// or the hiragana mode, from any input mode.
+func (M *Mode) startKana(B *rl.Buffer, katakana bool) rl.Result {
+	if katakana {
+		M.enable(B, M.kanas()[1])
+		M.message(B, msgKatakana)
+		M.notify(StateKatakana)
+		return rl.CONTINUE
+	}
+	M.enable(B, M.kanas()[0])
+	M.message(B, msgHiragana)
+	M.notify(StateHiragana)
+	return rl.CONTINUE
+}
 
-var kansuji = map[rune]string{
-	'0': "〇",
-	'1': "一",
-	'2': "二",
-	'3': "三",
-	'4': "四",
-	'5': "五",
-	'6': "六",
-	'7': "七",
-	'8': "八",
-	'9': "九",
+func (M *Mode) cmdHiraganaMode(_ context.Context, B *rl.Buffer) rl.Result {
+	return M.startKana(B, false)
 }
 
-func numberToKanji(s string) string {
-	var buffer strings.Builder
-	for _, r := range s {
-		buffer.WriteString(kansuji[r])
-	}
-	return buffer.String()
+func (M *Mode) cmdKatakanaMode(_ context.Context, B *rl.Buffer) rl.Result {
+	return M.startKana(B, true)
 }
 
-func hanToZenString(s string) string {
-	var buffer strings.Builder
-	for _, r := range s {
-		buffer.WriteRune(hanToZen(r))
+// Setup sets Ctrl-J in readline's global keymap to boot into SKK mode.
+// If you want to set the SKK for a specific readline keymap,
+// give the return value of the Load function as the second argument of BindKey
+func Setup(userJisyoFname string, systemJisyoFnames ...string) error {
+	M, err := Load(userJisyoFname, systemJisyoFnames...)
+	if err != nil {
+		return err
 	}
-	return buffer.String()
+	rl.GlobalKeyMap.BindKey(keys.CtrlJ, M)
+	return nil
 }
 
-func (M *Mode) _lookup(source string) ([]string, bool) {
-	list, ok := M.User[source]
-	if ok {
-		return list, true
-	}
-	list, ok = M.System[source]
-	return list, ok
+type _Romaji struct {
+	kana *_Kana
+	last string
+	mode *Mode
 }
 
-func (M *Mode) lookup(source string) ([]string, bool) {
-	list, ok := M._lookup(source)
-	if ok {
-		return list, ok
-	}
-	loc := rxNumber.FindStringIndex(source)
-	if loc == nil {
-		return nil, false
-	}
-	number := source[loc[0]:loc[1]]
-	source = source[:loc[0]] + "#" + source[loc[1]:]
-	list, ok = M._lookup(source)
-	if !ok {
-		return nil, false
-	}
-	newList := make([]string, 0, len(list))
-	for _, s := range list {
-		tmp := rxToNumber.ReplaceAllStringFunc(s, func(ss string) string {
-			switch ss[1] {
-			case '0': // 無変換
-				return number
-			case '1': // 全角化
-				return hanToZenString(number)
-			case '2': // 漢数字で位取りあり
-				return numberToKanji(number)
-			case '3': // 漢数字で位取りなし
-				return numberToKanji(number) // あとでやる
-			default:
-				return number
-			}
-		})
-		newList = append(newList, tmp)
-	}
-	return newList, true
+func (R *_Romaji) String() string {
+	return "SKK_ROMAJI_" + R.last
 }
 
-func unshift[T any](list []T, value T) []T {
-	var zero T
-	list = append(list, zero)
-	copy(list[1:], list)
-	list[0] = value
-	return list
+func (R *_Romaji) Call(ctx context.Context, B *rl.Buffer) rl.Result {
+	if R.mode != nil {
+		R.mode.countKey(R.mode.kanaState(B))
+	}
+	R.mode.inputRomaji(surfaceOf(B), R.kana, R.last)
+	return rl.CONTINUE
 }
 
-func (M *Mode) newCandidate(ctx context.Context, B *rl.Buffer, source string) (string, bool) {
-	newWord, err := M.ask(ctx, B, source, true)
+// newCandidate asks the new word for source and registers it.
+// It returns an empty string when the registration is canceled,
+// and readline.CtrlC when it is interrupted.
+func (M *Mode) newCandidate(ctx context.Context, B *rl.Buffer, source, postfix string) (string, error) {
+	if source == "" || callOptions(ctx).NoRegistration {
+		return "", nil
+	}
+	if M.depth >= M.maxDepth() {
+		M.message(B, fmt.Sprintf("辞書登録の入れ子は%d段までです", M.maxDepth()))
+		return "", nil
+	}
+	M.notify(StateRegistering)
+	newWord, err := M.ask(ctx, B, registrationPrompt(M.depth, source, postfix), true)
 	B.RepaintAfterPrompt()
-	if err != nil || len(newWord) <= 0 {
-		return "", false
+	if err != nil {
+		return "", err
 	}
-	list, _ := M.lookup(source)
-
-	// 二重登録よけ
-	for _, candidate := range list {
-		if candidate == newWord {
-			return newWord, true
-		}
+	if postfix != "" {
+		// 送り仮名まで入力された時は語幹だけを登録する
+		newWord = strings.TrimSuffix(newWord, postfix)
+	}
+	if len(newWord) <= 0 {
+		return "", nil
+	}
+	// 入力された ; は注釈の区切りではなく単語の一部
+	if err := M.Register(source, escapeCandidate(newWord)); err != nil {
+		M.reportError(B, "register", source, err)
+	}
+	return newWord, nil
+}
+
+// register starts the registration mode and confirms the new word
+// followed by the okurigana postfix.
+// When it is canceled, the midashi is restored with ▽.
+// It is restored also when a key was typed while the sources were
+// looked up, and the key is evaluated instead of the registration.
+func (M *Mode) register(ctx context.Context, B *rl.Buffer, markerPos int, source, postfix string) rl.Result {
+	if M.hasTypeAhead(B) {
+		// 登録モードの入力と端末の読み込みが重ならないように
+		// 先に打たれたキーを見出しに対して処理する
+		M.restoreMidashi(B, markerPos, source, postfix)
+		return M.evalTypeAhead(ctx, B)
+	}
+	result, err := M.newCandidate(ctx, B, source, postfix)
+	if errors.Is(err, rl.CtrlC) {
+		return M.interruptHenkan(ctx, B, markerPos, source, postfix)
+	}
+	if result != "" {
+		result += postfix
+		// 新変換文字列を展開する
+		B.ReplaceAndRepaint(markerPos, result)
+		M.remember(source, result)
+		M.kakuteiDone(result)
+		return rl.CONTINUE
 	}
-	// リストの先頭に挿入
-	M.User[source] = unshift(list, newWord)
-	return newWord, true
+	// 変換前に一旦戻す
+	M.restoreMidashi(B, markerPos, source, postfix)
+	return resultOnError(ctx)
 }
 
-const listingStartIndex = 4
-
-func (M *Mode) henkanMode(ctx context.Context, B *rl.Buffer, markerPos int, source string, postfix string) rl.Result {
-	list, found := M.lookup(source)
+func (M *Mode) henkanMode(ctx context.Context, B *rl.Buffer, markerPos int, source string, postfix string) (result rl.Result) {
+	defer func() {
+		// 検索中に先に打たれたキーが残っていれば、エディタが端末を読む前に処理する
+		for result == rl.CONTINUE && M.hasTypeAhead(B) {
+			result = M.evalTypeAhead(ctx, B)
+		}
+	}()
+	h, found, err := M.lookupHenkanWatching(ctx, B, source)
+	if errors.Is(err, errLookupCanceled) {
+		M.message(B, "辞書の検索を中止しました")
+		M.restoreMidashi(B, markerPos, source, postfix)
+		return rl.CONTINUE
+	}
+	if err != nil {
+		M.restoreMidashi(B, markerPos, source, postfix)
+		return resultOnError(ctx)
+	}
+	if !found && M.loading() {
+		M.message(B, "辞書を読み込み中です")
+		M.restoreMidashi(B, markerPos, source, postfix)
+		return M.evalTypeAhead(ctx, B)
+	}
 	if !found {
 		// 辞書登録モード
-		result, ok := M.newCandidate(ctx, B, source)
-		if ok {
-			// 新変換文字列を展開する
-			B.ReplaceAndRepaint(markerPos, result)
-			return rl.CONTINUE
-		} else {
-			// 変換前に一旦戻す
-			B.ReplaceAndRepaint(markerPos, markerWhite+source)
-			return rl.CONTINUE
-		}
+		return M.register(ctx, B, markerPos, source, postfix)
+	}
+	h.annotation = !callOptions(ctx).HideAnnotation
+	defer h.close()
+	if !h.has(0) {
+		return M.register(ctx, B, markerPos, source, postfix)
 	}
-	current := 0
-	candidate, _, _ := strings.Cut(list[current], ";")
-	B.ReplaceAndRepaint(markerPos, markerBlack+candidate+postfix)
+	st := M.stateOf(B)
+	st.source = source
+	defer func() { st.source = "" }()
+	B.ReplaceAndRepaint(markerPos, M.black()+h.candidate()+postfix)
+	M.notify(StateMarkerBlack)
 	for {
-		input, _ := B.GetKey()
-		if input == string(keys.CtrlG) {
-			B.ReplaceAndRepaint(markerPos, markerWhite+source)
-			return rl.CONTINUE
-		} else if input < " " {
-			removeOne(B, markerPos)
+		var input string
+		var err error
+		if h.listing {
+			M.count(func(m *Metrics) { m.PageViews++ })
+			input, err = M.ask1(ctx, B, h.listingPrompt())
+		} else {
+			input, err = M.readKey(ctx, B)
+		}
+		if err != nil {
+			M.kakutei(surfaceOf(B), markerPos)
+			M.reset(B)
+			return resultOnError(ctx)
+		}
+		if M.Logger != nil {
+			M.debugf("henkan key %q", input)
+		}
+		M.countKey(StateMarkerBlack)
+		switch h.step(input) {
+		case henkanShow:
+			B.ReplaceAndRepaint(markerPos, M.black()+h.candidate()+postfix)
+		case henkanKakutei:
+			M.remember(source, h.candidate()+postfix)
+			M.kakutei(surfaceOf(B), markerPos)
 			return rl.CONTINUE
-		} else if input == " " {
-			current++
-			if current >= len(list) {
-				// 辞書登録モード
-				result, ok := M.newCandidate(ctx, B, source)
-				if ok {
-					// 新変換文字列を展開する
-					B.ReplaceAndRepaint(markerPos, result)
-					return rl.CONTINUE
-				} else {
-					// 変換前に一旦戻す
-					B.ReplaceAndRepaint(markerPos, markerWhite+source)
-					return rl.CONTINUE
-				}
-			}
-			if current >= listingStartIndex {
-				for {
-					var buffer strings.Builder
-					_current := current
-					for _, key := range "ASDFJKL:" {
-						if _current >= len(list) {
-							break
-						}
-						candidate, _, _ = strings.Cut(list[_current], ";")
-						fmt.Fprintf(&buffer, "%c:%s ", key, candidate)
-						_current++
-					}
-					fmt.Fprintf(&buffer, "[残り %d]", len(list)-_current)
-					key, err := M.ask1(B, buffer.String())
-					if err == nil {
-						if index := strings.Index("asdfjkl:", key); index >= 0 {
-							candidate, _, _ = strings.Cut(list[current+index], ";")
-							B.ReplaceAndRepaint(markerPos, candidate)
-							return rl.CONTINUE
-						} else if key == " " {
-							current = _current
-						} else if key == "x" {
-							current -= len("ASDFJKL:")
-							if current < listingStartIndex {
-								if current < 0 {
-									current = 0
-								}
-								break
-							}
-						} else if key == string(keys.CtrlG) {
-							B.ReplaceAndRepaint(markerPos, markerWhite+source)
-							return rl.CONTINUE
-						}
-					}
+		case henkanKakuteiAndEval:
+			M.remember(source, h.candidate()+postfix)
+			M.kakutei(surfaceOf(B), markerPos)
+			return eval(ctx, B, input)
+		case henkanKakuteiAndInsert:
+			M.remember(source, h.candidate()+postfix)
+			M.kakutei(surfaceOf(B), markerPos)
+			if strings.HasPrefix(input, pasteStart) {
+				text, err := M.pastedText(ctx, B, input)
+				B.InsertAndRepaint(text)
+				if err != nil {
+					return resultOnError(ctx)
 				}
-			} else {
-				candidate, _, _ = strings.Cut(list[current], ";")
-				B.ReplaceAndRepaint(markerPos, markerBlack+candidate+postfix)
-			}
-		} else if input == "x" {
-			current--
-			if current < 0 {
-				B.ReplaceAndRepaint(markerPos, markerWhite+source)
 				return rl.CONTINUE
 			}
-			candidate, _, _ = strings.Cut(list[current], ";")
-			B.ReplaceAndRepaint(markerPos, markerBlack+candidate+postfix)
-		} else if input == "X" {
-			prompt := fmt.Sprintf(`really purge "%s /%s/ "?(yes or no)`, source, list[current])
+			B.InsertAndRepaint(stripControls(input))
+			return rl.CONTINUE
+		case henkanKatakana:
+			text := toKatakana(h.candidate() + postfix)
+			M.remember(source, text)
+			B.ReplaceAndRepaint(markerPos, text)
+			M.kakuteiDone(text)
+			return rl.CONTINUE
+		case henkanSelect:
+			candidate := h.candidate()
+			M.remember(source, candidate)
+			B.ReplaceAndRepaint(markerPos, candidate)
+			M.kakuteiDone(candidate)
+			return rl.CONTINUE
+		case henkanCancel:
+			M.restoreMidashi(B, markerPos, source, postfix)
+			return rl.CONTINUE
+		case henkanRegister:
+			// 辞書登録モード
+			return M.register(ctx, B, markerPos, source, postfix)
+		case henkanInterrupt:
+			return M.interruptHenkan(ctx, B, markerPos, source, postfix)
+		case henkanPurge:
+			list := h.all()
+			prompt := fmt.Sprintf(`really purge "%s /%s/ "?(yes or no)`, source, list[h.current])
 			ans, err := M.ask(ctx, B, prompt, false)
-			if err == nil {
-				if ans == "y" || ans == "yes" {
-					// 本当はシステム辞書を参照しないようLisp構文を
-					// セットしなければいけないが、そこまではしない.
-					if len(list) <= 1 {
-						delete(M.User, source)
+			if errors.Is(err, rl.CtrlC) {
+				return M.interruptHenkan(ctx, B, markerPos, source, postfix)
+			}
+			if err != nil && !errors.Is(err, io.EOF) {
+				// 端末が読めなくなったら ▼ やキーマップを残さずに抜ける
+				M.kakutei(surfaceOf(B), markerPos)
+				M.reset(B)
+				return resultOnError(ctx)
+			}
+			if err == nil && (ans == "y" || ans == "yes") {
+				purged := list[h.current]
+				ignore := M.inSystem(source, purged)
+				err := M.updateUser(source, func(list []string, ok bool) []string {
+					if !ok {
+						list = h.purged()
 					} else {
-						if current+1 < len(list) {
-							copy(list[current:], list[current+1:])
-						}
-						list = list[:len(list)-1]
-						M.User[source] = list
+						// 他の Mode が並びを変えているかもしれないので値で消す
+						list = slices.DeleteFunc(slices.Clone(list), func(s string) bool { return s == purged })
+					}
+					if ignore {
+						// システム辞書の候補は ddskk と同じく
+						// skk-ignore-dic-word で隠す
+						list = withIgnoredWord(list, parseCandidate(purged).Text)
+					}
+					return list
+				})
+				if err != nil {
+					M.reportError(B, "purge", source, err)
+				} else {
+					M.count(func(m *Metrics) { m.Purges++ })
+					if M.onPurge != nil {
+						M.onPurge(source, list[h.current])
 					}
-					B.ReplaceAndRepaint(markerPos, "")
-					return rl.CONTINUE
 				}
+				B.ReplaceAndRepaint(markerPos, "")
+				M.notify(M.kanaState(B))
+				return rl.CONTINUE
 			}
-		} else {
-			removeOne(B, markerPos)
-			return eval(ctx, B, input)
 		}
 	}
 }
 
 func (trig *_Trigger) Call(ctx context.Context, B *rl.Buffer) rl.Result {
-	if markerPos := seekMarker(B); markerPos >= 0 {
+	trig.M.debugf("key %s", trig)
+	markerPos := trig.M.seekMarker(surfaceOf(B))
+	if markerPos >= 0 && markerPos+1 < B.Cursor {
+		// マーカーが無い時は _Romaji で数える
+		trig.M.countKey(trig.M.kanaState(B))
 		// 送り仮名つき変換
 		var source strings.Builder
 		source.WriteString(B.SubString(markerPos+1, B.Cursor))
@@ -276,94 +312,186 @@ func (trig *_Trigger) Call(ctx context.Context, B *rl.Buffer) rl.Result {
 
 		var postfix string
 		if index := strings.IndexByte("aiueo", trig.Key); index >= 0 {
-			postfix = trig.M.kana.table[string(trig.Key)]
+			postfix = trig.M.stateOf(B).kana.table[string(trig.Key)]
 		} else {
 			postfix = string(trig.Key)
 		}
 		return trig.M.henkanMode(ctx, B, markerPos, source.String(), postfix)
 	}
-	B.InsertAndRepaint(markerWhite)
-	r := &_Romaji{kana: trig.M.kana, last: string(trig.Key)}
+	// 見出しが空の ▽ の後では送り仮名にせず見出しの先頭にする
+	if markerPos < 0 {
+		B.InsertAndRepaint(trig.M.white())
+		trig.M.notify(StateMarkerWhite)
+	}
+	r := &_Romaji{kana: trig.M.stateOf(B).kana, last: string(trig.Key), mode: trig.M}
 	return r.Call(ctx, B)
 }
 
-func seekMarker(B *rl.Buffer) int {
-	for i := B.Cursor - 1; i >= 0; i-- {
-		ch := B.Buffer[i].String()
-		if ch == markerWhite || ch == markerBlack {
-			return i
-		}
+func (M *Mode) cmdAcceptLine(ctx context.Context, B *rl.Buffer) rl.Result {
+	M.stripMarkers(surfaceOf(B))
+	M.releaseMode(B)
+	// go-multiline-ny などが Enter に独自のコマンドを割り当てている場合はそれを呼ぶ
+	if command := M.savedCommand(B, keys.Enter); command != nil && !strings.HasPrefix(command.String(), "SKK_") {
+		return command.Call(ctx, B)
 	}
-	return -1
-}
-
-func removeOne(B *rl.Buffer, pos int) {
-	copy(B.Buffer[pos:], B.Buffer[pos+1:])
-	B.Buffer = B.Buffer[:len(B.Buffer)-1]
-	B.Cursor--
-	B.RepaintAfterPrompt()
+	return rl.ENTER
 }
 
 func (M *Mode) cmdStartHenkan(ctx context.Context, B *rl.Buffer) rl.Result {
-	markerPos := seekMarker(B)
+	markerPos := M.seekMarker(surfaceOf(B))
 	if markerPos < 0 {
 		B.InsertAndRepaint(" ")
 		return rl.CONTINUE
 	}
 	source := B.SubString(markerPos+1, B.Cursor)
+	if source == "" {
+		// 見出しが空の時は ▽ を取り消すだけにする
+		B.ReplaceAndRepaint(markerPos, "")
+		M.notify(M.kanaState(B))
+		return rl.CONTINUE
+	}
+	postfix := ""
+	st := M.stateOf(B)
+	okuri := st.okuri
+	st.okuri = _Okuri{}
+	if okuri.buffer == B && okuri.text == B.SubString(markerPos, B.Cursor) {
+		// 取り消した送り仮名つき変換をやり直す
+		source, postfix = okuri.source, okuri.postfix
+	}
+	return M.henkanMode(ctx, B, markerPos, source, postfix)
+}
 
-	return M.henkanMode(ctx, B, markerPos, source, "")
+// stripControls removes the control characters from the text
+// inserted as it is, such as the newlines of the pasted text.
+func stripControls(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7F {
+			return -1
+		}
+		return r
+	}, s)
 }
 
+// eval runs the command bound to input. The escape sequence of a key
+// not bound is ignored instead of being inserted as the text.
 func eval(ctx context.Context, B *rl.Buffer, input string) rl.Result {
+	if classifyKey(input) == keySequence {
+		code := keys.Code(input)
+		if _, ok := B.Editor.KeyMap.Lookup(code); !ok {
+			if _, ok := rl.GlobalKeyMap.Lookup(code); !ok {
+				return rl.CONTINUE
+			}
+		}
+	}
 	return B.LookupCommand(input).Call(ctx, B)
 }
 
 func (M *Mode) cmdKakutei(ctx context.Context, B *rl.Buffer) rl.Result {
-	markerPos := seekMarker(B)
+	markerPos := M.seekMarker(surfaceOf(B))
 	if markerPos < 0 {
 		return M.cmdLatinMode(ctx, B)
 	}
-	// kakutei
-	removeOne(B, markerPos)
+	M.kakutei(surfaceOf(B), markerPos)
 	return rl.CONTINUE
 }
 
 func (M *Mode) cmdCancel(ctx context.Context, B *rl.Buffer) rl.Result {
-	markerPos := seekMarker(B)
+	markerPos := M.seekMarker(surfaceOf(B))
 	if markerPos < 0 {
 		return M.cmdLatinMode(ctx, B)
 	}
 	B.ReplaceAndRepaint(markerPos, "")
+	M.notify(M.kanaState(B))
 	return rl.CONTINUE
 }
 
+func (M *Mode) cmdBackwardDeleteChar(ctx context.Context, B *rl.Buffer) rl.Result {
+	if markerPos := M.seekMarker(surfaceOf(B)); markerPos >= 0 && markerPos+1 == B.Cursor {
+		// ▽ まで消した時は見出しの入力をやめる
+		B.ReplaceAndRepaint(markerPos, "")
+		M.notify(M.kanaState(B))
+		return rl.CONTINUE
+	}
+	if command := M.savedCommand(B, keys.Backspace); command != nil && !strings.HasPrefix(command.String(), "SKK_") {
+		return command.Call(ctx, B)
+	}
+	return rl.CmdBackwardDeleteChar.Call(ctx, B)
+}
+
 func (m *Mode) cmdToggleKana(_ context.Context, B *rl.Buffer) rl.Result {
-	m.enable(B, kanaTable[m.kana.switchTo])
-	if m.kana.switchTo == 1 {
+	st := m.stateOf(B)
+	m.enable(B, m.kanas()[st.kana.switchTo])
+	if st.kana == m.kanas()[0] {
 		m.message(B, msgHiragana)
 	} else {
 		m.message(B, msgKatakana)
 	}
+	m.notify(m.kanaState(B))
+	return rl.CONTINUE
+}
+
+func (M *Mode) cmdQuotedInsert(ctx context.Context, B *rl.Buffer) rl.Result {
+	key, err := M.readKey(ctx, B)
+	if err != nil {
+		return resultOnError(ctx)
+	}
+	B.InsertAndRepaint(key)
 	return rl.CONTINUE
 }
 
+func (M *Mode) cmdToday(_ context.Context, B *rl.Buffer) rl.Result {
+	B.InsertAndRepaint(M.Today(time.Now())[0])
+	return rl.CONTINUE
+}
+
+// codePrompt is the prompt of SKK_INPUT_BY_CODE.
+const codePrompt = "JIS or Unicode code (2422, a4a2, u3042 or RET for menu): "
+
+func (M *Mode) cmdInputByCode(ctx context.Context, B *rl.Buffer) rl.Result {
+	code, err := M.ask(ctx, B, codePrompt, false)
+	if err != nil {
+		return resultOnError(ctx)
+	}
+	if strings.TrimSpace(code) == "" {
+		return M.inputByMenu(ctx, B)
+	}
+	r, ok := codeToRune(code)
+	if !ok {
+		M.message(B, fmt.Sprintf("%q: 文字コードではありません", code))
+		return rl.CONTINUE
+	}
+	B.InsertAndRepaint(string(r))
+	return rl.CONTINUE
+}
+
+// inputByMenu inserts the symbol chosen from the listing of jisSymbols.
+func (M *Mode) inputByMenu(ctx context.Context, B *rl.Buffer) rl.Result {
+	h := newMenu(jisSymbols(), M.selectionKeys())
+	for {
+		input, err := M.ask1(ctx, B, h.listingPrompt())
+		if err != nil {
+			return resultOnError(ctx)
+		}
+		switch h.step(input) {
+		case henkanSelect:
+			B.InsertAndRepaint(h.candidate())
+			return rl.CONTINUE
+		case henkanCancel, henkanInterrupt, henkanKakuteiAndInsert:
+			return rl.CONTINUE
+		}
+	}
+}
+
 func (M *Mode) cmdAbbrevMode(ctx context.Context, B *rl.Buffer) rl.Result {
-	if seekMarker(B) >= 0 {
+	if M.seekMarker(surfaceOf(B)) >= 0 {
 		return rl.CONTINUE
 	}
 	M.restoreKeyMap(B)
-	B.InsertAndRepaint(markerWhite)
-	B.BindKey(" ", &rl.GoCommand{
-		Name: "SKK_ABBREV_START_HENKAN",
-		Func: func(ctx context.Context, B *rl.Buffer) rl.Result {
-			rc := M.cmdStartHenkan(ctx, B)
-			M.enable(B, hiragana)
-			M.message(B, msgHiragana)
-			return rc
-		},
-	})
+	M.pushLayer(B, M.abbrevLayer(B))
+	M.stateOf(B).mode = StateAbbrev
+	B.InsertAndRepaint(M.white())
 	M.message(B, msgAbbrev)
+	M.notify(StateAbbrev)
 	return rl.CONTINUE
 }
 
@@ -371,108 +499,154 @@ type canLookup interface {
 	Lookup(keys.Code) (rl.Command, bool)
 }
 
-type canBindKey interface {
-	BindKey(keys.Code, rl.Command)
-}
-
 type canKeyMap interface {
 	canLookup
-	canBindKey
+	KeyBinder
 }
 
 func (mode *Mode) enable(X canKeyMap, K *_Kana) {
-	mode.backupKeyMap(X)
-	mode.kana = K
-	for i := range romajiTrigger {
-		c := romajiTrigger[i : i+1]
-		X.BindKey(keys.Code(c), &_Romaji{kana: K, last: c})
-	}
-	const upperRomaji = "AIUEOKSTNHMYRWFGZDBPCJ"
-	for i, c := range upperRomaji {
-		u := &_Trigger{Key: byte(unicode.ToLower(c)), M: mode}
-		X.BindKey(keys.Code(upperRomaji[i:i+1]), u)
-	}
-	X.BindKey("q", &rl.GoCommand{Name: "SKK_TOGGLE_KANA", Func: mode.cmdToggleKana})
-	X.BindKey("/", &rl.GoCommand{Name: "SKK_ABBREV_MODE", Func: mode.cmdAbbrevMode})
-	X.BindKey(" ", &rl.GoCommand{Name: "SKK_START_HENKAN", Func: mode.cmdStartHenkan})
-	X.BindKey("l", &rl.GoCommand{Name: "SKK_LATIN_MODE", Func: mode.cmdLatinMode})
-	X.BindKey("L", &rl.GoCommand{Name: "SKK_JISX0208_LATIN_MODE", Func: mode.cmdJis0208LatinMode})
-	X.BindKey(keys.CtrlG, &rl.GoCommand{Name: "SKK_CANCEL", Func: mode.cmdCancel})
-	X.BindKey(keys.CtrlJ, &rl.GoCommand{Name: "SKK_KAKUTEI", Func: mode.cmdKakutei})
-}
-
-func (M *Mode) backupKeyMap(km canLookup) {
-	if M.saveMap != nil {
-		return
-	}
-	debug("backupKeyMap")
-	M.saveMap = make([]rl.Command, 0, 0x80)
-	for i := '\x00'; i <= '\x80'; i++ {
-		key := keys.Code(string(i))
-		val, _ := km.Lookup(key)
-		M.saveMap = append(M.saveMap, val)
+	mode.pushLayer(X, mode.kanaLayer(X, K))
+	st := mode.stateOf(X)
+	st.kana = K
+	st.active = true
+	st.mode = StateHiragana
+	if K == mode.kanas()[1] {
+		st.mode = StateKatakana
 	}
 }
 
-func (M *Mode) restoreKeyMap(km canBindKey) {
-	debug("restoreKeyMap")
-	for i, command := range M.saveMap {
-		km.BindKey(keys.Code(string(rune(i))), command)
-	}
+// savedCommand returns the command of the host application bound to key
+// in the keymap of the editor, or nil.
+func (M *Mode) savedCommand(X any, key keys.Code) rl.Command {
+	command, _ := M.hostKeyMap(X).Lookup(key)
+	return command
+}
+
+func (M *Mode) restoreKeyMap(km KeyBinder) {
+	M.debugf("restoreKeyMap")
+	M.popLayer(km)
+	st := M.stateOf(km)
+	st.active = false
+	st.mode = StateLatin
 }
 
 func (M *Mode) cmdLatinMode(ctx context.Context, B *rl.Buffer) rl.Result {
-	debug("cmdLatinMode")
+	M.debugf("cmdLatinMode")
 	M.restoreKeyMap(B)
 	M.message(B, msgLatin)
+	M.notify(StateLatin)
 	return rl.CONTINUE
 }
 
 func (M *Mode) cmdAcceptLineWithLatinMode(ctx context.Context, B *rl.Buffer) rl.Result {
-	if M.saveMap != nil {
+	M.stripMarkers(surfaceOf(B))
+	if M.stateOf(B).active {
 		M.restoreKeyMap(B)
 		M.message(B, msgLatin)
+		M.notify(StateLatin)
 	}
 	return rl.ENTER
 }
 
-func (M *Mode) cmdIntrruptWithLatinMode(ctx context.Context, B *rl.Buffer) rl.Result {
-	if M.saveMap != nil {
-		M.restoreKeyMap(B)
-		M.message(B, msgLatin)
+// interruptHenkan leaves the reading of the conversion at markerPos
+// without the marker and interrupts the editor.
+func (M *Mode) interruptHenkan(ctx context.Context, B *rl.Buffer, markerPos int, source, postfix string) rl.Result {
+	B.ReplaceAndRepaint(markerPos, typedReading(source, postfix))
+	return M.cmdInterrupt(ctx, B)
+}
+
+// typedReading returns the reading of the conversion as typed:
+// the consonant of the okurigana at the end of source is replaced
+// with the kana typed.
+func typedReading(source, postfix string) string {
+	if postfix == "" {
+		return source
 	}
-	return rl.INTR
+	return source[:len(source)-1] + postfix
+}
+
+// _Okuri is the midashi restored with the okurigana by the cancel of
+// a conversion. While the text after ▽ is not changed, it is converted
+// again with the okurigana.
+type _Okuri struct {
+	buffer  *rl.Buffer
+	text    string
+	source  string
+	postfix string
+}
+
+// restoreMidashi returns the conversion at markerPos to ▽ with the
+// reading typed before it started.
+func (M *Mode) restoreMidashi(B *rl.Buffer, markerPos int, source, postfix string) {
+	text := M.white() + typedReading(source, postfix)
+	B.ReplaceAndRepaint(markerPos, text)
+	okuri := _Okuri{}
+	if postfix != "" {
+		okuri = _Okuri{buffer: B, text: text, source: source, postfix: postfix}
+	}
+	M.stateOf(B).okuri = okuri
+	M.notify(StateMarkerWhite)
 }
 
-func hanToZen(c rune) rune {
-	if c < ' ' || c >= '\x7f' {
-		return c
+func (M *Mode) cmdInterrupt(ctx context.Context, B *rl.Buffer) rl.Result {
+	if M.seekMarker(surfaceOf(B)) >= 0 {
+		M.stripMarkers(surfaceOf(B))
+		M.notify(M.kanaState(B))
+	}
+	// ホストが Ctrl-C に独自のコマンドを割り当てている場合はそれを呼ぶ
+	if command := M.savedCommand(B, keys.CtrlC); command != nil && command.String() != "SKK_INTERRUPT" {
+		return command.Call(ctx, B)
 	}
-	if c == ' ' {
-		return '　'
+	if command, ok := rl.GlobalKeyMap.Lookup(keys.CtrlC); ok && command.String() != "SKK_INTERRUPT" {
+		return command.Call(ctx, B)
 	}
-	return c - ' ' + '\uFF00'
+	return rl.INTR
 }
 
-func (M *Mode) cmdJis0208LatinMode(ctx context.Context, B *rl.Buffer) rl.Result {
-	for i := rune(' '); i < '\x7F'; i++ {
-		z := string(hanToZen(i))
-		B.BindKey(keys.Code(string(i)), &rl.GoCommand{
-			Name: "SKK_JISX0208_LATIN_INSERT_" + z,
-			Func: func(_ context.Context, B *rl.Buffer) rl.Result {
-				B.InsertAndRepaint(z)
-				return rl.CONTINUE
-			}})
+// reset puts the editor of B back to a consistent state: the markers
+// left in the line are removed, and the keymap of the editor is made
+// the layer of the current kana mode, or the keymap of the host
+// application when SKK is not active.
+func (M *Mode) reset(B *rl.Buffer) {
+	M.stripMarkers(surfaceOf(B))
+	st := M.stateOf(B)
+	st.source = ""
+	st.okuri = _Okuri{}
+	if !st.active {
+		M.restoreKeyMap(B)
+		M.notify(StateLatin)
+		return
 	}
-	B.BindKey(keys.CtrlJ, &rl.GoCommand{
-		Name: "SKK_JISX0208_LATIN_KAKUTEI",
-		Func: func(ctx context.Context, B *rl.Buffer) rl.Result {
-			M.restoreKeyMap(B)
-			M.enable(B, hiragana)
+	M.enable(B, st.kana)
+	M.notify(M.kanaState(B))
+}
+
+func (M *Mode) cmdReset(ctx context.Context, B *rl.Buffer) rl.Result {
+	M.debugf("cmdReset")
+	M.reset(B)
+	if M.stateOf(B).active {
+		if M.kanaState(B) == StateKatakana {
+			M.message(B, msgKatakana)
+		} else {
 			M.message(B, msgHiragana)
-			return rl.CONTINUE
-		},
-	})
+		}
+	}
+	return rl.CONTINUE
+}
+
+func (M *Mode) cmdIntrruptWithLatinMode(ctx context.Context, B *rl.Buffer) rl.Result {
+	if M.stateOf(B).active {
+		M.restoreKeyMap(B)
+		M.message(B, msgLatin)
+		M.notify(StateLatin)
+	}
+	return rl.INTR
+}
+
+func (M *Mode) cmdJis0208LatinMode(ctx context.Context, B *rl.Buffer) rl.Result {
+	M.pushLayer(B, M.jisx0208Layer(B))
+	M.stateOf(B).mode = StateJisx0208Latin
 	M.message(B, msg0208)
+	M.notify(StateJisx0208Latin)
 	return rl.CONTINUE
 }
@@ -1,7 +1,27 @@
+//go:build !js && !plan9
+
 package skk
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	rl "github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
 )
 
 func TestHanToZen(t *testing.T) {
@@ -17,6 +37,13 @@ func TestHanToZen(t *testing.T) {
 		' ': '　',
 		'[': '［',
 		'|': '｜',
+		'"': '”',
+		'~': '￣',
+		'¥': '￥',
+		'ｶ': 'カ',
+		'ﾞ': '゛',
+		'é': 'é',
+		'あ': 'あ',
 	}
 
 	for source, expect := range list {
@@ -28,3 +55,639 @@ func TestHanToZen(t *testing.T) {
 		}
 	}
 }
+
+func TestHanToZenString(t *testing.T) {
+	if s := hanToZenString("ｶﾞﾊﾟｳﾞｱﾞ1 ｰ"); s != "ガパヴア゛１　ー" {
+		t.Fatalf("%q", s)
+	}
+}
+
+func TestCodeToRune(t *testing.T) {
+	for code, expected := range map[string]rune{
+		"2422":    'あ',
+		"a4a2":    'あ',
+		"A4A2":    'あ',
+		"2121":    '　',
+		"u3042":   'あ',
+		"U+1F490": '💐',
+		" 2422 ":  'あ',
+	} {
+		if r, ok := codeToRune(code); !ok || r != expected {
+			t.Fatalf("%q: %q %v", code, r, ok)
+		}
+	}
+	// 未定義の区点, 制御文字, 範囲外の符号は文字にしない
+	for _, code := range []string{"", "222f", "2420", "7f7f", "242", "u", "u+", "u0007", "ud800", "u110000", "zzzz"} {
+		if r, ok := codeToRune(code); ok {
+			t.Fatalf("%q: %q", code, r)
+		}
+	}
+	if symbols := jisSymbols(); symbols[0] != "　" || symbols[9] != "！" {
+		t.Fatalf("%q", symbols[:10])
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	for _, c := range []struct {
+		date     time.Time
+		format   string
+		expected string
+	}{
+		{time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local), DefaultDateFormats[0], "令和6年6月1日(土)"},
+		{time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local), DefaultDateFormats[1], "2024年6月1日(土)"},
+		{time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local), DefaultDateFormats[2], "2024-06-01"},
+		// 改元の日から新しい元号の元年になる
+		{time.Date(2019, 4, 30, 23, 59, 0, 0, time.Local), "{gengo}{nen}年", "平成31年"},
+		{time.Date(2019, 5, 1, 0, 0, 0, 0, time.Local), "{gengo}{nen}年", "令和元年"},
+		{time.Date(1989, 1, 7, 0, 0, 0, 0, time.Local), "{gengo}{nen}年", "昭和64年"},
+		// 元号の年の数字は時刻のレイアウトにしない
+		{time.Date(2023, 1, 2, 0, 0, 0, 0, time.Local), "{nen}/1/2 15:04", "5/1/2 00:00"},
+	} {
+		if s := FormatDate(c.date, c.format); s != c.expected {
+			t.Fatalf("%v %q: %q expected %q", c.date, c.format, s, c.expected)
+		}
+	}
+	M := New()
+	M.DateFormats = []string{"2006.01.02"}
+	if dates := M.Today(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)); len(dates) != 1 || dates[0] != "2024.06.01" {
+		t.Fatalf("%q", dates)
+	}
+}
+
+func TestNonASCIIKeys(t *testing.T) {
+	K := &_Kana{table: map[string]string{"ä": "え", "kö": "こ"}}
+	if triggers := K.triggers(); !slices.Contains(triggers, "ä") || !slices.Contains(triggers, "ö") {
+		t.Fatalf("%q", triggers)
+	}
+	// 名前のあるキーに割り当てたホストのコマンドは SKK の間も使える
+	M := New()
+	var editor rl.Editor
+	editor.BindKey(keys.AltF, rl.CmdForwardWord)
+	editor.BindKey(keys.F5, rl.CmdRepaintOnNewline)
+	M.enable(&editor, M.kanas()[0])
+	for _, key := range []keys.Code{keys.AltF, keys.F5} {
+		if c, ok := editor.Lookup(key); !ok || c == nil {
+			t.Fatalf("%q is lost", key)
+		}
+	}
+}
+
+func TestRegistrationPrompt(t *testing.T) {
+	if p := registrationPrompt(0, "かんじ", ""); p != "[辞書登録] かんじ" {
+		t.Fatalf("okuri-nasi: %s", p)
+	}
+	if p := registrationPrompt(1, "かんj", "じ"); p != "[[辞書登録]] かん*じ" {
+		t.Fatalf("okuri-ari: %s", p)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	M := New()
+	M.System["かんじ"] = []string{"漢字", "感じ;feeling"}
+	M.System["かk"] = []string{"書", "欠"}
+	M.System["#じ"] = []string{"#1時", "#0時"}
+
+	result, err := M.Convert("かんじ")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(result) != 2 || result[1] != (Candidate{Text: "感じ", Annotation: "feeling"}) {
+		t.Fatalf("%#v", result)
+	}
+	result, err = M.Convert("か*く")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(result) != 2 || result[0].Text != "書く" {
+		t.Fatalf("%#v", result)
+	}
+	result, err = M.Convert("3じ")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(result) != 2 || result[0].Text != "３時" || result[1].Text != "3時" {
+		t.Fatalf("%#v", result)
+	}
+	if _, err := M.Convert("ない"); err != ErrNoCandidate {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+func TestWithReset(t *testing.T) {
+	var buffer strings.Builder
+	withReset(rl.SGR2(31, 44)).WriteTo(&buffer)
+	if s := buffer.String(); s != "\x1B[0;31;44m" {
+		t.Fatalf("%q", s)
+	}
+	if withReset(rl.SGR4(1, 4, 31, 44)) != rl.ColorReset || withReset(rl.ColorSequence(0)) != rl.ColorReset {
+		t.Fatal("not reset")
+	}
+}
+
+type testSource map[string][]string
+
+func (t testSource) Lookup(source string) ([]string, bool) {
+	list, ok := t[source]
+	return list, ok
+}
+
+func (t testSource) Complete(prefix string) []string {
+	var result []string
+	for key := range t {
+		if strings.HasPrefix(key, prefix) {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+func TestSources(t *testing.T) {
+	M := New()
+	M.User["かんじ"] = []string{"幹事"}
+	M.System["かんじょう"] = []string{"感情"}
+	M.Sources = []CandidateSource{
+		M.User,
+		testSource{"かんじ": {"漢字"}, "かんがえ": {"考え"}},
+		M.System,
+	}
+	if list, ok := M.lookup("かんじ"); !ok || list[0] != "幹事" {
+		t.Fatalf("%v %v", list, ok)
+	}
+	if list, ok := M.lookup("かんがえ"); !ok || list[0] != "考え" {
+		t.Fatalf("%v %v", list, ok)
+	}
+	got := strings.Join(M.Complete("かん"), " ")
+	if got != "かんがえ かんじ かんじょう" {
+		t.Fatalf("Complete: %s", got)
+	}
+}
+
+func TestRegisterNumConv(t *testing.T) {
+	M := New()
+	M.System["#ねん"] = []string{"#1年", "#7年"}
+	M.RegisterNumConv('7', func(number string) string {
+		return "令和" + number
+	})
+	list, ok := M.lookup("5ねん")
+	if !ok || len(list) != 2 || list[0] != "５年" || list[1] != "令和5年" {
+		t.Fatalf("%#v", list)
+	}
+}
+
+type testTerminal struct{}
+
+func (testTerminal) CursorUp(w io.Writer) (int, error)   { return io.WriteString(w, "<UP>") }
+func (testTerminal) CursorDown(w io.Writer) (int, error) { return io.WriteString(w, "<DOWN>") }
+func (testTerminal) PrevLine(w io.Writer) (int, error)   { return io.WriteString(w, "<PREV>") }
+func (testTerminal) EraseLine(w io.Writer) (int, error)  { return io.WriteString(w, "<ERASE>") }
+func (testTerminal) EraseToEnd(w io.Writer) (int, error) { return io.WriteString(w, "<EOL>") }
+
+func TestMiniBufferTerminal(t *testing.T) {
+	var buffer strings.Builder
+	var mb MiniBuffer = MiniBufferOnPrevLine{Terminal: testTerminal{}}
+	mb.Enter(&buffer, "prompt")
+	mb.Leave(&buffer)
+	mb = mb.Recurse("prompt")
+	mb.Enter(&buffer, "nested")
+	mb.Leave(&buffer)
+	if s := buffer.String(); s != "<UP>\rprompt <DOWN>\rnested \rprompt <EOL>" {
+		t.Fatalf("%q", s)
+	}
+}
+
+func TestCommandNames(t *testing.T) {
+	commands := New().commands()
+	if len(commands) != len(commandNames) {
+		t.Fatalf("commands: %d, commandNames: %d", len(commands), len(commandNames))
+	}
+	for _, name := range commandNames {
+		if _, ok := commands[name]; !ok {
+			t.Fatalf("%q: not a command", name)
+		}
+	}
+}
+
+func TestControl(t *testing.T) {
+	M := New()
+	path := filepath.Join(t.TempDir(), "skk.sock")
+	if err := M.ListenControl(path); err != nil {
+		t.Skip(err.Error())
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for _, p := range [][2]string{
+		{"stats", "ok conversions=0 registrations=0 purges=0 pageviews=0\n"},
+		{"state", "ok mode=Latin pending=Latin loading=false reading=\n"},
+		{"hiragana", "error no editor is using SKK\n"},
+		{"foo", "error \"foo\": unknown request\n"},
+	} {
+		fmt.Fprintln(conn, p[0])
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if line != p[1] {
+			t.Fatalf("%s: %q", p[0], line)
+		}
+	}
+	if err := M.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("%s is not removed", path)
+	}
+}
+
+func TestListenControlInUse(t *testing.T) {
+	dir := t.TempDir()
+	// ソケットでないファイルは消さない
+	path := filepath.Join(dir, "file")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := New().ListenControl(path); err == nil {
+		t.Fatal("the file is replaced")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err.Error())
+	}
+	// 使用中のソケットも消さない
+	path = filepath.Join(dir, "skk.sock")
+	M := New()
+	if err := M.ListenControl(path); err != nil {
+		t.Skip(err.Error())
+	}
+	defer M.Close()
+	if err := New().ListenControl(path); err == nil {
+		t.Fatal("the socket in use is replaced")
+	}
+	if conn, err := net.Dial("unix", path); err != nil {
+		t.Fatal(err.Error())
+	} else {
+		conn.Close()
+	}
+}
+
+func TestTutorialJisyo(t *testing.T) {
+	M := New()
+	for source, list := range tutorialJisyo {
+		M.System[source] = list
+	}
+	for _, p := range [][2]string{{"かんじ", "漢字"}, {"かんじ", "感じ"}, {"か*く", "書く"}} {
+		candidates, err := M.Convert(p[0])
+		if err != nil {
+			t.Fatalf("%s: %v", p[0], err)
+		}
+		if !slices.ContainsFunc(candidates, func(c Candidate) bool { return c.Text == p[1] }) {
+			t.Fatalf("%s: %v", p[0], candidates)
+		}
+	}
+	if _, err := M.Convert("すきる"); err != ErrNoCandidate {
+		t.Fatalf("すきる: %v", err)
+	}
+}
+
+func TestCommandSource(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip(err.Error())
+	}
+	M := New()
+	M.Sources = []CandidateSource{
+		M.User,
+		&CommandSource{Path: sh, Args: []string{"-c", `read r; [ "$r" = "えーあい" ] && printf '人工知能\nAI\n'`}},
+	}
+	if list, ok := M.lookup("えーあい"); !ok || len(list) != 2 || list[0] != "人工知能" {
+		t.Fatalf("%v %v", list, ok)
+	}
+	if list, ok := M.lookup("なし"); ok {
+		t.Fatalf("%v", list)
+	}
+}
+
+func TestRemoteTimeout(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip(err.Error())
+	}
+	M := New()
+	M.System["えーあい"] = []string{"AI"}
+	M.Sources = []CandidateSource{
+		&CommandSource{Path: sh, Args: []string{"-c", "sleep 10"}, Timeout: time.Minute},
+		M.System,
+	}
+	M.RemoteTimeout = 100 * time.Millisecond
+	start := time.Now()
+	if list, ok := M.lookup("えーあい"); !ok || len(list) != 1 || list[0] != "AI" {
+		t.Fatalf("%v %v", list, ok)
+	}
+	if elapsed := time.Since(start); elapsed >= 5*time.Second {
+		t.Fatalf("waited %v", elapsed)
+	}
+}
+
+func TestHTTPSource(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var req struct{ Reading string }
+		json.NewDecoder(r.Body).Decode(&req)
+		switch req.Reading {
+		case "えすえすえいち":
+			io.WriteString(w, `{"candidates":["SSH"]}`)
+		case "じぇいそん":
+			io.WriteString(w, `["JSON","ジェイソン"]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	h := &HTTPSource{URL: server.URL, CacheTTL: time.Minute}
+	for i := 0; i < 2; i++ {
+		if list, ok := h.Lookup("えすえすえいち"); !ok || len(list) != 1 || list[0] != "SSH" {
+			t.Fatalf("%v %v", list, ok)
+		}
+		if list, ok := h.Lookup("じぇいそん"); !ok || len(list) != 2 || list[1] != "ジェイソン" {
+			t.Fatalf("%v %v", list, ok)
+		}
+		if list, ok := h.Lookup("なし"); ok {
+			t.Fatalf("%v", list)
+		}
+	}
+	if requests != 3 {
+		t.Fatalf("requests: %d", requests)
+	}
+}
+
+func TestHTTPSourceTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `["SSH"]`)
+	}))
+	defer server.Close()
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}
+	if err := os.WriteFile(ca, pem.EncodeToMemory(block), 0666); err != nil {
+		t.Fatal(err.Error())
+	}
+	config, err := NewTLSConfig(ca)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	h := &HTTPSource{URL: server.URL, TLSConfig: config}
+	if list, ok := h.Lookup("えすえすえいち"); ok {
+		t.Fatalf("without the token: %v", list)
+	}
+	h = &HTTPSource{URL: server.URL, TLSConfig: config, Token: "secret"}
+	if list, ok := h.Lookup("えすえすえいち"); !ok || list[0] != "SSH" {
+		t.Fatalf("%v %v", list, ok)
+	}
+	if _, err := NewTLSConfig(filepath.Join(t.TempDir(), "not-exist")); err == nil {
+		t.Fatal("the CA file not found was accepted")
+	}
+}
+
+func TestBindingCache(t *testing.T) {
+	M := New()
+	var editor rl.Editor
+	M.enable(&editor, M.kanas()[0])
+	c1, _ := editor.Lookup("a")
+	M.restoreKeyMap(&editor)
+	M.enable(&editor, M.kanas()[0])
+	c2, _ := editor.Lookup("a")
+	if c1 == nil || c1 != c2 {
+		t.Fatalf("the commands were made again: %v %v", c1, c2)
+	}
+	if j1, j2 := M.jisx0208Bindings(), M.jisx0208Bindings(); len(j1) != len(jisx0208Keys())+1 || &j1[0] != &j2[0] {
+		t.Fatalf("jisx0208Bindings: %d", len(j1))
+	}
+}
+
+func TestKeyLayer(t *testing.T) {
+	M := New()
+	var editor rl.Editor
+	host := &rl.GoCommand{Name: "HOST_CTRL_E"}
+	editor.BindKey(keys.CtrlE, host)
+
+	M.enable(&editor, M.kanas()[0])
+	if c, _ := editor.Lookup(keys.CtrlE); c != host {
+		t.Fatalf("the host binding is not seen in the kana mode: %v", c)
+	}
+	layer := M.kanaLayer(&editor, M.kanas()[0])
+	M.enable(&editor, M.kanas()[1])
+	M.enable(&editor, M.kanas()[0])
+	if M.kanaLayer(&editor, M.kanas()[0]) != layer {
+		t.Fatal("the layer was made again")
+	}
+	if c := M.savedCommand(&editor, keys.CtrlE); c != host {
+		t.Fatalf("savedCommand: %v", c)
+	}
+	M.restoreKeyMap(&editor)
+	if c, ok := editor.Lookup("a"); ok {
+		t.Fatalf("the binding of SKK is left: %v", c)
+	}
+	if c, _ := editor.Lookup(keys.CtrlE); c != host {
+		t.Fatalf("the host binding is lost: %v", c)
+	}
+
+	M.KeyBindings = map[keys.Code]string{keys.CtrlE: "SKK_LATIN_MODE"}
+	M.enable(&editor, M.kanas()[0])
+	if c, _ := editor.Lookup(keys.CtrlE); c == host || c == nil {
+		t.Fatalf("the changed KeyBindings are not used: %v", c)
+	}
+	M.restoreKeyMap(&editor)
+}
+
+func TestSubEditor(t *testing.T) {
+	M := New()
+	B := &rl.Buffer{Editor: &rl.Editor{}}
+	sub := M.subEditor(B, "登録:")
+	m := M.subMode(sub)
+	if again := M.subEditor(B, "辞書編集:"); again != sub || M.subMode(again) != m || again.prompt != "辞書編集:" {
+		t.Fatal("the sub editor was made again")
+	}
+	sub.busy = true
+	if nested := M.subEditor(B, "登録:"); nested == sub {
+		t.Fatal("the sub editor in use was reused")
+	}
+	if m.depth != M.depth+1 {
+		t.Fatalf("depth=%d", m.depth)
+	}
+}
+
+// sizedTty is the terminal of 80 columns for the tests only asking its size.
+type sizedTty struct {
+	rl.ITty
+}
+
+func (sizedTty) Size() (int, int, error) {
+	return 80, 25, nil
+}
+
+func TestFitToTerminal(t *testing.T) {
+	B := &rl.Buffer{Editor: &rl.Editor{Tty: sizedTty{}}}
+	for _, s := range []string{
+		"short",
+		strings.Repeat("a", 78),
+		strings.Repeat("a", 79),
+		strings.Repeat("あ", 39),
+		"x" + strings.Repeat("あ", 39),
+		"A:候補1(注釈) S:候補2(注釈) D:候補3(注釈) F:候補4(注釈) J:候補5(注釈) K:候補6(注釈) [残り 10]",
+		"か\u3099" + strings.Repeat("が", 40),
+		"👨\u200d👩\u200d👧" + strings.Repeat("絵", 40),
+	} {
+		want := s
+		if widthCondition.StringWidth(s) > 78 {
+			want = widthCondition.Truncate(s, 78, "..")
+		}
+		if got := fitToTerminal(B, s); got != want {
+			t.Fatalf("%q:\n%q\nexpected %q", s, got, want)
+		}
+		if stringWidth(s) != widthCondition.StringWidth(s) {
+			t.Fatalf("stringWidth(%q)=%d", s, stringWidth(s))
+		}
+	}
+}
+
+func TestEnterMiniBuffer(t *testing.T) {
+	var buffer strings.Builder
+	M := New()
+	M.Terminal = testTerminal{}
+	M.MiniBuffer = MiniBufferOnNextLine{Terminal: testTerminal{}}
+	B := &rl.Buffer{Editor: &rl.Editor{Tty: sizedTty{}, Out: bufio.NewWriter(&buffer)}}
+	M.enterMiniBuffer(B, strings.Repeat("a", 80))
+	B.Out.Flush()
+	if s := buffer.String(); s != "\n"+strings.Repeat("a", 76)+".. <EOL>" {
+		t.Fatalf("%q", s)
+	}
+}
+
+// chanTty is the terminal reading the runes sent to its channel.
+// ReadRune waits for them as a real terminal does.
+type chanTty struct {
+	rl.ITty
+	runes chan rune
+}
+
+func newChanTty() *chanTty {
+	return &chanTty{runes: make(chan rune, 64)}
+}
+
+func (*chanTty) Raw() (func() error, error) {
+	return func() error { return nil }, nil
+}
+
+func (T *chanTty) ReadRune() (rune, error) {
+	r, ok := <-T.runes
+	if !ok {
+		return 0, io.EOF
+	}
+	return r, nil
+}
+
+func (T *chanTty) Buffered() bool {
+	return len(T.runes) > 0
+}
+
+func (T *chanTty) send(s string) {
+	for _, r := range s {
+		T.runes <- r
+	}
+}
+
+func TestGetKeyCanceled(t *testing.T) {
+	tty := newChanTty()
+	defer close(tty.runes)
+	M := New()
+	B := &rl.Buffer{Editor: &rl.Editor{
+		Tty: tty,
+		Out: bufio.NewWriter(io.Discard),
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := M.getKey(ctx, B); err != context.DeadlineExceeded {
+		t.Fatalf("%v", err)
+	}
+	// 中断された読み込みのキーは次の読み込みで返る
+	for _, want := range []string{"a", "b"} {
+		tty.send(want)
+		if key, err := M.getKey(context.Background(), B); err != nil || key != want {
+			t.Fatalf("%q %v: expected %q", key, err, want)
+		}
+	}
+}
+
+func TestPasteTty(t *testing.T) {
+	tty := newChanTty()
+	defer close(tty.runes)
+	tty.send(pasteStart + "ab" + pasteEnd + string(keys.CtrlDown) + string(keys.Delete))
+	B := &rl.Buffer{Editor: &rl.Editor{
+		Tty: &PasteTty{ITty: tty},
+		Out: bufio.NewWriter(io.Discard),
+	}}
+	var got []string
+	for range 4 {
+		key, err := B.GetKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, key)
+	}
+	expected := []string{pasteStart, "a", "b", pasteEnd}
+	if !slices.Equal(got, expected) {
+		t.Fatalf("%q: expected %q", got, expected)
+	}
+	for _, want := range []keys.Code{keys.CtrlDown, keys.Delete} {
+		if key, _ := B.GetKey(); key != string(want) {
+			t.Fatalf("%q: expected %q", key, want)
+		}
+	}
+
+	text, err := readPaste(got[0], func() (string, error) {
+		if len(got) <= 1 {
+			return "", io.EOF
+		}
+		got = got[1:]
+		return got[0], nil
+	})
+	if text != "ab" || err != nil {
+		t.Fatalf("%q %v", text, err)
+	}
+}
+
+func TestReset(t *testing.T) {
+	M := New()
+	B := &rl.Buffer{Editor: &rl.Editor{Tty: sizedTty{}, Out: bufio.NewWriter(io.Discard)}}
+	B.Editor.Coloring = M.Coloring(B.Editor, nil)
+	M.enable(B, M.kanas()[1])
+	// 変換の途中で抜けて ▼ が残り、キーマップが戻されてしまった状態
+	B.InsertAndRepaint(M.black() + "漢字")
+	B.Editor.KeyMap = rl.KeyMap{}
+
+	M.cmdReset(context.Background(), B)
+	if text := B.String(); text != "漢字" {
+		t.Fatalf("%q", text)
+	}
+	if c, ok := B.Editor.Lookup("a"); !ok || c == nil {
+		t.Fatal("the keymap of the kana mode is not installed")
+	}
+	if st := M.stateOf(B); !st.active || st.mode != StateKatakana {
+		t.Fatalf("%#v", st.mode)
+	}
+
+	M.restoreKeyMap(B)
+	M.pushLayer(B, M.abbrevLayer(B))
+	M.cmdReset(context.Background(), B)
+	if c, ok := B.Editor.Lookup("a"); ok {
+		t.Fatalf("the binding of SKK is left: %v", c)
+	}
+}
@@ -0,0 +1,198 @@
+package skk
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// MappedJisyo is CandidateSource which maps a sorted dictionary file
+// into the memory and looks up the entries by the binary search.
+// The candidates are copied only when they are looked up,
+// so that the resident memory does not grow with the dictionary.
+//
+// The lines of the file except the comments at the top must be sorted
+// by the bytes of the midashi, as written by Jisyo.WriteSortedTo.
+// The encoding is UTF-8 when the first line has the pragma
+// `-*- coding: utf-8 -*-`, otherwise EUC-JP.
+type MappedJisyo struct {
+	data   []byte
+	start  int
+	utf8   bool
+	unmap  func() error
+	closed bool
+	// mutex keeps Close from unmapping data while it is read.
+	mutex sync.RWMutex
+}
+
+// OpenMappedJisyo maps the sorted dictionary filename.
+// Close it when it is not used.
+func OpenMappedJisyo(filename string) (*MappedJisyo, error) {
+	fd, err := os.Open(expandEnv(filename))
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	stat, err := fd.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, unmap, err := mapFile(fd, int(stat.Size()))
+	if err != nil {
+		return nil, err
+	}
+	m := &MappedJisyo{data: data, unmap: unmap}
+	if first, _, _ := bytes.Cut(data, []byte{'\n'}); len(first) > 0 && first[0] == ';' {
+		if p := pragma(string(first[1:])); p != nil && p["coding"] == "utf-8" {
+			m.utf8 = true
+		}
+	}
+	// 先頭のコメント行を飛ばす
+	for m.start < len(data) && (data[m.start] == ';' || data[m.start] == '\n') {
+		end := bytes.IndexByte(data[m.start:], '\n')
+		if end < 0 {
+			m.start = len(data)
+			break
+		}
+		m.start += end + 1
+	}
+	return m, nil
+}
+
+// Close unmaps the file.
+func (m *MappedJisyo) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	return m.unmap()
+}
+
+func (m *MappedJisyo) encode(s string) ([]byte, bool) {
+	if m.utf8 {
+		return []byte(s), true
+	}
+	b, err := japanese.EUCJP.NewEncoder().Bytes([]byte(s))
+	return b, err == nil
+}
+
+func (m *MappedJisyo) decode(b []byte) string {
+	if m.utf8 {
+		return string(b)
+	}
+	s, err := japanese.EUCJP.NewDecoder().Bytes(b)
+	if err != nil {
+		return string(b)
+	}
+	return string(s)
+}
+
+// line returns the line starting at pos and the start of the next line.
+func (m *MappedJisyo) line(pos int) ([]byte, int) {
+	end := bytes.IndexByte(m.data[pos:], '\n')
+	if end < 0 {
+		return bytes.TrimSuffix(m.data[pos:], []byte{'\r'}), len(m.data)
+	}
+	return bytes.TrimSuffix(m.data[pos:pos+end], []byte{'\r'}), pos + end + 1
+}
+
+// midashiOf returns the midashi of line.
+func midashiOf(line []byte) []byte {
+	k, _, _ := bytes.Cut(line, []byte(" /"))
+	return k
+}
+
+// search returns the start of the first line whose midashi is not less than target.
+func (m *MappedJisyo) search(target []byte) int {
+	lo, hi := m.start, len(m.data)
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		pos := bytes.LastIndexByte(m.data[lo:mid], '\n') + 1 + lo
+		line, next := m.line(pos)
+		if bytes.Compare(midashiOf(line), target) < 0 {
+			lo = next
+		} else {
+			hi = pos
+		}
+	}
+	return lo
+}
+
+// Lookup returns the candidates for source.
+func (m *MappedJisyo) Lookup(source string) ([]string, bool) {
+	target, ok := m.encode(source)
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if !ok || m.closed {
+		return nil, false
+	}
+	var list []string
+	found := false
+	for pos := m.search(target); pos < len(m.data); {
+		line, next := m.line(pos)
+		if !bytes.Equal(midashiOf(line), target) {
+			break
+		}
+		pos = next
+		// 壊れた行は読み飛ばす
+		if _, lists, kind := parseLine(m.decode(line)); kind == lineEntry {
+			found = true
+			list = append(list, splitCandidates(lists)...)
+		}
+	}
+	return list, found
+}
+
+// Complete returns the sorted midashi starting with prefix.
+func (m *MappedJisyo) Complete(prefix string) []string {
+	target, ok := m.encode(prefix)
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if !ok || m.closed {
+		return nil
+	}
+	var result []string
+	for pos := m.search(target); pos < len(m.data); {
+		line, next := m.line(pos)
+		k := midashiOf(line)
+		if !bytes.HasPrefix(k, target) {
+			break
+		}
+		if s := m.decode(k); len(result) <= 0 || result[len(result)-1] != s {
+			result = append(result, s)
+		}
+		pos = next
+	}
+	return result
+}
+
+// HasPrefixIndex returns true since Complete uses the binary search.
+func (m *MappedJisyo) HasPrefixIndex() bool {
+	return true
+}
+
+// WriteSortedTo outputs the contents of the dictionary with UTF-8
+// sorted by the midashi, which OpenMappedJisyo can use.
+func (j Jisyo) WriteSortedTo(w io.Writer) (n int64, err error) {
+	keys := make([]string, 0, len(j))
+	for key := range j {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var wc writeCounter
+	if wc.Try(io.WriteString(w, ";; -*- coding: utf-8 -*-\n")) {
+		return wc.Result()
+	}
+	for _, key := range keys {
+		if wc.Try64(dumpPair(key, j[key], w)) {
+			return wc.Result()
+		}
+	}
+	return wc.Result()
+}
@@ -0,0 +1,51 @@
+package skk
+
+// Metrics is the statistics of the usage of SKK like skk-record of ddskk.
+type Metrics struct {
+	// Conversions is the number of the conversions confirmed.
+	Conversions int
+	// Registrations is the number of the words registered.
+	Registrations int
+	// Purges is the number of the candidates purged.
+	Purges int
+	// PageViews is the number of the pages of the candidate listing shown.
+	PageViews int
+	// KeyStrokes is the number of the keys typed in each state.
+	// The keys typed in StateLatin and StateAbbrev are not counted
+	// because they are processed by the editor without SKK.
+	KeyStrokes map[State]int
+}
+
+// Metrics returns a copy of the statistics since M was created.
+// It can be called while ReadLine is running in another goroutine.
+func (M *Mode) Metrics() Metrics {
+	M.metricsMutex.Lock()
+	defer M.metricsMutex.Unlock()
+	m := M.metrics
+	m.KeyStrokes = make(map[State]int, len(M.metrics.KeyStrokes))
+	for s, n := range M.metrics.KeyStrokes {
+		m.KeyStrokes[s] = n
+	}
+	return m
+}
+
+// count updates the statistics with f.
+func (M *Mode) count(f func(*Metrics)) {
+	if M == nil {
+		return
+	}
+	M = M.root()
+	M.metricsMutex.Lock()
+	defer M.metricsMutex.Unlock()
+	f(&M.metrics)
+}
+
+// countKey counts one key typed in the state s.
+func (M *Mode) countKey(s State) {
+	M.count(func(m *Metrics) {
+		if m.KeyStrokes == nil {
+			m.KeyStrokes = map[State]int{}
+		}
+		m.KeyStrokes[s]++
+	})
+}
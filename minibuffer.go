@@ -1,11 +1,8 @@
 package skk
 
 import (
-	"context"
 	"fmt"
 	"io"
-
-	"github.com/nyaosorg/go-readline-ny"
 )
 
 type MiniBuffer interface {
@@ -14,7 +11,11 @@ type MiniBuffer interface {
 	Recurse(string) MiniBuffer
 }
 
-type MiniBufferOnNextLine struct{}
+// MiniBufferOnNextLine shows the minibuffer on the next line of the editline. (default)
+type MiniBufferOnNextLine struct {
+	// Terminal is the control of the terminal. When it is nil, ANSITerminal is used.
+	Terminal Terminal
+}
 
 func (MiniBufferOnNextLine) Enter(w io.Writer, prompt string) (int, error) {
 	// この prompt は MiniBufferOnNextLine → MiniBufferOnCurrentLine と呼び出してから戻る際、
@@ -24,66 +25,78 @@ func (MiniBufferOnNextLine) Enter(w io.Writer, prompt string) (int, error) {
 	return fmt.Fprintf(w, "\n%s ", prompt)
 }
 
-func (MiniBufferOnNextLine) Leave(w io.Writer) (int, error) {
-	return io.WriteString(w, "\x1B[F")
+func (q MiniBufferOnNextLine) Leave(w io.Writer) (int, error) {
+	return terminalOr(q.Terminal).PrevLine(w)
 }
 
 func (q MiniBufferOnNextLine) Recurse(originalPrompt string) MiniBuffer {
-	return &MiniBufferOnCurrentLine{OriginalPrompt: originalPrompt}
+	return &MiniBufferOnCurrentLine{OriginalPrompt: originalPrompt, Terminal: q.Terminal}
 }
 
-type MiniBufferOnCurrentLine struct {
-	OriginalPrompt string
+// MiniBufferOnPrevLine shows the minibuffer on the line above the editline.
+// Use it when the host application draws something under the editline.
+// The previous contents of that line are overwritten.
+type MiniBufferOnPrevLine struct {
+	// Terminal is the control of the terminal. When it is nil, ANSITerminal is used.
+	Terminal Terminal
 }
 
-func (q *MiniBufferOnCurrentLine) Enter(w io.Writer, prompt string) (int, error) {
-	return fmt.Fprintf(w, "\r%s ", prompt)
+func (q MiniBufferOnPrevLine) Enter(w io.Writer, prompt string) (int, error) {
+	n, err := terminalOr(q.Terminal).CursorUp(w)
+	if err != nil {
+		return n, err
+	}
+	m, err := fmt.Fprintf(w, "\r%s ", prompt)
+	return n + m, err
 }
 
-func (q *MiniBufferOnCurrentLine) Leave(w io.Writer) (int, error) {
-	return fmt.Fprintf(w, "\r%s \x1B[K", q.OriginalPrompt)
+func (q MiniBufferOnPrevLine) Leave(w io.Writer) (int, error) {
+	return terminalOr(q.Terminal).CursorDown(w)
 }
 
-func (q *MiniBufferOnCurrentLine) Recurse(originalPrompt string) MiniBuffer {
-	return &MiniBufferOnCurrentLine{OriginalPrompt: originalPrompt}
+func (q MiniBufferOnPrevLine) Recurse(originalPrompt string) MiniBuffer {
+	return &MiniBufferOnCurrentLine{OriginalPrompt: originalPrompt, Terminal: q.Terminal}
+}
+
+// MiniBufferPlacement is the policy where the minibuffer is shown.
+type MiniBufferPlacement int
+
+const (
+	// BelowTheLine shows the minibuffer on the next line of the editline. (default)
+	BelowTheLine MiniBufferPlacement = iota
+	// AboveTheLine shows the minibuffer on the previous line of the editline.
+	AboveTheLine
+)
+
+// SetMiniBufferPlacement replaces the minibuffer with the one for the placement p.
+func (M *Mode) SetMiniBufferPlacement(p MiniBufferPlacement) {
+	switch p {
+	case AboveTheLine:
+		M.MiniBuffer = MiniBufferOnPrevLine{Terminal: M.Terminal}
+	default:
+		M.MiniBuffer = MiniBufferOnNextLine{Terminal: M.Terminal}
+	}
 }
 
-func (M *Mode) message(B *readline.Buffer, text string) {
-	M.MiniBuffer.Enter(B.Out, text)
-	io.WriteString(B.Out, "\x1B[K")
-	M.MiniBuffer.Leave(B.Out)
-	B.RepaintAfterPrompt()
+type MiniBufferOnCurrentLine struct {
+	OriginalPrompt string
+	// Terminal is the control of the terminal. When it is nil, ANSITerminal is used.
+	Terminal Terminal
 }
 
-func (M *Mode) ask1(B *readline.Buffer, prompt string) (string, error) {
-	M.MiniBuffer.Enter(B.Out, prompt)
-	B.Out.Flush()
-	rc, err := B.GetKey()
-	io.WriteString(B.Out, "\x1B[2K")
-	M.MiniBuffer.Leave(B.Out)
-	B.RepaintAfterPrompt()
-	return rc, err
+func (q *MiniBufferOnCurrentLine) Enter(w io.Writer, prompt string) (int, error) {
+	return fmt.Fprintf(w, "\r%s ", prompt)
 }
 
-func (M *Mode) ask(ctx context.Context, B *readline.Buffer, prompt string, ime bool) (string, error) {
-	inputNewWord := &readline.Editor{
-		PromptWriter: func(w io.Writer) (int, error) {
-			return M.MiniBuffer.Enter(w, prompt)
-		},
-		Writer: B.Writer,
-		LineFeedWriter: func(_ readline.Result, w io.Writer) (int, error) {
-			io.WriteString(w, "\x1B[2K")
-			return M.MiniBuffer.Leave(w)
-		},
-	}
-	if ime {
-		m := &Mode{
-			User:       M.User,
-			System:     M.System,
-			MiniBuffer: M.MiniBuffer.Recurse(prompt),
-		}
-		m.enable(inputNewWord, hiragana)
+func (q *MiniBufferOnCurrentLine) Leave(w io.Writer) (int, error) {
+	n, err := fmt.Fprintf(w, "\r%s ", q.OriginalPrompt)
+	if err != nil {
+		return n, err
 	}
-	defer B.RepaintAfterPrompt()
-	return inputNewWord.ReadLine(ctx)
+	m, err := terminalOr(q.Terminal).EraseToEnd(w)
+	return n + m, err
+}
+
+func (q *MiniBufferOnCurrentLine) Recurse(originalPrompt string) MiniBuffer {
+	return &MiniBufferOnCurrentLine{OriginalPrompt: originalPrompt, Terminal: q.Terminal}
 }
@@ -0,0 +1,18 @@
+//go:build !unix && !windows
+
+package skk
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads the contents of fd into the memory
+// on the platforms without mmap support here.
+func mapFile(fd *os.File, size int) ([]byte, func() error, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(fd, data); err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package skk
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps the contents of fd into the memory read-only.
+func mapFile(fd *os.File, size int) ([]byte, func() error, error) {
+	if size <= 0 {
+		return nil, func() error { return nil }, nil
+	}
+	data, err := syscall.Mmap(int(fd.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
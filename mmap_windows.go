@@ -0,0 +1,29 @@
+//go:build windows
+
+package skk
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// mapFile maps the contents of fd into the memory read-only.
+func mapFile(fd *os.File, size int) ([]byte, func() error, error) {
+	if size <= 0 {
+		return nil, func() error { return nil }, nil
+	}
+	h, err := syscall.CreateFileMapping(syscall.Handle(fd.Fd()), nil, syscall.PAGE_READONLY, 0, 0, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	// ビューがマッピングを参照しているのでハンドルはすぐ閉じてよい
+	addr, err := syscall.MapViewOfFile(h, syscall.FILE_MAP_READ, 0, 0, uintptr(size))
+	syscall.CloseHandle(h)
+	if err != nil {
+		return nil, nil, err
+	}
+	// addr はマップされたメモリのアドレスで、GC の対象ではない
+	data := unsafe.Slice(*(**byte)(unsafe.Pointer(&addr)), size)
+	return data, func() error { return syscall.UnmapViewOfFile(addr) }, nil
+}
@@ -1,18 +1,22 @@
 package skk
 
 import (
-	"context"
 	"errors"
 	"io"
 	"os"
+	"slices"
+	"time"
 
-	rl "github.com/nyaosorg/go-readline-ny"
-	"github.com/nyaosorg/go-readline-ny/keys"
+	"golang.org/x/text/encoding/japanese"
 )
 
 // ErrJisyoNotFound is an error that means dictionary file not found
 var ErrJisyoNotFound = errors.New("Jisyo not found")
 
+// ErrJisyoChanged is an error that means the user dictionary file was
+// changed by others since loaded and overwriting it was not confirmed.
+var ErrJisyoChanged = errors.New("Jisyo was changed since loaded")
+
 // New creats an instance with empty dictionaries.
 func New() *Mode {
 	return &Mode{
@@ -28,7 +32,7 @@ func Load(userJisyoFname string, systemJisyoFnames ...string) (*Mode, error) {
 	jisyo := New()
 	var err error
 	if userJisyoFname != "" {
-		jisyo.User.Load(userJisyoFname)
+		jisyo.loadUserJisyo(userJisyoFname)
 	}
 	for _, fn := range systemJisyoFnames {
 		err = jisyo.System.Load(fn)
@@ -42,55 +46,103 @@ func Load(userJisyoFname string, systemJisyoFnames ...string) (*Mode, error) {
 	return nil, ErrJisyoNotFound
 }
 
-// String returns the name as the command starting SKK
-func (M *Mode) String() string {
-	return "SKK_MODE"
+// WriteTo outputs the user dictionary to w.
+// Please note that the character code is UTF8.
+func (M *Mode) WriteTo(w io.Writer) (n int64, err error) {
+	j := M.Snapshot()
+	return j.writeInOrder(w, slices.Values(M.recentKeys(j)))
 }
 
-// Call is readline.Command to start SKK henkan mode.
-func (M *Mode) Call(ctx context.Context, B *rl.Buffer) rl.Result {
-	M.enable(B, hiragana)
-	M.message(B, msgHiragana)
-	return rl.CONTINUE
+// loadUserJisyo loads the user dictionary and remembers its filename
+// and its timestamp to detect changes by others on saving.
+// The order of the entries is the recency for WithUserJisyoLimit.
+func (M *Mode) loadUserJisyo(filename string) error {
+	var okuriAri, okuriNasi []string
+	_, unlock := M.lockUser()
+	err := M.User.load(filename, nil, func(source string) {
+		if isOkuriAri(source) {
+			okuriAri = append(okuriAri, source)
+		} else {
+			okuriNasi = append(okuriNasi, source)
+		}
+	})
+	unlock()
+	M.seedRecency(okuriAri)
+	M.seedRecency(okuriNasi)
+	M.userJisyoPath = filename
+	M.userJisyoStamp = modTime(expandEnv(filename))
+	return err
 }
 
-// Setup sets Ctrl-J in readline's global keymap to boot into SKK mode.
-// If you want to set the SKK for a specific readline keymap,
-// give the return value of the Load function as the second argument of BindKey
-func Setup(userJisyoFname string, systemJisyoFnames ...string) error {
-	M, err := Load(userJisyoFname, systemJisyoFnames...)
+func modTime(filename string) time.Time {
+	stat, err := os.Stat(filename)
 	if err != nil {
-		return err
+		return time.Time{}
 	}
-	rl.GlobalKeyMap.BindKey(keys.CtrlJ, M)
-	return nil
-}
-
-// WriteTo outputs the user dictionary to w.
-// Please note that the character code is UTF8.
-func (M *Mode) WriteTo(w io.Writer) (n int64, err error) {
-	return M.User.WriteTo(w)
+	return stat.ModTime()
 }
 
 // SaveUserJisyo saves the user dictionary as filename.
 // The file is first created with the name filename+".TMP",
 // and replaced with the file of filename after closing.
-// The original file is renamed to filename + ".BAK".
+// The original file is kept as filename + ".BAK".
+//
+// When the file was changed by others since loaded and ConfirmOverwrite is set,
+// ConfirmOverwrite is called and ErrJisyoChanged is returned if it returns false.
 func (M *Mode) SaveUserJisyo(filename string) error {
 	filename = expandEnv(filename)
+	if M.ConfirmOverwrite != nil && !M.userJisyoStamp.IsZero() {
+		if stamp := modTime(filename); !stamp.IsZero() && !stamp.Equal(M.userJisyoStamp) {
+			if !M.ConfirmOverwrite(filename) {
+				return ErrJisyoChanged
+			}
+		}
+	}
 	tmpName := filename + ".TMP"
 	fd, err := os.Create(tmpName)
 	if err != nil {
 		return err
 	}
-	if _, err := M.User.WriteToEucJp(fd); err != nil {
+	j := M.Snapshot()
+	_, err = j.writeInOrder(japanese.EUCJP.NewEncoder().Writer(fd), slices.Values(M.recentKeys(j)))
+	if err != nil {
+		fd.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := fd.Sync(); err != nil {
+		fd.Close()
+		os.Remove(tmpName)
 		return err
 	}
 	if err := fd.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := backup(filename, filename+".BAK"); err != nil {
+		return err
+	}
+	// Rename replaces filename atomically, so filename always exists.
+	if err := os.Rename(tmpName, filename); err != nil {
 		return err
 	}
-	if err := os.Rename(filename, filename+".BAK"); err != nil && !os.IsNotExist(err) {
+	M.userJisyoStamp = modTime(filename)
+	M.dirty.Store(false)
+	return nil
+}
+
+// backup makes backupName the same file as filename leaving filename itself.
+// When hard links are not available, filename is renamed to backupName.
+func backup(filename, backupName string) error {
+	if err := os.Remove(backupName); err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	return os.Rename(tmpName, filename)
+	err := os.Link(filename, backupName)
+	if err == nil || os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.Rename(filename, backupName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,371 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+func TestSaveUserJisyo(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "skk-jisyo")
+
+	M := New()
+	M.User["かんじ"] = []string{"漢字"}
+	if err := M.SaveUserJisyo(fname); err != nil {
+		t.Fatal(err.Error())
+	}
+	M.User["あい"] = []string{"愛"}
+	if err := M.SaveUserJisyo(fname); err != nil {
+		t.Fatal(err.Error())
+	}
+	backup := Jisyo{}
+	if err := backup.Load(fname + ".BAK"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, ok := backup["あい"]; ok || len(backup["かんじ"]) != 1 {
+		t.Fatalf("backup: %v", backup)
+	}
+	if _, err := os.Stat(fname + ".TMP"); !os.IsNotExist(err) {
+		t.Fatal("the temporary file remains")
+	}
+
+	M2, err := Load(fname, fname)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	confirmed := false
+	M2.ConfirmOverwrite = func(string) bool {
+		confirmed = true
+		return false
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(fname, future, future); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := M2.SaveUserJisyo(fname); err != ErrJisyoChanged || !confirmed {
+		t.Fatalf("SaveUserJisyo for the file changed: %v", err)
+	}
+}
+
+func TestConfigNew(t *testing.T) {
+	dir := t.TempDir()
+	system1 := filepath.Join(dir, "SKK-JISYO.1")
+	system2 := filepath.Join(dir, "SKK-JISYO.2")
+	os.WriteFile(system1, []byte(";; -*- coding: utf-8 -*-\nかんじ /漢字/\n"), 0666)
+	os.WriteFile(system2, []byte(";; -*- coding: utf-8 -*-\nあい /愛/\n"), 0666)
+
+	M, err := Config{
+		UserJisyoPath:    filepath.Join(dir, "not-exist"),
+		SystemJisyoPaths: []string{system1, filepath.Join(dir, "not-exist"), system2},
+	}.New()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(M.System["かんじ"]) != 1 || len(M.System["あい"]) != 1 {
+		t.Fatalf("System: %v", M.System)
+	}
+	_, err = Config{SystemJisyoPaths: []string{filepath.Join(dir, "not-exist")}}.New()
+	if err != ErrJisyoNotFound {
+		t.Fatalf("not found: %v", err)
+	}
+}
+
+func TestWithSystemJisyoOrder(t *testing.T) {
+	dir := t.TempDir()
+	var filenames []string
+	for i := 0; i < 8; i++ {
+		fn := filepath.Join(dir, fmt.Sprintf("SKK-JISYO.%d", i))
+		os.WriteFile(fn, []byte(fmt.Sprintf(";; -*- coding: utf-8 -*-\nかんじ /漢字%d/\n", i)), 0666)
+		filenames = append(filenames, fn)
+	}
+	M, err := NewWithOptions(WithSystemJisyo(filenames...))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s := strings.Join(M.System["かんじ"], " "); s != "漢字0 漢字1 漢字2 漢字3 漢字4 漢字5 漢字6 漢字7" {
+		t.Fatalf("かんじ: %s", s)
+	}
+}
+
+func TestParseConfigString(t *testing.T) {
+	c, err := ParseConfigString("SKK-JISYO.L; SKK-JISYO.emoji;user=~/.go-skk-jisyo;key=C-o;minibuffer=above")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(c.SystemJisyoPaths) != 2 || c.SystemJisyoPaths[1] != "SKK-JISYO.emoji" {
+		t.Fatalf("SystemJisyoPaths: %#v", c.SystemJisyoPaths)
+	}
+	if c.UserJisyoPath != "~/.go-skk-jisyo" || c.Key != keys.CtrlO {
+		t.Fatalf("%#v", c)
+	}
+	if _, ok := c.MiniBuffer.(MiniBufferOnPrevLine); !ok {
+		t.Fatalf("MiniBuffer: %#v", c.MiniBuffer)
+	}
+	c, err = ParseConfigString("user=~/.skk-jisyo;system=/usr/share/skk/SKK-JISYO.L;layout=azik;selection_keys=asdfjkl;autosave=5s")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(c.SystemJisyoPaths) != 1 || c.Layout != "azik" || c.SelectionKeys.Select != "asdfjkl" || c.AutoSave != 5*time.Second {
+		t.Fatalf("%#v", c)
+	}
+	for _, s := range []string{"foo=bar", "user=", "layout=dvorak", "key=C-?", "minibuffer=left", "autosave=soon"} {
+		if _, err := ParseConfigString(s); err == nil {
+			t.Fatalf("%q was accepted", s)
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	M := New()
+	for i := 0; i < maxRecent+3; i++ {
+		M.remember("かんじ", "漢字")
+	}
+	M.remember("かk", "書く")
+	M.whiteMarker = "▷"
+	M.KeyBindings = map[keys.Code]string{"l": ""}
+
+	var buffer strings.Builder
+	if err := M.SaveSession(&buffer); err != nil {
+		t.Fatal(err.Error())
+	}
+	N := New()
+	if err := N.LoadSession(strings.NewReader(buffer.String())); err != nil {
+		t.Fatal(err.Error())
+	}
+	recent := N.Recent()
+	if len(recent) != maxRecent || recent[len(recent)-1] != (Conversion{Source: "かk", Text: "書く"}) {
+		t.Fatalf("recent: %d %#v", len(recent), recent[len(recent)-1])
+	}
+	if N.white() != "▷" || N.black() != markerBlack {
+		t.Fatalf("markers: %s %s", N.white(), N.black())
+	}
+	if name, ok := N.KeyBindings["l"]; !ok || name != "" {
+		t.Fatalf("KeyBindings: %#v", N.KeyBindings)
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "skk.json")
+	err := os.WriteFile(fname, []byte(`{
+	"bindings": {"SKK_LATIN_MODE": ["C-l", "SPACE"], "SKK_ABBREV_MODE": []},
+	"white_marker": "▷",
+	"punctuation": "en",
+	"hiragana": {"z,": "‥"},
+	"selection_keys": "aoeuidhtn",
+	"normalization": ["nfc", "vu"],
+	"date_formats": ["2006/01/02"]
+}`), 0600)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	M, err := NewWithOptions(WithConfigFile(fname))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	b := M.keyBindings()
+	if b[keys.CtrlL] != "SKK_LATIN_MODE" || b[" "] != "SKK_LATIN_MODE" || b["l"] != "" || b["/"] != "" {
+		t.Fatalf("bindings: %#v", b)
+	}
+	if b["q"] != "SKK_TOGGLE_KANA" {
+		t.Fatalf("default bindings are lost: %#v", b)
+	}
+	if M.white() != "▷" || M.black() != markerBlack {
+		t.Fatalf("markers: %s %s", M.white(), M.black())
+	}
+	h, k := M.kanas()[0].table, M.kanas()[1].table
+	if h[","] != "，" || k["."] != "．" || h["z,"] != "‥" {
+		t.Fatalf("kana table: %q %q %q", h[","], k["."], h["z,"])
+	}
+	if M.selectionKeys().Select != "aoeuidhtn" {
+		t.Fatalf("selection keys: %s", M.selectionKeys().Select)
+	}
+	if M.Normalization != NormalizeNFC|NormalizeVu {
+		t.Fatalf("normalization: %d", M.Normalization)
+	}
+	if len(M.DateFormats) != 1 || M.DateFormats[0] != "2006/01/02" {
+		t.Fatalf("date formats: %q", M.DateFormats)
+	}
+
+	if _, err := NewWithOptions(WithConfigFile(fname + ".notfound")); err != nil {
+		t.Fatalf("not found: %s", err.Error())
+	}
+	os.WriteFile(fname, []byte(`{"bindings": {"SKK_LATIN_MODE": ["no-such-key"]}}`), 0600)
+	if _, err := NewWithOptions(WithConfigFile(fname)); err == nil {
+		t.Fatal("unknown key name is not an error")
+	}
+}
+
+func TestClose(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "skk-jisyo")
+	M := New()
+	M.loadUserJisyo(fname)
+	if err := M.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := os.Stat(fname); !os.IsNotExist(err) {
+		t.Fatal("saved without changes")
+	}
+	M.updateUser("かんじ", func([]string, bool) []string { return []string{"漢字"} })
+	stopped := false
+	M.onClose(func() error { stopped = true; return nil })
+	if err := M.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !stopped {
+		t.Fatal("the background job is not stopped")
+	}
+	N := New()
+	if err := N.User.Load(fname); err != nil || N.User["かんじ"][0] != "漢字" {
+		t.Fatalf("not saved: %v", err)
+	}
+}
+
+func TestClipboardReading(t *testing.T) {
+	M := New()
+	for _, p := range [][2]string{
+		{"kannji", "かんじ"},
+		{" KaNnJi\nsecond line", "かんじ"},
+		{"かんじ", "かんじ"},
+	} {
+		if result := M.clipboardReading(p[0]); result != p[1] {
+			t.Fatalf("%q: %q", p[0], result)
+		}
+	}
+}
+
+func TestBackgroundJisyo(t *testing.T) {
+	release := make(chan struct{})
+	b := LoadInBackground(func(j Jisyo) error {
+		<-release
+		j["かんじ"] = []string{"漢字"}
+		return nil
+	})
+	b.Wait = time.Millisecond
+	M := New()
+	M.SystemDictionary = b
+	if !M.loading() {
+		t.Fatal("not loading")
+	}
+	if _, err := M.Convert("かんじ"); err != ErrNoCandidate {
+		t.Fatalf("while loading: %v", err)
+	}
+	close(release)
+	<-b.Done()
+	if M.loading() || b.Err() != nil {
+		t.Fatalf("after loading: %v", b.Err())
+	}
+	if list, err := M.Convert("かんじ"); err != nil || list[0].Text != "漢字" {
+		t.Fatalf("%v %v", list, err)
+	}
+
+	M, err := NewWithOptions(WithSystemJisyoInBackground(filepath.Join(t.TempDir(), "not-exist")))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	b = M.SystemDictionary.(*BackgroundJisyo)
+	<-b.Done()
+	if b.Err() != ErrJisyoNotFound {
+		t.Fatalf("Err: %v", b.Err())
+	}
+}
+
+func TestUserJisyoLimit(t *testing.T) {
+	M, err := NewWithOptions(WithUserJisyoLimit(2, 2))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	M.System["かんじ"] = []string{"漢字", "感じ", "幹事"}
+	if err := M.Register("かんじ", "監事"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if list := M.User["かんじ"]; strings.Join(list, "/") != "監事/漢字" {
+		t.Fatalf("MaxCandidates: %v", list)
+	}
+	M.Register("あい", "愛")
+	M.remember("かんじ", "監事")
+	M.Register("うえ", "上")
+	if _, ok := M.User["あい"]; ok || len(M.User) != 2 {
+		t.Fatalf("the entry used least recently is left: %v", M.User)
+	}
+}
+
+func TestUserJisyoLimitAcrossSessions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jisyo")
+	M, err := NewWithOptions(WithUserJisyo(path), WithUserJisyoLimit(3, 0))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	M.Register("あい", "愛")
+	M.Register("うえ", "上")
+	M.Register("おく*く", "置く")
+	M.remember("あい", "愛")
+	if err := M.SaveUserJisyo(path); err != nil {
+		t.Fatal(err.Error())
+	}
+	// 保存した順序から前回の使用順を引き継ぐ
+	M, err = NewWithOptions(WithUserJisyo(path), WithUserJisyoLimit(3, 0))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	M.Register("かき", "柿")
+	if _, ok := M.User["うえ"]; ok || len(M.User) != 3 {
+		t.Fatalf("the entry used least recently is left: %v", M.User)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	M := New()
+	M.System["かんじ"] = []string{"漢字", "感じ"}
+	M.System["あい"] = []string{"愛"}
+	M.User["かんじ"] = []string{"漢字", "感じ"}
+	M.User["あい"] = []string{"愛"}
+	M.User["うえ"] = []string{"上"}
+	M.User["から"] = []string{}
+	M.remember("あい", "愛")
+	n, err := M.Compact()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n != 2 || len(M.User) != 2 {
+		t.Fatalf("Compact removed %d: %v", n, M.User)
+	}
+	if _, ok := M.User["あい"]; !ok {
+		t.Fatal("the entry selected was removed")
+	}
+}
+
+func TestAutoSave(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "skk-jisyo")
+	M, err := NewWithOptions(WithUserJisyo(fname), WithAutoSave(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	saved := func() Jisyo {
+		j := Jisyo{}
+		j.Load(fname)
+		return j
+	}
+	M.Register("かんじ", "漢字")
+	M.Register("あい", "愛")
+	if j := saved(); len(j) != 0 {
+		t.Fatalf("saved before the delay: %v", j)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if j := saved(); len(j) != 2 {
+		t.Fatalf("not saved after the delay: %v", j)
+	}
+	M.Register("うえ", "上")
+	if err := M.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if j := saved(); len(j) != 3 {
+		t.Fatalf("not saved by Close: %v", j)
+	}
+}
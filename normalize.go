@@ -0,0 +1,139 @@
+package skk
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// Normalization is the set of the conventions of Unicode matched by
+// the lookups, so that the dictionaries made with other conventions
+// match the readings typed. The reading is looked up as it is first,
+// and then in the other forms. The candidates found are composed by
+// NFC with NormalizeNFC, and う゛ and ウ゛ in them are folded into ゔ and
+// ヴ with NormalizeVu.
+type Normalization uint
+
+const (
+	// NormalizeNFC matches the composed and the decomposed forms
+	// such as が and か followed by U+3099.
+	NormalizeNFC Normalization = 1 << iota
+	// NormalizeVu matches ゔ and う゛, which the dictionaries in EUC-JP
+	// use because JIS X 0208 has no ゔ.
+	NormalizeVu
+	// NormalizeWidth matches the full-width and the half-width forms
+	// such as ＡＢＣ and ABC.
+	NormalizeWidth
+)
+
+// normalizationNames is the names of Normalization in the configuration file.
+var normalizationNames = map[string]Normalization{
+	"nfc":   NormalizeNFC,
+	"vu":    NormalizeVu,
+	"width": NormalizeWidth,
+}
+
+// parseNormalization returns Normalization of the names such as "nfc".
+func parseNormalization(names []string) (Normalization, error) {
+	var n Normalization
+	for _, name := range names {
+		value, ok := normalizationNames[strings.ToLower(name)]
+		if !ok {
+			return 0, fmt.Errorf("%q: unknown normalization", name)
+		}
+		n |= value
+	}
+	return n, nil
+}
+
+// WithNormalization sets the conventions matched by the lookups.
+func WithNormalization(n Normalization) Option {
+	return func(M *Mode) error {
+		M.Normalization = n
+		return nil
+	}
+}
+
+// readings returns source and its forms by the conventions of n
+// without duplicates. source is the first.
+func (n Normalization) readings(source string) []string {
+	forms := []string{source}
+	expand := func(f func(string) []string) {
+		for _, form := range slices.Clone(forms) {
+			for _, s := range f(form) {
+				if !slices.Contains(forms, s) {
+					forms = append(forms, s)
+				}
+			}
+		}
+	}
+	if n&NormalizeWidth != 0 {
+		expand(func(s string) []string {
+			return []string{width.Fold.String(s), width.Widen.String(s)}
+		})
+	}
+	if n&NormalizeVu != 0 {
+		expand(func(s string) []string {
+			return []string{strings.ReplaceAll(s, "う゛", "ゔ"), strings.ReplaceAll(s, "ゔ", "う゛")}
+		})
+	}
+	if n&NormalizeNFC != 0 {
+		expand(func(s string) []string {
+			return []string{norm.NFC.String(s), norm.NFD.String(s)}
+		})
+	}
+	return forms
+}
+
+// vuReplacer folds う゛ and ウ゛ of the candidates.
+var vuReplacer = strings.NewReplacer("う゛", "ゔ", "ウ゛", "ヴ")
+
+// candidate returns the candidate s in the form of n.
+func (n Normalization) candidate(s string) string {
+	if n&NormalizeVu != 0 {
+		s = vuReplacer.Replace(s)
+	}
+	if n&NormalizeNFC != 0 {
+		s = norm.NFC.String(s)
+	}
+	return s
+}
+
+// candidates returns list in the form of n.
+// list is returned as it is when nothing is changed.
+func (n Normalization) candidates(list []string) []string {
+	if n&(NormalizeNFC|NormalizeVu) == 0 {
+		return list
+	}
+	var newList []string
+	for i, s := range list {
+		if t := n.candidate(s); t != s && newList == nil {
+			newList = slices.Clone(list)
+			newList[i] = t
+		} else if newList != nil {
+			newList[i] = t
+		}
+	}
+	if newList == nil {
+		return list
+	}
+	return newList
+}
+
+// candidateSeq is candidates for the candidates of StreamSource.
+func (n Normalization) candidateSeq(seq iter.Seq[string]) iter.Seq[string] {
+	if n&(NormalizeNFC|NormalizeVu) == 0 {
+		return seq
+	}
+	return func(yield func(string) bool) {
+		for s := range seq {
+			if !yield(n.candidate(s)) {
+				return
+			}
+		}
+	}
+}
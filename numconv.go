@@ -0,0 +1,46 @@
+package skk
+
+import (
+	"sort"
+)
+
+// numConvs is the built-in numeric conversions for `#0`..`#3`.
+var numConvs = map[byte]func(string) string{
+	'0': func(s string) string { return s }, // 無変換
+	'1': hanToZenString,                     // 全角化
+	'2': numberToKanji,                      // 漢数字で位取りあり
+	'3': numberToKanji,                      // 漢数字で位取りなし(あとでやる)
+}
+
+// RegisterNumConv sets the function which converts the number for `#c`
+// in the candidates, such as the era-year or Roman numerals.
+// It can also replace the built-in conversions `#0`..`#3`.
+// c must be a digit.
+func (M *Mode) RegisterNumConv(c byte, f func(number string) string) {
+	if M.numConvs == nil {
+		M.numConvs = map[byte]func(string) string{}
+	}
+	M.numConvs[c] = f
+}
+
+// numConv returns the numeric conversion for `#c`.
+// An unknown type leaves the number as it is.
+func (M *Mode) numConv(c byte) func(string) string {
+	if f, ok := M.numConvs[c]; ok {
+		return f
+	}
+	if f, ok := numConvs[c]; ok {
+		return f
+	}
+	return numConvs['0']
+}
+
+// builtinNumConvs returns the built-in numeric conversion types such as "#0".
+func builtinNumConvs() []string {
+	var result []string
+	for c := range numConvs {
+		result = append(result, "#"+string(c))
+	}
+	sort.Strings(result)
+	return result
+}
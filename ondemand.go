@@ -1,3 +1,5 @@
+//go:build !js && !plan9
+
 package skk
 
 import (
@@ -45,7 +47,7 @@ func (o *onDemandLoad) Call(ctx context.Context, B *readline.Buffer) readline.Re
 		var err error
 		if hasEqual {
 			if strings.EqualFold(key, "user") {
-				err = skkMode.User.Load(value)
+				err = skkMode.loadUserJisyo(value)
 				if os.IsNotExist(err) {
 					err = nil
 				}
@@ -72,14 +74,8 @@ func (o *onDemandLoad) Call(ctx context.Context, B *readline.Buffer) readline.Re
 	}
 	if succeeded {
 		readline.GlobalKeyMap.BindKey(o.Key, skkMode)
-		readline.GlobalKeyMap.BindKey(keys.Enter, &readline.GoCommand{
-			Name: "SKK_ACCEPT_LINE_WITH_LATIN_MODE",
-			Func: skkMode.cmdAcceptLineWithLatinMode,
-		})
-		readline.GlobalKeyMap.BindKey(keys.CtrlC, &readline.GoCommand{
-			Name: "SKK_INTRRUPT_WITH_LATIN_MODE",
-			Func: skkMode.cmdIntrruptWithLatinMode,
-		})
+		readline.GlobalKeyMap.BindKey(keys.Enter, skkMode.CmdAcceptLineWithLatinMode())
+		readline.GlobalKeyMap.BindKey(keys.CtrlC, skkMode.CmdInterruptWithLatinMode())
 		return skkMode.Call(ctx, B)
 	}
 	return readline.CONTINUE
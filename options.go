@@ -0,0 +1,178 @@
+package skk
+
+import (
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+// Option is the setting given to NewWithOptions.
+type Option func(*Mode) error
+
+// NewWithOptions creates an instance of SKK and applies opts in order.
+// Settings not given by opts are the same as New.
+func NewWithOptions(opts ...Option) (*Mode, error) {
+	M := New()
+	for _, opt := range opts {
+		if err := opt(M); err != nil {
+			return nil, err
+		}
+	}
+	return M, nil
+}
+
+// WithUserJisyo loads the user dictionary from filename.
+// It is not an error that the file does not exist.
+func WithUserJisyo(filename string) Option {
+	return func(M *Mode) error {
+		if err := M.loadUserJisyo(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+}
+
+// WithSystemJisyo loads all of the system dictionaries in filenames which exist.
+// When none of them exists, ErrJisyoNotFound is returned.
+// The dictionaries are loaded in parallel and merged in the order of filenames.
+func WithSystemJisyo(filenames ...string) Option {
+	return func(M *Mode) error {
+		return loadAll(M.System, filenames, Jisyo.Load)
+	}
+}
+
+// loadAll loads the dictionaries in filenames by load in parallel
+// up to GOMAXPROCS at once, and merges them into j in the order of filenames
+// as if they were loaded one by one. The files which do not exist are
+// skipped, but ErrJisyoNotFound is returned when none of them exists.
+func loadAll(j Jisyo, filenames []string, load func(Jisyo, string) error) error {
+	if len(filenames) <= 0 {
+		return nil
+	}
+	if len(filenames) == 1 {
+		err := load(j, filenames[0])
+		if os.IsNotExist(err) {
+			return ErrJisyoNotFound
+		}
+		return err
+	}
+	parts := make([]Jisyo, len(filenames))
+	errs := make([]error, len(filenames))
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	for i, fn := range filenames {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			parts[i] = Jisyo{}
+			errs[i] = load(parts[i], fn)
+		}()
+	}
+	wg.Wait()
+	found := false
+	for i, err := range errs {
+		if err == nil {
+			j.merge(parts[i])
+			found = true
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if !found {
+		return ErrJisyoNotFound
+	}
+	return nil
+}
+
+// WithMiniBuffer sets the area to show messages and to query
+// the new word on the registration.
+func WithMiniBuffer(mb MiniBuffer) Option {
+	return func(M *Mode) error {
+		if mb != nil {
+			M.MiniBuffer = mb
+		}
+		return nil
+	}
+}
+
+// WithSelectionKeys sets the key table for the candidate listing.
+func WithSelectionKeys(sk *SelectionKeys) Option {
+	return func(M *Mode) error {
+		M.SelectionKeys = sk
+		return nil
+	}
+}
+
+// WithMaxRegistrationDepth sets the limit of the nesting of
+// the registration mode. See Mode.MaxRegistrationDepth.
+func WithMaxRegistrationDepth(depth int) Option {
+	return func(M *Mode) error {
+		M.MaxRegistrationDepth = depth
+		return nil
+	}
+}
+
+// WithRemoteTimeout sets the limit of a lookup of ContextSource.
+// See Mode.RemoteTimeout.
+func WithRemoteTimeout(d time.Duration) Option {
+	return func(M *Mode) error {
+		M.RemoteTimeout = d
+		return nil
+	}
+}
+
+// WithQuotedInsertKey sets the key to insert the next character as it is.
+func WithQuotedInsertKey(key keys.Code) Option {
+	return func(M *Mode) error {
+		M.QuotedInsertKey = key
+		return nil
+	}
+}
+
+// WithKanaTable adds the entries of the romaji-kana tables for
+// hiragana and katakana to the default ones. An entry whose value
+// is empty removes the default one.
+func WithKanaTable(hiragana, katakana map[string]string) Option {
+	return func(M *Mode) error {
+		base := M.kanas()
+		M.kanaTable = []*_Kana{
+			mergeKana(base[0], hiragana),
+			mergeKana(base[1], katakana),
+		}
+		return nil
+	}
+}
+
+func mergeKana(base *_Kana, add map[string]string) *_Kana {
+	table := make(map[string]string, len(base.table)+len(add))
+	for key, value := range base.table {
+		table[key] = value
+	}
+	for key, value := range add {
+		if value == "" {
+			delete(table, key)
+		} else {
+			table[key] = value
+		}
+	}
+	return &_Kana{table: table, switchTo: base.switchTo}
+}
+
+// WithMarkers replaces the markers(▽ and ▼). Each of them must be
+// one character. An empty string leaves the marker as it is.
+func WithMarkers(white, black string) Option {
+	return func(M *Mode) error {
+		if white != "" {
+			M.whiteMarker = white
+		}
+		if black != "" {
+			M.blackMarker = black
+		}
+		return nil
+	}
+}
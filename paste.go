@@ -0,0 +1,129 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	rl "github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+// PasteTty is readline.ITty which ends the escape sequence read as a key
+// at the length of the markers of the bracketed paste, so that the start
+// marker is read as a key by itself and bound to SKK_BRACKETED_PASTE.
+// Without it, the marker and the text following it are read as one key,
+// which no command is bound to. The escape sequences of the keys named
+// by go-readline-ny are not longer than the markers.
+type PasteTty struct {
+	rl.ITty
+	// count is the count of the runes of the key read since Raw.
+	count int
+}
+
+// Raw starts reading a key.
+func (T *PasteTty) Raw() (func() error, error) {
+	T.count = 0
+	return T.ITty.Raw()
+}
+
+// Buffered is called after each rune of an escape sequence is read,
+// and returns false when the sequence is as long as the markers.
+func (T *PasteTty) Buffered() bool {
+	T.count++
+	if T.count >= len(pasteStart) {
+		return false
+	}
+	return T.ITty.Buffered()
+}
+
+// EnableBracketedPaste makes editor receive the pasted text with the
+// bracketed paste mode: the mode is turned on while editing, the tty is
+// wrapped by PasteTty, and the text pasted in the latin mode is inserted
+// as it is. Call it after setting Tty, Writer and the prompt of editor.
+func EnableBracketedPaste(editor *rl.Editor) {
+	editor.Init()
+	if _, ok := editor.Tty.(*PasteTty); !ok {
+		editor.Tty = &PasteTty{ITty: editor.Tty}
+	}
+	prompt := editor.Prompt
+	editor.Prompt = func() (int, error) {
+		io.WriteString(editor.Out, bracketedPasteOn)
+		return prompt()
+	}
+	lineFeed := editor.LineFeedWriter
+	editor.LineFeedWriter = func(rc rl.Result, w io.Writer) (int, error) {
+		io.WriteString(w, bracketedPasteOff)
+		if lineFeed != nil {
+			return lineFeed(rc, w)
+		}
+		return io.WriteString(w, "\n")
+	}
+	editor.BindKey(pasteStart, &rl.GoCommand{
+		Name: "BRACKETED_PASTE",
+		Func: func(ctx context.Context, B *rl.Buffer) rl.Result {
+			// 終わりのマーカーは続けて届くので ctx で中断しない
+			text, err := readPaste(pasteStart, func() (string, error) { return getKeyUnwrapped(B) })
+			B.InsertAndRepaint(stripControls(text))
+			if err != nil {
+				return resultOnError(ctx)
+			}
+			return rl.CONTINUE
+		},
+	})
+}
+
+// readPaste returns the pasted text from the key first starting with
+// the start marker to the end marker read by readKey.
+func readPaste(first string, readKey func() (string, error)) (string, error) {
+	var buffer strings.Builder
+	buffer.WriteString(strings.TrimPrefix(first, pasteStart))
+	for !strings.Contains(buffer.String(), pasteEnd) {
+		key, err := readKey()
+		if err != nil {
+			return buffer.String(), err
+		}
+		buffer.WriteString(key)
+	}
+	text, _, _ := strings.Cut(buffer.String(), pasteEnd)
+	return text, nil
+}
+
+// pastedText reads the rest of the paste starting with the key first
+// and returns the text to insert.
+func (M *Mode) pastedText(ctx context.Context, B *rl.Buffer, first string) (string, error) {
+	text, err := readPaste(first, func() (string, error) { return M.readKey(ctx, B) })
+	text = stripControls(text)
+	if st := M.stateOf(B); M.PasteAsRomaji && st.active && (st.mode == StateHiragana || st.mode == StateKatakana) {
+		text = M.pastedRomaji(st.kana, text)
+	}
+	return text, err
+}
+
+// pastedRomaji converts the romaji in text into the kana of K.
+// The characters which are not romaji are left as they are.
+func (M *Mode) pastedRomaji(K *_Kana, text string) string {
+	var line lineSurface
+	for _, r := range text {
+		M.inputRomaji(&line, K, strings.ToLower(string(r)))
+	}
+	return string(line.line)
+}
+
+func (M *Mode) cmdBracketedPaste(ctx context.Context, B *rl.Buffer) rl.Result {
+	text, err := M.pastedText(ctx, B, pasteStart)
+	B.InsertAndRepaint(text)
+	if err != nil {
+		return resultOnError(ctx)
+	}
+	return rl.CONTINUE
+}
+
+// pasteBinding returns the binding of the start marker of the bracketed paste.
+// It must be called with M.bindingMutex locked.
+func (M *Mode) pasteBinding(commands map[string]rl.Command) _Binding {
+	key := keys.Code(pasteStart)
+	return _Binding{key, M.recorder(key, commands["SKK_BRACKETED_PASTE"])}
+}
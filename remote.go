@@ -0,0 +1,131 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	rl "github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+// remoteKeyDelay is the time the conversion waits for the lookup before
+// it reads the keys typed, so that the lookups answered soon such as
+// the ones by the caches do not leave a key being read.
+const remoteKeyDelay = 50 * time.Millisecond
+
+// errLookupCanceled is returned by lookupHenkanWatching when C-g is typed.
+var errLookupCanceled = errors.New("lookup canceled")
+
+// keyResult is a key read in a goroutine.
+type keyResult struct {
+	key string
+	err error
+}
+
+// hasRemote reports whether the sources have ContextSource.
+func (M *Mode) hasRemote() bool {
+	for _, s := range M.sources() {
+		if _, ok := s.(ContextSource); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// startKey starts to read a key in a goroutine unless it is started already.
+// readKey receives the key.
+func (M *Mode) startKey(B *rl.Buffer) <-chan keyResult {
+	st := M.stateOf(B)
+	if st.pendingKey == nil {
+		ch := make(chan keyResult, 1)
+		go func() {
+			key, err := getKeyUnwrapped(B)
+			ch <- keyResult{key: key, err: err}
+		}()
+		st.pendingKey = ch
+	}
+	return st.pendingKey
+}
+
+// hasTypeAhead reports whether readKey has a key typed or being read
+// while the sources were looked up.
+func (M *Mode) hasTypeAhead(B *rl.Buffer) bool {
+	st := M.stateOf(B)
+	return len(st.typeAhead) > 0 || st.pendingKey != nil
+}
+
+// evalTypeAhead evaluates the key typed while the sources were looked up
+// so that the editor does not read the terminal with the goroutine
+// reading it.
+func (M *Mode) evalTypeAhead(ctx context.Context, B *rl.Buffer) rl.Result {
+	if !M.hasTypeAhead(B) {
+		return rl.CONTINUE
+	}
+	key, err := M.readKey(ctx, B)
+	if err != nil {
+		return resultOnError(ctx)
+	}
+	return eval(ctx, B, key)
+}
+
+// lookupHenkanWatching is lookupHenkan which can be canceled by C-g
+// while ContextSource is looked up. The other keys typed meanwhile
+// are kept for readKey, and are dropped when C-g follows them.
+// The lookup canceled is not waited for.
+func (M *Mode) lookupHenkanWatching(ctx context.Context, B *rl.Buffer, source string) (*_Henkan, bool, error) {
+	if len(M.replaying) > 0 || !M.hasRemote() {
+		h, found := M.lookupHenkan(ctx, source)
+		return h, found, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type lookupResult struct {
+		h     *_Henkan
+		found bool
+	}
+	done := make(chan lookupResult, 1)
+	go func() {
+		h, found := M.lookupHenkan(ctx, source)
+		done <- lookupResult{h: h, found: found}
+	}()
+	timer := time.NewTimer(remoteKeyDelay)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.h, r.found, nil
+	case <-timer.C:
+	}
+	M.message(B, "辞書を検索中です (C-g で中止)")
+	defer M.message(B, "")
+	st := M.stateOf(B)
+	keyCh := M.startKey(B)
+	for {
+		select {
+		case r := <-done:
+			return r.h, r.found, nil
+		case k := <-keyCh:
+			st.pendingKey = nil
+			if k.err != nil {
+				// 端末のエラーは検索の後で readKey に返す
+				ch := make(chan keyResult, 1)
+				ch <- k
+				st.pendingKey = ch
+				keyCh = nil
+				continue
+			}
+			if k.key == string(keys.CtrlG) {
+				// ctx を無視する辞書もあるので検索の終了は待たない
+				cancel()
+				// 中止した変換の後に打たれたキーは捨てる
+				st.typeAhead = nil
+				return nil, false, errLookupCanceled
+			}
+			// C-g を受け付けるため、検索が終わるまでキーを読み続ける
+			st.typeAhead = append(st.typeAhead, k.key)
+			keyCh = M.startKey(B)
+		}
+	}
+}
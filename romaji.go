@@ -1,9 +1,8 @@
 package skk
 
 import (
-	"context"
-
-	"github.com/nyaosorg/go-readline-ny"
+	"unicode"
+	"unicode/utf8"
 )
 
 type _Kana struct {
@@ -102,29 +101,33 @@ var katakana = &_Kana{
 	switchTo: 0,
 }
 
-type _Romaji struct {
-	kana *_Kana
-	last string
-}
-
-func (R *_Romaji) String() string {
-	return "SKK_ROMAJI_" + R.last
-}
-
-func (R *_Romaji) Call(ctx context.Context, B *readline.Buffer) readline.Result {
-	for i := 3; i > 0; i-- {
-		if B.Cursor >= i {
-			key := B.SubString(B.Cursor-i, B.Cursor) + R.last
-			if value, ok := R.kana.table[key]; ok {
-				B.ReplaceAndRepaint(B.Cursor-i, value)
-				return readline.CONTINUE
-			}
+// triggers returns the keys which have to be bound to _Romaji:
+// romajiTrigger and the last characters of the romaji in the table.
+func (K *_Kana) triggers() []string {
+	result := make([]string, 0, len(romajiTrigger))
+	seen := map[string]bool{}
+	add := func(c string) {
+		if !seen[c] {
+			seen[c] = true
+			result = append(result, c)
 		}
 	}
-	if value, ok := R.kana.table[R.last]; ok {
-		B.InsertAndRepaint(value)
-	} else {
-		B.InsertAndRepaint(R.last)
+	for i := range romajiTrigger {
+		add(romajiTrigger[i : i+1])
+	}
+	for romaji := range K.table {
+		// 設定で追加された表には ASCII 以外で終わるものもある
+		if r, size := utf8.DecodeLastRuneInString(romaji); size > 0 && r != utf8.RuneError && r > ' ' && unicode.IsPrint(r) {
+			add(romaji[len(romaji)-size:])
+		}
+	}
+	return result
+}
+
+// kanas returns the kana tables of M: hiragana and katakana.
+func (M *Mode) kanas() []*_Kana {
+	if M.kanaTable != nil {
+		return M.kanaTable
 	}
-	return readline.CONTINUE
+	return kanaTable
 }
@@ -15,3 +15,66 @@ func TestRomaji(t *testing.T) {
 		}
 	}
 }
+
+func TestWithKanaTable(t *testing.T) {
+	M, err := NewWithOptions(WithKanaTable(
+		map[string]string{"va": "ゔぁ", "z,": "‥", "nn": ""},
+		map[string]string{"va": "ヴァ"}))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	h := M.kanas()[0]
+	if h.table["va"] != "ゔぁ" || h.table["z,"] != "‥" || h.table["ka"] != "か" {
+		t.Fatalf("entries are not added: %#v", h.table)
+	}
+	if _, ok := h.table["nn"]; ok {
+		t.Fatal("nn is not removed")
+	}
+	if _, ok := hiragana.table["va"]; ok {
+		t.Fatal("the default table is changed")
+	}
+	if M.kanas()[h.switchTo].table["va"] != "ヴァ" {
+		t.Fatal("switchTo does not point the katakana table")
+	}
+}
+
+func TestInputRomaji(t *testing.T) {
+	M := New()
+	S := &lineSurface{}
+	for _, c := range "Kannji" {
+		M.InputRomaji(S, string(c), false)
+	}
+	if text := string(S.line); text != "▽かんじ" {
+		t.Fatalf("%q", text)
+	}
+	if !M.Kakutei(S) || string(S.line) != "かんじ" || S.cursor != 3 {
+		t.Fatalf("%q %d", string(S.line), S.cursor)
+	}
+	for _, c := range "ka" {
+		M.InputRomaji(S, string(c), true)
+	}
+	if text := string(S.line); text != "かんじカ" {
+		t.Fatalf("%q", text)
+	}
+	if M.Kakutei(S) {
+		t.Fatal("Kakutei without the marker")
+	}
+}
+
+func TestWithLayout(t *testing.T) {
+	M, err := NewWithOptions(WithLayout("azik"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for key, value := range map[string]string{"kz": "かん", "kp": "こう", "kyh": "きゅう", ";": "っ"} {
+		if v := M.kanas()[0].table[key]; v != value {
+			t.Fatalf("%s: %q", key, v)
+		}
+	}
+	if v := M.kanas()[1].table["sw"]; v != "セイ" {
+		t.Fatalf("sw: %q", v)
+	}
+	if _, err := NewWithOptions(WithLayout("dvorak")); err == nil {
+		t.Fatal("unknown layout was accepted")
+	}
+}
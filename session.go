@@ -0,0 +1,90 @@
+package skk
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+// maxRecent is the number of the conversions remembered by Mode.
+const maxRecent = 100
+
+// Conversion is a conversion confirmed by the user.
+type Conversion struct {
+	Source string `json:"source"`
+	Text   string `json:"text"`
+}
+
+// remember records the conversion from source to text as the most recent one.
+func (M *Mode) remember(source, text string) {
+	M.count(func(m *Metrics) { m.Conversions++ })
+	M.touch(source, true)
+	M = M.root()
+	M.recentMutex.Lock()
+	defer M.recentMutex.Unlock()
+	M.recent = append(M.recent, Conversion{Source: source, Text: text})
+	if len(M.recent) > maxRecent {
+		M.recent = append(M.recent[:0:0], M.recent[len(M.recent)-maxRecent:]...)
+	}
+}
+
+// Recent returns the conversions confirmed recently. The last one is the newest.
+func (M *Mode) Recent() []Conversion {
+	M.recentMutex.Lock()
+	defer M.recentMutex.Unlock()
+	return append([]Conversion{}, M.recent...)
+}
+
+// Session is the runtime state of Mode except the dictionaries.
+// The order of candidates learned by the registration and the purge
+// is kept in the user dictionary and is saved by SaveUserJisyo.
+type Session struct {
+	Recent          []Conversion         `json:"recent,omitempty"`
+	WhiteMarker     string               `json:"white_marker,omitempty"`
+	BlackMarker     string               `json:"black_marker,omitempty"`
+	QuotedInsertKey keys.Code            `json:"quoted_insert_key,omitempty"`
+	KeyBindings     map[keys.Code]string `json:"key_bindings,omitempty"`
+	SelectionKeys   *SelectionKeys       `json:"selection_keys,omitempty"`
+}
+
+// Session returns the current runtime state of M.
+func (M *Mode) Session() *Session {
+	return &Session{
+		Recent:          M.Recent(),
+		WhiteMarker:     M.whiteMarker,
+		BlackMarker:     M.blackMarker,
+		QuotedInsertKey: M.QuotedInsertKey,
+		KeyBindings:     M.KeyBindings,
+		SelectionKeys:   M.SelectionKeys,
+	}
+}
+
+// Restore sets the runtime state saved by Session to M.
+func (M *Mode) Restore(s *Session) {
+	M.recentMutex.Lock()
+	M.recent = append([]Conversion{}, s.Recent...)
+	M.recentMutex.Unlock()
+	M.whiteMarker = s.WhiteMarker
+	M.blackMarker = s.BlackMarker
+	M.QuotedInsertKey = s.QuotedInsertKey
+	M.KeyBindings = s.KeyBindings
+	M.SelectionKeys = s.SelectionKeys
+}
+
+// SaveSession writes the runtime state of M to w as JSON.
+func (M *Mode) SaveSession(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(M.Session())
+}
+
+// LoadSession reads the runtime state written by SaveSession from r.
+func (M *Mode) LoadSession(r io.Reader) error {
+	var s Session
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return err
+	}
+	M.Restore(&s)
+	return nil
+}
@@ -0,0 +1,188 @@
+// Package skkrpc provides the conversion engine of go-readline-skk to
+// the other processes such as editors and bots, so that they use the same
+// dictionaries and learning data as the readline integration.
+//
+// skk.proto defines the service Conversion. Service implements it with
+// the messages as plain Go structs, and ServeHTTP serves them as JSON
+// by POST to /skk.Conversion/Lookup and so on.
+//
+// This package does not depend on gRPC. The module skkrpc/skkgrpc
+// serves Service by gRPC with the code generated from skk.proto.
+//
+// Register changes the user dictionary, so set Authorize unless only
+// the trusted processes can connect to the server.
+//
+//	M, _ := skk.Load("~/.skk-jisyo", "/usr/share/skk/SKK-JISYO.L")
+//	service := &skkrpc.Service{Mode: M, Authorize: skkrpc.BearerToken(token)}
+//	http.ListenAndServe("localhost:8080", service)
+package skkrpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/hymkor/go-readline-skk"
+)
+
+// ServiceName is the full name of the service in skk.proto.
+const ServiceName = "skk.Conversion"
+
+// ErrEmptyArgument is an error that means the reading or the word is empty.
+var ErrEmptyArgument = errors.New("empty argument")
+
+// ErrUnauthorized is an error that means Authorize refused the request.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// LookupRequest is the message LookupRequest of skk.proto.
+type LookupRequest struct {
+	// Reading is the reading such as "かんじ".
+	// The okurigana follows "*" such as "か*く".
+	Reading string `json:"reading"`
+}
+
+// LookupResponse is the message LookupResponse of skk.proto.
+type LookupResponse struct {
+	// Candidates is the candidates. The annotation follows ";".
+	Candidates []string `json:"candidates"`
+}
+
+// RegisterRequest is the message RegisterRequest of skk.proto.
+type RegisterRequest struct {
+	// Reading is the reading as the dictionary such as "かk" for the okurigana.
+	Reading string `json:"reading"`
+	Word    string `json:"word"`
+}
+
+// RegisterResponse is the message RegisterResponse of skk.proto.
+type RegisterResponse struct{}
+
+// CompleteRequest is the message CompleteRequest of skk.proto.
+type CompleteRequest struct {
+	Prefix string `json:"prefix"`
+}
+
+// CompleteResponse is the message CompleteResponse of skk.proto.
+type CompleteResponse struct {
+	Readings []string `json:"readings"`
+}
+
+// Service is the implementation of the service Conversion with Mode.
+// The requests are processed one by one because Mode is not safe
+// for the concurrent use.
+type Service struct {
+	Mode *skk.Mode
+	// Authorize is called by ServeHTTP with the requests of Register,
+	// and the request is refused with 401 when it returns false.
+	// When it is nil, anyone who can connect can register the words.
+	Authorize func(r *http.Request) bool
+
+	mutex sync.Mutex
+}
+
+// BearerToken returns the function for Service.Authorize which accepts
+// the requests with the header "Authorization: Bearer token".
+func BearerToken(token string) func(r *http.Request) bool {
+	expected := "Bearer " + token
+	return func(r *http.Request) bool {
+		return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) == 1
+	}
+}
+
+// Lookup returns the candidates for the reading.
+// The list is empty when no candidate is found.
+func (s *Service) Lookup(ctx context.Context, req *LookupRequest) (*LookupResponse, error) {
+	if req.Reading == "" {
+		return nil, ErrEmptyArgument
+	}
+	s.mutex.Lock()
+	list, err := s.Mode.Convert(req.Reading)
+	s.mutex.Unlock()
+	resp := &LookupResponse{Candidates: []string{}}
+	if errors.Is(err, skk.ErrNoCandidate) {
+		return resp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range list {
+		resp.Candidates = append(resp.Candidates, c.String())
+	}
+	return resp, nil
+}
+
+// Register adds the word to the user dictionary of Mode.
+// It is saved by Mode.Close or Mode.SaveUserJisyo.
+func (s *Service) Register(ctx context.Context, req *RegisterRequest) (*RegisterResponse, error) {
+	if req.Reading == "" || req.Word == "" {
+		return nil, ErrEmptyArgument
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.Mode.Register(req.Reading, req.Word); err != nil {
+		return nil, err
+	}
+	return &RegisterResponse{}, nil
+}
+
+// Complete returns the readings starting with the prefix.
+func (s *Service) Complete(ctx context.Context, req *CompleteRequest) (*CompleteResponse, error) {
+	s.mutex.Lock()
+	list := s.Mode.Complete(req.Prefix)
+	s.mutex.Unlock()
+	if list == nil {
+		list = []string{}
+	}
+	return &CompleteResponse{Readings: list}, nil
+}
+
+// handle decodes the request as JSON, calls f and encodes its response.
+func handle[Req, Resp any](w http.ResponseWriter, r *http.Request, f func(context.Context, *Req) (*Resp, error)) {
+	var req Req
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := f(r.Context(), &req)
+	if errors.Is(err, ErrEmptyArgument) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ServeHTTP serves the methods as JSON by POST to /skk.Conversion/METHOD.
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	service, method, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if service != ServiceName {
+		http.NotFound(w, r)
+		return
+	}
+	switch method {
+	case "Lookup":
+		handle(w, r, s.Lookup)
+	case "Register":
+		if s.Authorize != nil && !s.Authorize(r) {
+			http.Error(w, ErrUnauthorized.Error(), http.StatusUnauthorized)
+			return
+		}
+		handle(w, r, s.Register)
+	case "Complete":
+		handle(w, r, s.Complete)
+	default:
+		http.NotFound(w, r)
+	}
+}
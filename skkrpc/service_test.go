@@ -0,0 +1,76 @@
+package skkrpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hymkor/go-readline-skk"
+	"github.com/hymkor/go-readline-skk/skkrpc"
+)
+
+func TestService(t *testing.T) {
+	M := skk.New()
+	M.System["かんじ"] = []string{"漢字;kanji", "感じ"}
+	M.System["かk"] = []string{"書"}
+	service := &skkrpc.Service{Mode: M}
+	ctx := context.Background()
+
+	resp, err := service.Lookup(ctx, &skkrpc.LookupRequest{Reading: "か*く"})
+	if err != nil || len(resp.Candidates) != 1 || resp.Candidates[0] != "書く" {
+		t.Fatalf("%v %v", resp, err)
+	}
+	if _, err := service.Register(ctx, &skkrpc.RegisterRequest{Reading: "かんじ", Word: "幹事"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if list := M.User["かんじ"]; len(list) != 3 || list[0] != "幹事" {
+		t.Fatalf("User: %v", list)
+	}
+	if _, err := service.Register(ctx, &skkrpc.RegisterRequest{Reading: "かんじ"}); err == nil {
+		t.Fatal("the empty word was accepted")
+	}
+
+	server := httptest.NewServer(service)
+	defer server.Close()
+	h := &skk.HTTPSource{URL: server.URL + "/" + skkrpc.ServiceName + "/Lookup"}
+	if list, ok := h.Lookup("かんじ"); !ok || len(list) != 3 || list[1] != "漢字;kanji" {
+		t.Fatalf("%v %v", list, ok)
+	}
+	if list, ok := h.Lookup("なし"); ok {
+		t.Fatalf("%v", list)
+	}
+	r, err := http.Post(server.URL+"/"+skkrpc.ServiceName+"/Complete", "application/json", strings.NewReader(`{"prefix":"か"}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		t.Fatalf("Complete: %s", r.Status)
+	}
+
+	service.Authorize = skkrpc.BearerToken("secret")
+	for _, token := range []string{"", "wrong", "secret"} {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/"+skkrpc.ServiceName+"/Register",
+			strings.NewReader(`{"reading":"かんじ","word":"監事"}`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		r.Body.Close()
+		expected := http.StatusUnauthorized
+		if token == "secret" {
+			expected = http.StatusOK
+		}
+		if r.StatusCode != expected {
+			t.Fatalf("Register with %q: %s", token, r.Status)
+		}
+	}
+	if list := M.User["かんじ"]; list[0] != "監事" {
+		t.Fatalf("User: %v", list)
+	}
+}
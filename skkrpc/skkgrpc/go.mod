@@ -0,0 +1,24 @@
+module github.com/hymkor/go-readline-skk/skkrpc/skkgrpc
+
+go 1.23
+
+require (
+	github.com/hymkor/go-readline-skk v0.0.0
+	google.golang.org/grpc v1.71.0
+	google.golang.org/protobuf v1.36.5
+)
+
+require (
+	github.com/atotto/clipboard v0.1.4 // indirect
+	github.com/mattn/go-isatty v0.0.19 // indirect
+	github.com/mattn/go-runewidth v0.0.14 // indirect
+	github.com/mattn/go-tty v0.0.5 // indirect
+	github.com/nyaosorg/go-readline-ny v0.13.1 // indirect
+	github.com/rivo/uniseg v0.4.4 // indirect
+	golang.org/x/net v0.34.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250115164207-1a7da9e5054f // indirect
+)
+
+replace github.com/hymkor/go-readline-skk => ../..
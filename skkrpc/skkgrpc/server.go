@@ -0,0 +1,92 @@
+// Package skkgrpc serves the conversion service of go-readline-skk by gRPC.
+// It is a module apart from go-readline-skk so that the readline
+// integration and skkrpc do not depend on gRPC.
+//
+// skk.pb.go and skk_grpc.pb.go are generated from ../skk.proto.
+// Server implements ConversionServer with skkrpc.Service.
+//
+//	M, _ := skk.Load("~/.skk-jisyo", "/usr/share/skk/SKK-JISYO.L")
+//	s := grpc.NewServer()
+//	skkgrpc.RegisterConversionServer(s, &skkgrpc.Server{
+//		Service:   &skkrpc.Service{Mode: M},
+//		Authorize: skkgrpc.BearerToken(token),
+//	})
+//	s.Serve(listener)
+package skkgrpc
+
+//go:generate protoc -I .. --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative skk.proto
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/hymkor/go-readline-skk/skkrpc"
+)
+
+// Server is ConversionServer calling the methods of Service.
+type Server struct {
+	UnimplementedConversionServer
+	Service *skkrpc.Service
+	// Authorize is called with the context of the requests of Register,
+	// and the request is refused with Unauthenticated when it returns false.
+	// When it is nil, anyone who can connect can register the words.
+	Authorize func(ctx context.Context) bool
+}
+
+// BearerToken returns the function for Server.Authorize which accepts
+// the requests with the metadata "authorization: Bearer token".
+func BearerToken(token string) func(ctx context.Context) bool {
+	expected := []byte("Bearer " + token)
+	return func(ctx context.Context) bool {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, value := range md.Get("authorization") {
+			if subtle.ConstantTimeCompare([]byte(value), expected) == 1 {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// statusOf returns the gRPC status for the error of skkrpc.Service.
+func statusOf(err error) error {
+	if errors.Is(err, skkrpc.ErrEmptyArgument) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// Lookup returns the candidates for the reading.
+func (s *Server) Lookup(ctx context.Context, req *LookupRequest) (*LookupResponse, error) {
+	resp, err := s.Service.Lookup(ctx, &skkrpc.LookupRequest{Reading: req.GetReading()})
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return &LookupResponse{Candidates: resp.Candidates}, nil
+}
+
+// Register adds the word to the user dictionary when Authorize accepts it.
+func (s *Server) Register(ctx context.Context, req *RegisterRequest) (*RegisterResponse, error) {
+	if s.Authorize != nil && !s.Authorize(ctx) {
+		return nil, status.Error(codes.Unauthenticated, skkrpc.ErrUnauthorized.Error())
+	}
+	_, err := s.Service.Register(ctx, &skkrpc.RegisterRequest{Reading: req.GetReading(), Word: req.GetWord()})
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return &RegisterResponse{}, nil
+}
+
+// Complete returns the readings starting with the prefix.
+func (s *Server) Complete(ctx context.Context, req *CompleteRequest) (*CompleteResponse, error) {
+	resp, err := s.Service.Complete(ctx, &skkrpc.CompleteRequest{Prefix: req.GetPrefix()})
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return &CompleteResponse{Readings: resp.Readings}, nil
+}
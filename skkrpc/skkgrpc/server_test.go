@@ -0,0 +1,64 @@
+package skkgrpc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/hymkor/go-readline-skk"
+	"github.com/hymkor/go-readline-skk/skkrpc"
+	"github.com/hymkor/go-readline-skk/skkrpc/skkgrpc"
+)
+
+func TestServer(t *testing.T) {
+	M := skk.New()
+	M.System["かんじ"] = []string{"漢字;kanji", "感じ"}
+	l := bufconn.Listen(1 << 16)
+	s := grpc.NewServer()
+	skkgrpc.RegisterConversionServer(s, &skkgrpc.Server{
+		Service:   &skkrpc.Service{Mode: M},
+		Authorize: skkgrpc.BearerToken("secret"),
+	})
+	go s.Serve(l)
+	defer s.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return l.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer conn.Close()
+	client := skkgrpc.NewConversionClient(conn)
+	ctx := context.Background()
+
+	resp, err := client.Lookup(ctx, &skkgrpc.LookupRequest{Reading: "かんじ"})
+	if err != nil || len(resp.Candidates) != 2 || resp.Candidates[0] != "漢字;kanji" {
+		t.Fatalf("Lookup: %v %v", resp, err)
+	}
+	if _, err := client.Lookup(ctx, &skkgrpc.LookupRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("empty reading: %v", err)
+	}
+	req := &skkgrpc.RegisterRequest{Reading: "かんじ", Word: "幹事"}
+	if _, err := client.Register(ctx, req); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("without token: %v", err)
+	}
+	authorized := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+	if _, err := client.Register(authorized, req); err != nil {
+		t.Fatal(err.Error())
+	}
+	if list := M.User["かんじ"]; len(list) == 0 || list[0] != "幹事" {
+		t.Fatalf("User: %v", list)
+	}
+	complete, err := client.Complete(ctx, &skkgrpc.CompleteRequest{Prefix: "かん"})
+	if err != nil || len(complete.Readings) != 1 || complete.Readings[0] != "かんじ" {
+		t.Fatalf("Complete: %v %v", complete, err)
+	}
+}
@@ -0,0 +1,229 @@
+package skkserv
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// Dialect is the differences of the skkserv implementations.
+type Dialect struct {
+	// UTF8 makes the requests and the replies UTF-8 instead of EUC-JP.
+	UTF8 bool
+	// NoCompletion means that the server does not support the completion
+	// request "4", which some servers treat as an error.
+	NoCompletion bool
+	// Newline appends a newline after the space which terminates the request,
+	// for the servers which read the requests by lines.
+	Newline bool
+}
+
+// Dialects is the dialects of the known servers by their names.
+var Dialects = map[string]Dialect{
+	"skkserv":        {},
+	"yaskkserv2":     {},
+	"dbskkd-cdb":     {NoCompletion: true},
+	"google-ime-skk": {NoCompletion: true},
+	"utf-8":          {UTF8: true},
+}
+
+// ErrUnknownDialect is an error that means the name is not in Dialects.
+var ErrUnknownDialect = errors.New("unknown skkserv dialect")
+
+// LookupDialect returns the dialect named name in Dialects.
+// The name may have "+utf-8" to use UTF-8 with the dialect
+// such as "yaskkserv2+utf-8". The empty name is the original skkserv.
+func LookupDialect(name string) (Dialect, error) {
+	base, encoding, _ := strings.Cut(strings.ToLower(name), "+")
+	if base == "" {
+		base = "skkserv"
+	}
+	d, ok := Dialects[base]
+	if !ok {
+		return Dialect{}, fmt.Errorf("%q: %w", name, ErrUnknownDialect)
+	}
+	switch encoding {
+	case "":
+	case "utf-8", "utf8":
+		d.UTF8 = true
+	case "euc-jp", "eucjp":
+		d.UTF8 = false
+	default:
+		return Dialect{}, fmt.Errorf("%q: unknown encoding", encoding)
+	}
+	return d, nil
+}
+
+// defaultClientTimeout is the limit of a request when Client.Timeout is zero.
+const defaultClientTimeout = 3 * time.Second
+
+// Client is skk.CandidateSource which looks up the candidates
+// from a skkserv. It connects to the server on the first request
+// and reconnects after an error.
+type Client struct {
+	// Addr is the address of the server such as "localhost:1178".
+	Addr string
+	// Dialect is the protocol of the server.
+	Dialect Dialect
+	// Timeout is the limit of a request. When it is zero, 3 seconds is used.
+	Timeout time.Duration
+	// TLSConfig makes the connection TLS when it is not nil.
+	// Set Certificates of it for the servers which authenticate
+	// the clients by the certificates.
+	TLSConfig *tls.Config
+
+	conn  net.Conn
+	r     *bufio.Reader
+	mutex sync.Mutex
+}
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return defaultClientTimeout
+}
+
+func (c *Client) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: c.timeout()}
+	if c.TLSConfig != nil {
+		return tls.DialWithDialer(dialer, "tcp", c.Addr, c.TLSConfig)
+	}
+	return dialer.Dial("tcp", c.Addr)
+}
+
+// do sends the request and reads the reply until delim.
+// The connection is closed when ctx is done before the reply.
+// It must be called with c.mutex locked.
+func (c *Client) do(ctx context.Context, request string, delim byte) (string, error) {
+	if c.conn == nil {
+		conn, err := c.dial()
+		if err != nil {
+			return "", err
+		}
+		c.conn = conn
+		c.r = bufio.NewReader(conn)
+	}
+	deadline := time.Now().Add(c.timeout())
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetDeadline(deadline)
+	conn := c.conn
+	stop := context.AfterFunc(ctx, func() {
+		// 読み込み中の ReadString を止める
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+	reply, err := func() (string, error) {
+		if _, err := c.conn.Write([]byte(request)); err != nil {
+			return "", err
+		}
+		return c.r.ReadString(delim)
+	}()
+	if err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return "", err
+	}
+	return reply, nil
+}
+
+// request sends cmd with key and returns the items of the reply
+// "1/item1/item2/" or false when not found.
+func (c *Client) request(ctx context.Context, cmd byte, key string) ([]string, bool, error) {
+	encoded, ok := c.encode(key)
+	if !ok {
+		return nil, false, nil
+	}
+	request := string(cmd) + encoded + " "
+	if c.Dialect.Newline {
+		request += "\n"
+	}
+	c.mutex.Lock()
+	reply, err := c.do(ctx, request, '\n')
+	c.mutex.Unlock()
+	if err != nil {
+		return nil, false, err
+	}
+	reply = strings.TrimRight(reply, "\r\n")
+	if !strings.HasPrefix(reply, "1/") {
+		return nil, false, nil
+	}
+	var list []string
+	for _, item := range strings.Split(reply[2:], "/") {
+		if item != "" {
+			list = append(list, c.decode(item))
+		}
+	}
+	return list, len(list) > 0, nil
+}
+
+// Lookup returns the candidates for source from the server.
+func (c *Client) Lookup(source string) ([]string, bool) {
+	return c.LookupContext(context.Background(), source)
+}
+
+// LookupContext is Lookup which gives up the reply when ctx is canceled.
+func (c *Client) LookupContext(ctx context.Context, source string) ([]string, bool) {
+	list, ok, _ := c.request(ctx, cmdRequest, source)
+	return list, ok
+}
+
+// Complete returns the midashi starting with prefix from the server.
+// It returns nil when the dialect does not support the completion.
+func (c *Client) Complete(prefix string) []string {
+	if c.Dialect.NoCompletion {
+		return nil
+	}
+	list, _, _ := c.request(context.Background(), cmdComplete, prefix)
+	return list
+}
+
+// Version returns the version of the server.
+func (c *Client) Version() (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	reply, err := c.do(context.Background(), string(cmdVersion), ' ')
+	return strings.TrimSpace(reply), err
+}
+
+// Close sends the disconnect request and closes the connection.
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	c.conn.Write([]byte{cmdDisconnect})
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+func (c *Client) encode(text string) (string, bool) {
+	if c.Dialect.UTF8 {
+		return text, true
+	}
+	encoded, err := japanese.EUCJP.NewEncoder().String(text)
+	return encoded, err == nil
+}
+
+func (c *Client) decode(text string) string {
+	if c.Dialect.UTF8 {
+		return text
+	}
+	decoded, err := japanese.EUCJP.NewDecoder().String(text)
+	if err != nil {
+		return text
+	}
+	return decoded
+}
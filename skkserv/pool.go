@@ -0,0 +1,245 @@
+package skkserv
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"github.com/hymkor/go-readline-skk"
+)
+
+// The defaults of Pool when the fields are zero.
+const (
+	defaultMaxIdle    = 2
+	defaultBackoff    = time.Second
+	defaultMaxBackoff = time.Minute
+)
+
+// Pool is skk.CandidateSource which looks up the candidates from
+// several skkservs. The servers are asked in the order of Addrs,
+// and a server which failed is skipped until it answers the version
+// request again, so a server down does not freeze every conversion.
+// The connections are kept for the next requests and can be used
+// from goroutines concurrently.
+type Pool struct {
+	// Addrs is the addresses of the servers in the order of the preference.
+	Addrs []string
+	// Dialect is the protocol of the servers.
+	Dialect Dialect
+	// Timeout is the limit of a request. When it is zero, 3 seconds is used.
+	Timeout time.Duration
+	// TLSConfig makes the connections TLS when it is not nil. See Client.
+	TLSConfig *tls.Config
+	// MaxIdle is the number of the connections kept for each server.
+	// When it is zero, 2 is used.
+	MaxIdle int
+	// Backoff is the wait before the first health check of a server failed.
+	// It is doubled on each failure up to MaxBackoff.
+	// When they are zero, 1 second and 1 minute are used.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Fallback is the source looked up when no server is available,
+	// such as skk.Jisyo loaded in memory. It may be nil.
+	Fallback skk.CandidateSource
+	// Logger receives the failures and the recoveries of the servers.
+	// It may be nil.
+	Logger skk.Logger
+
+	once      sync.Once
+	endpoints []*endpoint
+}
+
+// endpoint is the state of one server in Pool.
+type endpoint struct {
+	addr     string
+	idle     chan *Client
+	mutex    sync.Mutex
+	failures int
+	retryAt  time.Time
+	probing  bool
+}
+
+func (p *Pool) init() {
+	p.once.Do(func() {
+		maxIdle := p.MaxIdle
+		if maxIdle <= 0 {
+			maxIdle = defaultMaxIdle
+		}
+		for _, addr := range p.Addrs {
+			p.endpoints = append(p.endpoints, &endpoint{
+				addr: addr,
+				idle: make(chan *Client, maxIdle),
+			})
+		}
+	})
+}
+
+func (p *Pool) debugf(format string, v ...any) {
+	if p.Logger != nil {
+		p.Logger.Printf(format, v...)
+	}
+}
+
+func (p *Pool) newClient(ep *endpoint) *Client {
+	return &Client{
+		Addr:      ep.addr,
+		Dialect:   p.Dialect,
+		Timeout:   p.Timeout,
+		TLSConfig: p.TLSConfig,
+	}
+}
+
+func (p *Pool) get(ep *endpoint) *Client {
+	select {
+	case c := <-ep.idle:
+		return c
+	default:
+		return p.newClient(ep)
+	}
+}
+
+func (p *Pool) put(ep *endpoint, c *Client) {
+	select {
+	case ep.idle <- c:
+	default:
+		c.Close()
+	}
+}
+
+func (p *Pool) backoff(failures int) time.Duration {
+	d := p.Backoff
+	if d <= 0 {
+		d = defaultBackoff
+	}
+	max := p.MaxBackoff
+	if max <= 0 {
+		max = defaultMaxBackoff
+	}
+	for i := 1; i < failures && d < max; i++ {
+		d *= 2
+	}
+	return min(d, max)
+}
+
+// fail marks ep as down until the next health check.
+func (p *Pool) fail(ep *endpoint, err error) {
+	ep.mutex.Lock()
+	ep.failures++
+	ep.retryAt = time.Now().Add(p.backoff(ep.failures))
+	ep.mutex.Unlock()
+	p.debugf("skkserv %s: %v", ep.addr, err)
+}
+
+// available reports whether ep can be asked now.
+// When the wait of ep is over, it starts the health check in background
+// and ep is skipped until it succeeds.
+func (p *Pool) available(ep *endpoint) bool {
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+	if ep.failures <= 0 {
+		return true
+	}
+	if !ep.probing && !time.Now().Before(ep.retryAt) {
+		ep.probing = true
+		go p.probe(ep)
+	}
+	return false
+}
+
+func (p *Pool) probe(ep *endpoint) {
+	c := p.newClient(ep)
+	_, err := c.Version()
+	// 応答は最初の空白までしか読まれないので、接続を使い回さずに閉じる
+	c.Close()
+	if err != nil {
+		p.fail(ep, err)
+	} else {
+		p.debugf("skkserv %s: recovered", ep.addr)
+	}
+	ep.mutex.Lock()
+	if err == nil {
+		ep.failures = 0
+	}
+	ep.probing = false
+	ep.mutex.Unlock()
+}
+
+// request asks cmd with key to the first server available.
+// answered is false when no server is available.
+// When ctx is done, the servers are not asked any more and
+// the server asked is not marked as down.
+func (p *Pool) request(ctx context.Context, cmd byte, key string) (list []string, ok, answered bool) {
+	p.init()
+	for _, ep := range p.endpoints {
+		if ctx.Err() != nil {
+			return nil, false, true
+		}
+		if !p.available(ep) {
+			continue
+		}
+		c := p.get(ep)
+		list, ok, err := c.request(ctx, cmd, key)
+		if err != nil && ctx.Err() != nil {
+			p.put(ep, c)
+			return nil, false, true
+		}
+		if err != nil {
+			p.fail(ep, err)
+			continue
+		}
+		p.put(ep, c)
+		return list, ok, true
+	}
+	return nil, false, false
+}
+
+// Lookup returns the candidates for source from the first server available,
+// or from Fallback when no server is available.
+func (p *Pool) Lookup(source string) ([]string, bool) {
+	return p.LookupContext(context.Background(), source)
+}
+
+// LookupContext is Lookup which gives up the servers when ctx is canceled.
+// Fallback is not looked up then because the conversion looks up
+// the sources after Pool instead.
+func (p *Pool) LookupContext(ctx context.Context, source string) ([]string, bool) {
+	if list, ok, answered := p.request(ctx, cmdRequest, source); answered {
+		return list, ok
+	}
+	if p.Fallback != nil {
+		return p.Fallback.Lookup(source)
+	}
+	return nil, false
+}
+
+// Complete returns the midashi starting with prefix from the first server
+// available, or from Fallback when it is skk.Completer.
+func (p *Pool) Complete(prefix string) []string {
+	if !p.Dialect.NoCompletion {
+		if list, _, answered := p.request(context.Background(), cmdComplete, prefix); answered {
+			return list
+		}
+	}
+	if c, ok := p.Fallback.(skk.Completer); ok {
+		return c.Complete(prefix)
+	}
+	return nil
+}
+
+// Close closes the connections kept.
+func (p *Pool) Close() error {
+	p.init()
+	for _, ep := range p.endpoints {
+		for {
+			select {
+			case c := <-ep.idle:
+				c.Close()
+				continue
+			default:
+			}
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+// Package skkserv implements the skkserv protocol, which is the dictionary
+// server of SKK used by yaskkserv, dbskkd-cdb and so on.
+package skkserv
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/text/encoding/japanese"
+
+	"github.com/hymkor/go-readline-skk"
+)
+
+// DefaultPort is the port number of skkserv.
+const DefaultPort = "1178"
+
+// DefaultVersion is the reply to the version request when Server.Version is empty.
+const DefaultVersion = "go-readline-skk.0.1 "
+
+// The commands of the protocol: the first byte of a request.
+const (
+	cmdDisconnect = '0'
+	cmdRequest    = '1'
+	cmdVersion    = '2'
+	cmdHostname   = '3'
+	cmdComplete   = '4'
+)
+
+// Server serves the skkserv protocol with the candidates of Source.
+type Server struct {
+	// Source is the dictionary to look up. When it implements skk.Completer,
+	// the completion requests are served too.
+	Source skk.CandidateSource
+	// UTF8 makes the requests and the replies UTF-8.
+	// When it is false, they are EUC-JP as the traditional skkserv.
+	UTF8 bool
+	// Version is the reply to the version request.
+	// When it is empty, DefaultVersion is used.
+	Version string
+	// TLSConfig makes ListenAndServe accept TLS connections when it is not nil.
+	// Set ClientAuth and ClientCAs of it to accept only the clients
+	// with the certificates.
+	TLSConfig *tls.Config
+	// Logger receives the trace of the requests. It may be nil.
+	Logger skk.Logger
+}
+
+func (s *Server) debugf(format string, v ...any) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, v...)
+	}
+}
+
+// Serve accepts connections on l and serves each of them in a goroutine.
+// It returns the error of Accept, such as when l is closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := s.ServeConn(conn); err != nil {
+				s.debugf("%s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve.
+// When addr is empty, ":1178" is used.
+func (s *Server) ListenAndServe(addr string) error {
+	if addr == "" {
+		addr = ":" + DefaultPort
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if s.TLSConfig != nil {
+		l = tls.NewListener(l, s.TLSConfig)
+	}
+	defer l.Close()
+	return s.Serve(l)
+}
+
+// ServeConn serves the requests from conn until the client disconnects.
+// It returns nil when the client sends the disconnect request or closes conn.
+func (s *Server) ServeConn(conn io.ReadWriter) error {
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		cmd, err := r.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		switch cmd {
+		case cmdDisconnect:
+			return nil
+		case cmdRequest, cmdComplete:
+			arg, err := r.ReadString(' ')
+			if err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+			key := s.decode(strings.TrimRight(arg, " \r\n"))
+			s.debugf("%c %q", cmd, key)
+			var list []string
+			var ok bool
+			if cmd == cmdRequest {
+				list, ok = s.Source.Lookup(key)
+			} else if c, _ := s.Source.(skk.Completer); c != nil {
+				list = c.Complete(key)
+				ok = len(list) > 0
+			}
+			if ok {
+				w.WriteString("1/")
+				for _, candidate := range list {
+					if e, ok := s.encode(candidate); ok {
+						w.WriteString(e)
+						w.WriteByte('/')
+					}
+				}
+				w.WriteByte('\n')
+			} else {
+				w.WriteByte('4')
+				w.WriteString(strings.TrimRight(arg, " \r\n"))
+				w.WriteByte('\n')
+			}
+		case cmdVersion:
+			if s.Version != "" {
+				w.WriteString(s.Version)
+			} else {
+				w.WriteString(DefaultVersion)
+			}
+		case cmdHostname:
+			w.WriteString(hostname(conn))
+		case '\r', '\n', ' ':
+			continue
+		default:
+			s.debugf("unknown request %q", cmd)
+			continue
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// hostname returns the reply to the hostname request: "HOSTNAME:ADDRESS: "
+func hostname(conn io.ReadWriter) string {
+	name, err := os.Hostname()
+	if err != nil {
+		name = "localhost"
+	}
+	addr := "0.0.0.0"
+	if c, ok := conn.(net.Conn); ok {
+		if host, _, err := net.SplitHostPort(c.LocalAddr().String()); err == nil {
+			addr = host
+		}
+	}
+	return name + ":" + addr + ": "
+}
+
+func (s *Server) decode(text string) string {
+	if s.UTF8 {
+		return text
+	}
+	decoded, err := japanese.EUCJP.NewDecoder().String(text)
+	if err != nil {
+		return text
+	}
+	return decoded
+}
+
+// encode converts text for the client. It returns false when text
+// can not be represented in EUC-JP, such as emoji.
+func (s *Server) encode(text string) (string, bool) {
+	if s.UTF8 {
+		return text, true
+	}
+	encoded, err := japanese.EUCJP.NewEncoder().String(text)
+	return encoded, err == nil
+}
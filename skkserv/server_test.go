@@ -0,0 +1,177 @@
+package skkserv_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/japanese"
+
+	"github.com/hymkor/go-readline-skk"
+	"github.com/hymkor/go-readline-skk/skkserv"
+)
+
+func TestServeConn(t *testing.T) {
+	jisyo := skk.Jisyo{
+		"かんじ":  {"漢字", "感じ"},
+		"かんじゃ": {"患者"},
+		"えもじ":  {"😀"},
+	}
+	for _, utf8 := range []bool{true, false} {
+		client, conn := net.Pipe()
+		server := &skkserv.Server{Source: jisyo, UTF8: utf8}
+		done := make(chan error, 1)
+		go func() { done <- server.ServeConn(conn) }()
+
+		encode := func(s string) string {
+			if utf8 {
+				return s
+			}
+			e, _ := japanese.EUCJP.NewEncoder().String(s)
+			return e
+		}
+		r := bufio.NewReader(client)
+		for _, p := range [][2]string{
+			{"1かんじ ", "1/漢字/感じ/\n"},
+			{"1なし ", "4なし\n"},
+			{"4かんじ ", "1/かんじ/かんじゃ/\n"},
+		} {
+			client.Write([]byte(encode(p[0])))
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if line != encode(p[1]) {
+				t.Fatalf("utf8=%v: %q: %q", utf8, p[0], line)
+			}
+		}
+		client.Write([]byte("1" + encode("えもじ") + " "))
+		line, _ := r.ReadString('\n')
+		if expect := map[bool]string{true: "1/😀/\n", false: "1/\n"}[utf8]; line != expect {
+			t.Fatalf("utf8=%v: emoji: %q", utf8, line)
+		}
+		client.Write([]byte("0"))
+		if err := <-done; err != nil {
+			t.Fatal(err.Error())
+		}
+		client.Close()
+	}
+}
+
+func TestClient(t *testing.T) {
+	jisyo := skk.Jisyo{
+		"かんじ":  {"漢字", "感じ"},
+		"かんじゃ": {"患者"},
+	}
+	for _, name := range []string{"", "yaskkserv2+utf-8", "dbskkd-cdb"} {
+		dialect, err := skkserv.LookupDialect(name)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Skip(err.Error())
+		}
+		server := &skkserv.Server{Source: jisyo, UTF8: dialect.UTF8}
+		go server.Serve(l)
+
+		client := &skkserv.Client{Addr: l.Addr().String(), Dialect: dialect}
+		if list, ok := client.Lookup("かんじ"); !ok || len(list) != 2 || list[1] != "感じ" {
+			t.Fatalf("%q: %v %v", name, list, ok)
+		}
+		if list, ok := client.Lookup("なし"); ok {
+			t.Fatalf("%q: %v", name, list)
+		}
+		list := client.Complete("かん")
+		if dialect.NoCompletion {
+			if list != nil {
+				t.Fatalf("%q: %v", name, list)
+			}
+		} else if len(list) != 2 || list[1] != "かんじゃ" {
+			t.Fatalf("%q: %v", name, list)
+		}
+		if v, err := client.Version(); err != nil || v+" " != skkserv.DefaultVersion {
+			t.Fatalf("%q: %q %v", name, v, err)
+		}
+		client.Close()
+		l.Close()
+	}
+	if _, err := skkserv.LookupDialect("foo"); err == nil {
+		t.Fatal("unknown dialect was accepted")
+	}
+}
+
+func TestPool(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err.Error())
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	pool := &skkserv.Pool{
+		Addrs:    []string{addr},
+		Backoff:  10 * time.Millisecond,
+		Fallback: skk.Jisyo{"かんじ": {"幹事"}},
+	}
+	defer pool.Close()
+	if list, ok := pool.Lookup("かんじ"); !ok || list[0] != "幹事" {
+		t.Fatalf("fallback: %v %v", list, ok)
+	}
+
+	l, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip(err.Error())
+	}
+	defer l.Close()
+	// 空白を含む版数でも回復後の接続がずれないこと
+	server := &skkserv.Server{Source: skk.Jisyo{"かんじ": {"漢字"}}, Version: "skkserv 1.0 "}
+	go server.Serve(l)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		list, ok := pool.Lookup("かんじ")
+		if !ok || list[0] != "幹事" {
+			if len(list) != 1 || list[0] != "漢字" {
+				t.Fatalf("recovered: %q %v", list, ok)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("not recovered: %v %v", list, ok)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if list := pool.Complete("かん"); len(list) != 1 || list[0] != "かんじ" {
+		t.Fatalf("Complete: %v", list)
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(nil)
+	ts.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err.Error())
+	}
+	server := &skkserv.Server{Source: skk.Jisyo{"かんじ": {"漢字"}}}
+	go server.Serve(tls.NewListener(l, &tls.Config{Certificates: ts.TLS.Certificates}))
+	defer l.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	client := &skkserv.Client{Addr: l.Addr().String(), TLSConfig: &tls.Config{RootCAs: roots}}
+	defer client.Close()
+	if list, ok := client.Lookup("かんじ"); !ok || list[0] != "漢字" {
+		t.Fatalf("%v %v", list, ok)
+	}
+	plain := &skkserv.Client{Addr: l.Addr().String(), Timeout: time.Second}
+	if list, ok := plain.Lookup("かんじ"); ok {
+		t.Fatalf("without TLS: %v", list)
+	}
+}
@@ -0,0 +1,124 @@
+//go:build !js && !plan9
+
+// Package skktest drives go-readline-skk without a terminal
+// to write the regression tests of the input behavior.
+//
+//	M := skk.New()
+//	M.System["かんじ"] = []string{"漢字", "感じ"}
+//	text, err := skktest.Type(M, skktest.Keys("K a n j i SPC SPC C-j RET")...)
+//	// text == "感じ"
+package skktest
+
+import (
+	"context"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hymkor/go-readline-skk"
+	rl "github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+// Tty is a fake terminal which types the keys given one by one.
+type Tty struct {
+	keys []string
+}
+
+// Open does nothing.
+func (*Tty) Open() error { return nil }
+
+// Close does nothing.
+func (*Tty) Close() error { return nil }
+
+// Raw does nothing.
+func (*Tty) Raw() (func() error, error) {
+	return func() error { return nil }, nil
+}
+
+// ReadRune returns the next rune of the keys.
+// When no keys are left, it returns io.EOF and the editor stops.
+func (T *Tty) ReadRune() (rune, error) {
+	for len(T.keys) > 0 && T.keys[0] == "" {
+		T.keys = T.keys[1:]
+	}
+	if len(T.keys) <= 0 {
+		return 0, io.EOF
+	}
+	r, size := utf8.DecodeRuneInString(T.keys[0])
+	T.keys[0] = T.keys[0][size:]
+	return r, nil
+}
+
+// Buffered reports whether the key being read has more runes,
+// so that an escape sequence is read as one key.
+func (T *Tty) Buffered() bool {
+	return len(T.keys) > 0 && T.keys[0] != ""
+}
+
+// Size returns 80 columns and 25 lines.
+func (*Tty) Size() (int, int, error) {
+	return 80, 25, nil
+}
+
+// GetResizeNotifier returns the function which never notifies.
+func (*Tty) GetResizeNotifier() func() (int, int, bool) {
+	return func() (int, int, bool) { return 80, 25, false }
+}
+
+// Keys splits the names of keys separated by spaces.
+// "SPC" is a space, "RET" is Enter and the names of go-readline-ny
+// such as "C-j" are available. Other names are typed as they are.
+func Keys(names string) []string {
+	var result []string
+	for _, name := range strings.Fields(names) {
+		switch keys.NormalizeName(name) {
+		case "SPC", "SPACE":
+			result = append(result, " ")
+		case "RET":
+			result = append(result, string(keys.Enter))
+		default:
+			if code, ok := keys.NameToCode[keys.NormalizeName(name)]; ok && len(name) > 1 {
+				result = append(result, string(code))
+			} else {
+				result = append(result, name)
+			}
+		}
+	}
+	return result
+}
+
+// Type starts the SKK mode M with Ctrl-J on a new editor, types keyStrokes
+// and returns the text when the line is accepted.
+// When the keys run out before the line is accepted, io.EOF is returned.
+func Type(M *skk.Mode, keyStrokes ...string) (string, error) {
+	return TypeContext(context.Background(), M, keyStrokes...)
+}
+
+// Output is the writer where Type writes the output to the terminal.
+// When it is nil, the output is discarded.
+var Output io.Writer
+
+// TypeContext is the same as Type with ctx.
+func TypeContext(ctx context.Context, M *skk.Mode, keyStrokes ...string) (string, error) {
+	return TypeEditor(ctx, &rl.Editor{}, M, keyStrokes...)
+}
+
+// TypeEditor is the same as TypeContext on editor, which may have
+// the key bindings of the test. The terminal, the writer and the prompt
+// of editor are replaced.
+func TypeEditor(ctx context.Context, editor *rl.Editor, M *skk.Mode, keyStrokes ...string) (string, error) {
+	tty := &Tty{keys: append([]string{string(keys.CtrlJ)}, keyStrokes...)}
+	var out io.Writer = io.Discard
+	if Output != nil {
+		out = Output
+	}
+	editor.Tty = tty
+	editor.Writer = out
+	editor.Prompt = func() (int, error) { return 0, nil }
+	editor.BindKey(keys.CtrlJ, M)
+	promptTty := M.PromptTty
+	M.PromptTty = tty
+	defer func() { M.PromptTty = promptTty }()
+	return editor.ReadLine(ctx)
+}
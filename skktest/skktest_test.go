@@ -0,0 +1,763 @@
+//go:build !js && !plan9
+
+package skktest_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	rl "github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
+
+	"github.com/hymkor/go-readline-skk"
+	"github.com/hymkor/go-readline-skk/skktest"
+)
+
+func TestType(t *testing.T) {
+	M := skk.New()
+	M.System["かんじ"] = []string{"漢字", "感じ"}
+	text, err := skktest.Type(M, skktest.Keys("K a n j i SPC SPC C-j RET")...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if text != "感じ" {
+		t.Fatalf("%q", text)
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	M := skk.New()
+	text, err := skktest.Type(M, skktest.Keys("K a n a SPC a i RET RET")...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if text != "あい" {
+		t.Fatalf("%q", text)
+	}
+	if list := M.User["かな"]; len(list) != 1 || list[0] != "あい" {
+		t.Fatalf("%#v", list)
+	}
+}
+
+func TestOkuriAriRegistration(t *testing.T) {
+	M := skk.New()
+	for _, c := range []struct {
+		keys     string
+		expected string
+		source   string
+		word     string
+	}{
+		// 子音で始まる送り仮名は登録後に続けて入力する
+		{"K a K a i RET u RET", "あいく", "かk", "あい"},
+		// 送り仮名まで入力された時は語幹だけを登録する
+		{"K a I u i RET RET", "うい", "かi", "う"},
+	} {
+		text, err := skktest.Type(M, skktest.Keys(c.keys)...)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if text != c.expected {
+			t.Fatalf("%s: %q expected %q", c.keys, text, c.expected)
+		}
+		if list := M.User[c.source]; len(list) != 1 || list[0] != c.word {
+			t.Fatalf("%s: %#v", c.keys, list)
+		}
+	}
+}
+
+func TestOkuriAriCancel(t *testing.T) {
+	M := skk.New()
+	M.System["かi"] = []string{"買"}
+	M.System["かk"] = []string{"書"}
+	for _, c := range []struct {
+		keys     string
+		expected string
+	}{
+		// 最初の候補から戻ると入力された送り仮名のまま ▽ に戻る
+		{"K a I x RET", "かい"},
+		{"K a K x RET", "かk"},
+		// 戻した見出しはそのまま送り仮名つきで変換し直せる
+		{"K a I x SPC RET RET", "買い"},
+		{"K a K x SPC u RET", "書く"},
+		// 見出しを変えた時は送り仮名なしで変換する
+		{"K a I x Backspace SPC RET RET", "か"},
+	} {
+		text, err := skktest.Type(M, skktest.Keys(c.keys)...)
+		if err != nil {
+			t.Fatalf("%s: %v", c.keys, err)
+		}
+		if text != c.expected {
+			t.Fatalf("%s: %q expected %q", c.keys, text, c.expected)
+		}
+	}
+}
+
+func TestPurgeSystemCandidate(t *testing.T) {
+	M := skk.New()
+	M.System["かんじ"] = []string{"漢字", "感じ"}
+	M.System["かい"] = []string{"貝"}
+	for _, c := range []struct {
+		keys     string
+		expected string
+		source   string
+		user     []string
+	}{
+		{"K a n j i SPC X y e s RET RET", "", "かんじ", []string{"感じ", `(skk-ignore-dic-word "漢字")`}},
+		{"K a n j i SPC RET RET", "感じ", "かんじ", []string{"感じ", `(skk-ignore-dic-word "漢字")`}},
+		// 最後の候補を消してもシステム辞書の候補は戻らない
+		{"K a n j i SPC X y e s RET RET", "", "かんじ", []string{`(skk-ignore-dic-word "漢字" "感じ")`}},
+		{"K a i SPC X y e s RET RET", "", "かい", []string{`(skk-ignore-dic-word "貝")`}},
+		{"K a i SPC RET RET", "かい", "かい", []string{`(skk-ignore-dic-word "貝")`}},
+	} {
+		text, err := skktest.Type(M, skktest.Keys(c.keys)...)
+		if err != nil {
+			t.Fatalf("%s: %v", c.keys, err)
+		}
+		if text != c.expected {
+			t.Fatalf("%s: %q expected %q", c.keys, text, c.expected)
+		}
+		if list := M.User[c.source]; !slices.Equal(list, c.user) {
+			t.Fatalf("%s: %q expected %q", c.keys, list, c.user)
+		}
+	}
+}
+
+// slowSource is skk.ContextSource which answers nothing until canceled.
+type slowSource struct{}
+
+func (slowSource) Lookup(source string) ([]string, bool) {
+	return nil, false
+}
+
+func (slowSource) LookupContext(ctx context.Context, source string) ([]string, bool) {
+	<-ctx.Done()
+	return nil, false
+}
+
+// stubbornSource is skk.ContextSource which answers nothing until
+// the channel is closed, ignoring the cancel.
+type stubbornSource chan struct{}
+
+func (s stubbornSource) Lookup(source string) ([]string, bool) {
+	<-s
+	return nil, false
+}
+
+func (s stubbornSource) LookupContext(ctx context.Context, source string) ([]string, bool) {
+	return s.Lookup(source)
+}
+
+func TestRemoteLookup(t *testing.T) {
+	M := skk.New()
+	M.System["かんじ"] = []string{"漢字"}
+	M.Sources = []skk.CandidateSource{slowSource{}, M.User, M.System}
+	for _, c := range []struct {
+		keys     string
+		timeout  time.Duration
+		expected string
+	}{
+		// 応答しないサーバーは諦めて後の辞書を引き、待つ間のキーは失わない
+		{"K a n j i SPC RET RET", 100 * time.Millisecond, "漢字"},
+		// 見つからない時は登録モードに入らずに先に打たれたキーを処理する
+		{"K a n a SPC RET", 100 * time.Millisecond, "かな"},
+		// C-g で検索を中止して ▽ に戻る
+		{"K a n j i SPC C-g RET", 10 * time.Second, "かんじ"},
+		// 先に打ったキーの後の C-g でも中止する
+		{"K a n j i SPC a C-g RET", 10 * time.Second, "かんじ"},
+	} {
+		M.RemoteTimeout = c.timeout
+		start := time.Now()
+		text, err := skktest.Type(M, skktest.Keys(c.keys)...)
+		if err != nil {
+			t.Fatalf("%s: %v", c.keys, err)
+		}
+		if text != c.expected {
+			t.Fatalf("%s: %q expected %q", c.keys, text, c.expected)
+		}
+		if elapsed := time.Since(start); elapsed >= c.timeout+time.Second {
+			t.Fatalf("%s: %v", c.keys, elapsed)
+		}
+	}
+}
+
+func TestRemoteLookupStubborn(t *testing.T) {
+	stubborn := make(stubbornSource)
+	defer close(stubborn)
+	M := skk.New()
+	M.Sources = []skk.CandidateSource{stubborn, M.User, M.System}
+	M.RemoteTimeout = 10 * time.Second
+	start := time.Now()
+	// ctx を無視する辞書でも C-g ですぐに戻る
+	text, err := skktest.Type(M, skktest.Keys("K a n j i SPC a C-g RET")...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if text != "かんじ" {
+		t.Fatalf("%q", text)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("%v", elapsed)
+	}
+}
+
+func TestNestedRegistrationSaved(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "skk-jisyo")
+	M, err := skk.NewWithOptions(skk.WithUserJisyo(fname))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	// 入れ子の登録で「かん」を登録してから外側の登録を取り消す
+	if _, err := skktest.Type(M, skktest.Keys("K a n j i SPC K a n n SPC a RET C-h RET C-g RET")...); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := M.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+	j := skk.Jisyo{}
+	if err := j.Load(fname); err != nil {
+		t.Fatal(err.Error())
+	}
+	if list := j["かん"]; !slices.Equal(list, []string{"あ"}) {
+		t.Fatalf("%q", j)
+	}
+	if m := M.Metrics(); m.Registrations != 1 {
+		t.Fatalf("Registrations=%d", m.Registrations)
+	}
+}
+
+func TestMaxRegistrationDepth(t *testing.T) {
+	M := skk.New()
+	M.MaxRegistrationDepth = 1
+	// 登録中に見つからない見出しを変換しても登録モードを重ねない
+	text, err := skktest.Type(M, skktest.Keys("K a n j i SPC K a n a SPC RET RET")...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if text != "かな" {
+		t.Fatalf("%q", text)
+	}
+	if list := M.User["かんじ"]; !slices.Equal(list, []string{"かな"}) || len(M.User) != 1 {
+		t.Fatalf("%q", M.User)
+	}
+}
+
+func TestRegistrationAnnotated(t *testing.T) {
+	M := skk.New()
+	M.System["かな"] = []string{"仮名;kana"}
+	// 候補の最後から登録モードに入り、注釈つきの候補と同じ単語を登録する
+	text, err := skktest.Type(M, skktest.Keys("K a n a SPC SPC K a n a SPC RET RET RET")...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if text != "仮名" {
+		t.Fatalf("%q", text)
+	}
+	if list := M.User["かな"]; len(list) != 1 || list[0] != "仮名;kana" {
+		t.Fatalf("%#v", list)
+	}
+	if err := M.Register("かな", "假名;old"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := M.Register("かな", "假名"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if list := M.User["かな"]; !slices.Equal(list, []string{"假名;old", "仮名;kana"}) {
+		t.Fatalf("%#v", list)
+	}
+}
+
+func TestRegistrationSemicolon(t *testing.T) {
+	M := skk.New()
+	// 登録する単語の ; は注釈の区切りにしない
+	text, err := skktest.Type(M, skktest.Keys("K a o SPC l ^ ; ^ RET RET RET")...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if text != "^;^" {
+		t.Fatalf("%q", text)
+	}
+	text, err = skktest.Type(M, skktest.Keys("K a o SPC RET RET")...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if text != "^;^" {
+		t.Fatalf("%q", text)
+	}
+	list, err := M.Convert("かお")
+	if err != nil || len(list) != 1 || list[0].Text != "^;^" || list[0].Annotation != "" {
+		t.Fatalf("%v %v", list, err)
+	}
+}
+
+func TestCallOptions(t *testing.T) {
+	M := skk.New()
+	ctx := skk.WithCallOptions(context.Background(), skk.CallOptions{NoRegistration: true, Katakana: true})
+	text, err := skktest.TypeContext(ctx, M, skktest.Keys("K a n a SPC C-g a RET")...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if text != "ア" {
+		t.Fatalf("%q", text)
+	}
+}
+
+func TestEmptyMidashi(t *testing.T) {
+	M := skk.New()
+	M.System["かんじ"] = []string{"漢字"}
+	for _, c := range []struct {
+		keys     string
+		expected string
+	}{
+		// 空の ▽ での変換は ▽ を取り消す
+		{"K a Backspace SPC a RET", "あ"},
+		// 空の ▽ の後の大文字は送り仮名にしない
+		{"K a Backspace K a n j i SPC RET RET", "漢字"},
+	} {
+		text, err := skktest.Type(M, skktest.Keys(c.keys)...)
+		if err != nil {
+			t.Fatalf("%s: %s", c.keys, err.Error())
+		}
+		if text != c.expected {
+			t.Fatalf("%s: %q expected %q", c.keys, text, c.expected)
+		}
+	}
+	if len(M.User) != 0 {
+		t.Fatalf("%#v", M.User)
+	}
+}
+
+func TestBackspace(t *testing.T) {
+	M := skk.New()
+	var last skk.State
+	M.OnStateChange(func(s skk.State) { last = s })
+	for _, c := range []struct {
+		keys     string
+		expected string
+		state    skk.State
+	}{
+		// 未確定のローマ字は一文字ずつ消える
+		{"K a k y Backspace a", "かか", skk.StateMarkerWhite},
+		// ▽ まで消すと見出しの入力をやめる
+		{"a K a Backspace Backspace", "あ", skk.StateHiragana},
+		{"a K a Backspace Backspace i", "あい", skk.StateHiragana},
+		{"K a C-h C-h", "", skk.StateHiragana},
+		// abbrev モードでは仮名の入力に戻る
+		{"/ a Backspace Backspace a", "あ", skk.StateHiragana},
+	} {
+		text, err := skktest.Type(M, skktest.Keys(c.keys+" RET")...)
+		if err != nil {
+			t.Fatalf("%s: %v", c.keys, err)
+		}
+		if text != c.expected {
+			t.Fatalf("%s: %q expected %q", c.keys, text, c.expected)
+		}
+		if last != c.state {
+			t.Fatalf("%s: %v expected %v", c.keys, last, c.state)
+		}
+	}
+}
+
+func TestHenkanKatakana(t *testing.T) {
+	M := skk.New()
+	M.System["ぺーじ"] = []string{"ぺーじ", "頁"}
+	M.System["かi"] = []string{"買"}
+	for _, c := range []struct {
+		keys     string
+		expected string
+	}{
+		{"P e - j i SPC q", "ページ"},
+		// 送り仮名もカタカナにする
+		{"K a I q", "買イ"},
+		// 確定した後は続けて入力できる
+		{"P e - j i SPC q a", "ページあ"},
+	} {
+		text, err := skktest.Type(M, skktest.Keys(c.keys+" RET")...)
+		if err != nil {
+			t.Fatalf("%s: %v", c.keys, err)
+		}
+		if text != c.expected {
+			t.Fatalf("%s: %q expected %q", c.keys, text, c.expected)
+		}
+	}
+}
+
+func TestKanaModeCommands(t *testing.T) {
+	M := skk.New()
+	M.KeyBindings = map[keys.Code]string{
+		keys.CtrlO: "SKK_KATAKANA_MODE",
+		keys.CtrlT: "SKK_HIRAGANA_MODE",
+	}
+	var last skk.State
+	M.OnStateChange(func(s skk.State) { last = s })
+	for _, c := range []struct {
+		keys     string
+		expected string
+		state    skk.State
+	}{
+		// 何度押しても同じモードになる
+		{"C-o k a C-o k a", "カカ", skk.StateKatakana},
+		{"C-o k a C-t k a C-t k a", "カかか", skk.StateHiragana},
+		// アプリケーションが割り当てれば英字モードからも切り替えられる
+		{"l a C-o k a", "aカ", skk.StateKatakana},
+	} {
+		var editor rl.Editor
+		editor.BindKey(keys.CtrlO, M.CmdKatakanaMode())
+		text, err := skktest.TypeEditor(context.Background(), &editor, M, skktest.Keys(c.keys+" RET")...)
+		if err != nil {
+			t.Fatalf("%s: %v", c.keys, err)
+		}
+		if text != c.expected {
+			t.Fatalf("%s: %q expected %q", c.keys, text, c.expected)
+		}
+		if last != c.state {
+			t.Fatalf("%s: %v expected %v", c.keys, last, c.state)
+		}
+	}
+}
+
+func TestInputByCode(t *testing.T) {
+	M := skk.New()
+	for _, c := range []struct {
+		keys     string
+		expected string
+	}{
+		{`\ 2 4 2 2 RET`, "あ"},
+		{`\ a 4 a 2 RET`, "あ"},
+		{`\ U + 1 F 4 9 0 RET`, "💐"},
+		// 入力した文字の後は仮名の入力が続く
+		{`k a \ u 3 0 4 2 RET k a`, "かあか"},
+		{`\ z z RET`, ""},
+		// 空のコードは記号の一覧から選ぶ
+		{`\ RET s`, "、"},
+		{`\ RET SPC s`, "！"},
+		{`\ RET x s`, "、"},
+		{`\ RET C-g`, ""},
+	} {
+		text, err := skktest.Type(M, skktest.Keys(c.keys+" RET")...)
+		if err != nil {
+			t.Fatalf("%s: %v", c.keys, err)
+		}
+		if text != c.expected {
+			t.Fatalf("%s: %q expected %q", c.keys, text, c.expected)
+		}
+	}
+}
+
+func TestAbbrevCharName(t *testing.T) {
+	M := skk.New()
+	for _, c := range []struct {
+		keys     string
+		expected string
+	}{
+		{"/ : b o u q u e t : SPC RET", "💐"},
+		{"/ U + 1 F 4 9 0 SPC RET", "💐"},
+		{"/ : t a d a : SPC RET", "🎉"},
+	} {
+		text, err := skktest.Type(M, skktest.Keys(c.keys+" RET")...)
+		if err != nil {
+			t.Fatalf("%s: %v", c.keys, err)
+		}
+		if text != c.expected {
+			t.Fatalf("%s: %q expected %q", c.keys, text, c.expected)
+		}
+	}
+	if len(M.User) != 0 {
+		t.Fatalf("%#v", M.User)
+	}
+}
+
+func TestToday(t *testing.T) {
+	M := skk.New()
+	M.DateFormats = []string{"2006-01-02"}
+	before := time.Now().Format("2006-01-02")
+	text, err := skktest.Type(M, skktest.Keys("k a @ RET")...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if after := time.Now().Format("2006-01-02"); text != "か"+before && text != "か"+after {
+		t.Fatalf("%q", text)
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	M := skk.New()
+	M.System["かんじ"] = []string{"漢字", "感じ"}
+	M.System["かk"] = []string{"書"}
+	for _, c := range []struct {
+		keys     string
+		expected string
+	}{
+		{"K a n C-c", "かn"},
+		{"K a n j i SPC C-c", "かんじ"},
+		{"K a n j i SPC SPC SPC C-c", "かんじ"},
+		// 登録中の Ctrl-C も変換を抜けて入力を中断する
+		{"K a n j i SPC SPC SPC a C-c", "かんじ"},
+		{"K a n j i SPC SPC SPC K a n j i SPC C-c", "かんじ"},
+		{"K a K C-c", "かk"},
+		{"K a K SPC C-c", "かk"},
+	} {
+		// 行を消さずに中断するホストの Ctrl-C で残った行を調べる
+		editor := &rl.Editor{}
+		editor.BindKey(keys.CtrlC, &rl.GoCommand{
+			Name: "TEST_INTR",
+			Func: func(context.Context, *rl.Buffer) rl.Result { return rl.INTR },
+		})
+		text, err := skktest.TypeEditor(context.Background(), editor, M, skktest.Keys(c.keys)...)
+		if !errors.Is(err, rl.CtrlC) {
+			t.Fatalf("%s: %v", c.keys, err)
+		}
+		if text != c.expected {
+			t.Fatalf("%s: %q expected %q", c.keys, text, c.expected)
+		}
+		if st := M.State(); st != (skk.Status{Mode: skk.StateHiragana}) {
+			t.Fatalf("%s: %#v", c.keys, st)
+		}
+	}
+	if len(M.User) != 0 {
+		t.Fatalf("%#v", M.User)
+	}
+	// 中断した後も続けて入力できる
+	text, err := skktest.Type(M, skktest.Keys("K a n j i SPC RET RET")...)
+	if err != nil || text != "漢字" {
+		t.Fatalf("%q %v", text, err)
+	}
+}
+
+func TestState(t *testing.T) {
+	M := skk.New()
+	M.System["かんじ"] = []string{"漢字"}
+	var log []skk.Status
+	M.OnStateChange(func(skk.State) {
+		log = append(log, M.State())
+	})
+	_, err := skktest.Type(M, skktest.Keys("K a n j i SPC C-j l RET")...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expect := []skk.Status{
+		{Mode: skk.StateHiragana},
+		{Mode: skk.StateHiragana, Pending: skk.StateMarkerWhite},
+		{Mode: skk.StateHiragana, Pending: skk.StateMarkerBlack, Reading: "かんじ"},
+		{Mode: skk.StateHiragana},
+		{Mode: skk.StateLatin},
+	}
+	if len(log) != len(expect) {
+		t.Fatalf("%#v", log)
+	}
+	for i := range expect {
+		if log[i] != expect[i] {
+			t.Fatalf("[%d] %#v != %#v", i, log[i], expect[i])
+		}
+	}
+}
+
+func TestMacro(t *testing.T) {
+	M := skk.New()
+	M.System["かんじ"] = []string{"漢字", "感じ"}
+	M.StartRecording()
+	if _, err := skktest.Type(M, skktest.Keys("K a n j i SPC SPC C-j RET")...); err != nil {
+		t.Fatal(err.Error())
+	}
+	macro := M.StopRecording()
+	if expect := skktest.Keys("K a n j i SPC SPC C-j RET"); !slices.Equal(macro, expect) {
+		t.Fatalf("%q", macro)
+	}
+	var editor rl.Editor
+	editor.BindKey(keys.CtrlO, M.CmdReplayMacro(macro))
+	text, err := skktest.TypeEditor(context.Background(), &editor, M, skktest.Keys("C-o")...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if text != "感じ" {
+		t.Fatalf("%q", text)
+	}
+}
+
+func TestKill(t *testing.T) {
+	M := skk.New()
+	var states []skk.State
+	M.OnStateChange(func(s skk.State) { states = append(states, s) })
+	text, err := skktest.Type(M, skktest.Keys("a K a n a C-u i RET")...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if text != "い" {
+		t.Fatalf("%q", text)
+	}
+	expect := []skk.State{skk.StateHiragana, skk.StateMarkerWhite, skk.StateHiragana}
+	if !slices.Equal(states, expect) {
+		t.Fatalf("%v", states)
+	}
+}
+
+func TestHostEnter(t *testing.T) {
+	M := skk.New()
+	var editor rl.Editor
+	editor.BindKey(keys.Enter, &rl.GoCommand{
+		Name: "HOST_ENTER",
+		Func: func(_ context.Context, B *rl.Buffer) rl.Result {
+			B.InsertAndRepaint("$")
+			return rl.ENTER
+		},
+	})
+	text, err := skktest.TypeEditor(context.Background(), &editor, M, skktest.Keys("K a RET")...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if text != "か$" {
+		t.Fatalf("%q", text)
+	}
+}
+
+// benchmarkType types keyStrokes on M for each iteration and reports
+// the time per keystroke.
+func benchmarkType(b *testing.B, M *skk.Mode, expected string, keyStrokes []string) {
+	b.Helper()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		text, err := skktest.Type(M, keyStrokes...)
+		if err != nil {
+			b.Fatal(err.Error())
+		}
+		if text != expected {
+			b.Fatalf("%q, expected %q", text, expected)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(keyStrokes)), "ns/key")
+}
+
+func BenchmarkTypeSentence(b *testing.B) {
+	M := skk.New()
+	M.System["かんじ"] = []string{"漢字", "感じ"}
+	M.System["へんかん"] = []string{"変換"}
+	M.System["にゅうりょく"] = []string{"入力"}
+	benchmarkType(b, M, "漢字を変換して入力する",
+		skktest.Keys("K a n j i SPC w o H e n k a n n SPC s i t e N y u u r y o k u SPC s u r u RET"))
+}
+
+func BenchmarkTypeOkuriAri(b *testing.B) {
+	M := skk.New()
+	M.System["かk"] = []string{"書", "欠", "掛", "描"}
+	// 送り仮名の子音で変換が始まる
+	benchmarkType(b, M, "描く", skktest.Keys("K a K SPC SPC SPC u RET"))
+}
+
+func BenchmarkTypeNumeric(b *testing.B) {
+	M := skk.New()
+	M.System["#かい"] = []string{"#1回", "#3回"}
+	benchmarkType(b, M, "一二回", skktest.Keys("Q 1 2 k a i SPC SPC C-j RET"))
+}
+
+func BenchmarkTypeManyCandidates(b *testing.B) {
+	M := skk.New()
+	list := make([]string, 5000)
+	for i := range list {
+		list[i] = fmt.Sprintf("候補%d;注釈", i)
+	}
+	M.System["こうほ"] = list
+	// 一覧を開いて 19 ページ送ってから選ぶ
+	keyStrokes := skktest.Keys("K o u h o SPC SPC SPC SPC")
+	for i := 0; i < 20; i++ {
+		keyStrokes = append(keyStrokes, " ")
+	}
+	keyStrokes = append(keyStrokes, skktest.Keys("a RET")...)
+	benchmarkType(b, M, "候補156", keyStrokes)
+}
+
+func TestSpecialKeysInHenkan(t *testing.T) {
+	M := skk.New()
+	M.System["かんじ"] = []string{"漢字", "感じ"}
+	// 割り当てのない F5 のエスケープシーケンスは確定だけして挿入しない
+	text, err := skktest.Type(M, append(skktest.Keys("K a n j i SPC"), string(keys.F5), string(keys.Enter))...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if text != "漢字" {
+		t.Fatalf("%q", text)
+	}
+	// 割り当てのある ← は確定してからカーソルを動かす
+	text, err = skktest.Type(M, append(skktest.Keys("K a n j i SPC"), string(keys.Left), "a", string(keys.Enter))...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if text != "漢あ字" {
+		t.Fatalf("%q", text)
+	}
+	// ↓↑ は確定せず候補を選び直す
+	text, err = skktest.Type(M, append(skktest.Keys("K a n j i SPC"), string(keys.Down), string(keys.Up), string(keys.Down), string(keys.Enter), string(keys.Enter))...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if text != "感じ" {
+		t.Fatalf("%q", text)
+	}
+}
+
+func TestBracketedPaste(t *testing.T) {
+	const pasteStart, pasteEnd = "\x1B[200~", "\x1B[201~"
+	M := skk.New()
+	M.System["かんじ"] = []string{"漢字", "感じ"}
+	for _, c := range []struct {
+		asRomaji bool
+		keys     []string
+		expected string
+	}{
+		// かなモードでも貼り付けた文字列はそのまま挿入する
+		{false, []string{"a", pasteStart, "kanji\tA", pasteEnd, "i", string(keys.Enter)}, "あkanjiAい"},
+		{true, []string{pasteStart, "kanji", pasteEnd, string(keys.Enter)}, "かんじ"},
+		// 変換中の貼り付けは確定してから挿入する
+		{false, append(skktest.Keys("K a n j i SPC"), pasteStart+"ab"+pasteEnd, string(keys.Enter)), "漢字ab"},
+		{false, append(skktest.Keys("K a n j i SPC"), pasteStart, "ab", pasteEnd, string(keys.Enter)), "漢字ab"},
+	} {
+		M.PasteAsRomaji = c.asRomaji
+		text, err := skktest.Type(M, c.keys...)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if text != c.expected {
+			t.Fatalf("%q: %q expected %q", c.keys, text, c.expected)
+		}
+	}
+}
+
+func TestControlQueued(t *testing.T) {
+	M := skk.New()
+	path := filepath.Join(t.TempDir(), "skk.sock")
+	if err := M.ListenControl(path); err != nil {
+		t.Skip(err.Error())
+	}
+	defer M.Close()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	var editor rl.Editor
+	// 要求は応答の後、次のキーを処理する前に反映される
+	editor.BindKey(keys.F1, &rl.GoCommand{
+		Name: "CONTROL",
+		Func: func(ctx context.Context, B *rl.Buffer) rl.Result {
+			fmt.Fprintln(conn, "katakana")
+			if line, err := r.ReadString('\n'); err != nil || line != "ok\n" {
+				t.Errorf("%q %v", line, err)
+			}
+			return rl.CONTINUE
+		},
+	})
+	text, err := skktest.TypeEditor(context.Background(), &editor, M, skktest.Keys("a F1 a RET")...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if text != "あア" {
+		t.Fatalf("%q", text)
+	}
+}
@@ -0,0 +1,88 @@
+package skk
+
+import (
+	"context"
+	"iter"
+	"sort"
+)
+
+// CandidateSource is the interface of the sources of candidates such as
+// local dictionaries, servers and programs. Dictionary satisfies it.
+type CandidateSource interface {
+	// Lookup returns the candidates for source.
+	Lookup(source string) ([]string, bool)
+}
+
+// StreamSource is the interface of CandidateSource which can return
+// the candidates lazily, such as a server with a large number of candidates.
+// The conversion reads the candidates only as many as shown.
+type StreamSource interface {
+	CandidateSource
+	LookupSeq(source string) (iter.Seq[string], bool)
+}
+
+// ContextSource is the interface of CandidateSource which can be canceled,
+// such as a server or a program. The conversion gives up the lookup by
+// the deadline of Mode.RemoteTimeout or C-g, and the sources after it
+// are looked up instead.
+type ContextSource interface {
+	CandidateSource
+	LookupContext(ctx context.Context, source string) ([]string, bool)
+}
+
+// Completer is the interface of CandidateSource which can enumerate
+// the midashi starting with a prefix.
+type Completer interface {
+	Complete(prefix string) []string
+}
+
+// Registerer is the interface of CandidateSource which wants to know
+// the words registered by the user.
+type Registerer interface {
+	Register(source, word string) error
+}
+
+// Complete returns the sorted midashi starting with prefix.
+func (j Jisyo) Complete(prefix string) []string {
+	return j.PrefixSearch(prefix)
+}
+
+// sources returns the candidate sources used by the conversion.
+func (M *Mode) sources() []CandidateSource {
+	if M.Sources != nil {
+		return M.Sources
+	}
+	return []CandidateSource{M.user(), M.system()}
+}
+
+// Complete returns the sorted midashi starting with prefix
+// from all the sources which implement Completer.
+func (M *Mode) Complete(prefix string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, s := range M.sources() {
+		if c, ok := s.(Completer); ok {
+			for _, midashi := range c.Complete(prefix) {
+				if !seen[midashi] {
+					seen[midashi] = true
+					result = append(result, midashi)
+				}
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// registerToSources tells the sources which implement Registerer
+// that word is registered for source.
+func (M *Mode) registerToSources(source, word string) error {
+	for _, s := range M.sources() {
+		if r, ok := s.(Registerer); ok {
+			if err := r.Register(source, word); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
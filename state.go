@@ -0,0 +1,102 @@
+package skk
+
+// State is the state of the SKK input notified by the callback set with OnStateChange.
+type State int
+
+const (
+	// StateLatin means that SKK does not convert input. (直接入力)
+	StateLatin State = iota
+	// StateHiragana means the hiragana input mode. ([か])
+	StateHiragana
+	// StateKatakana means the katakana input mode. ([カ])
+	StateKatakana
+	// StateAbbrev means the abbrev mode. ([aあ])
+	StateAbbrev
+	// StateJisx0208Latin means the JIS X 0208 latin mode. ([英])
+	StateJisx0208Latin
+	// StateMarkerWhite means that the reading to convert is being typed. (▽)
+	StateMarkerWhite
+	// StateMarkerBlack means that a candidate is shown. (▼)
+	StateMarkerBlack
+	// StateRegistering means that the dictionary registration mode started.
+	StateRegistering
+	// StateKakutei means that the converted text is confirmed.
+	StateKakutei
+)
+
+var stateNames = [...]string{
+	StateLatin:         "Latin",
+	StateHiragana:      "Hiragana",
+	StateKatakana:      "Katakana",
+	StateAbbrev:        "Abbrev",
+	StateJisx0208Latin: "Jisx0208Latin",
+	StateMarkerWhite:   "MarkerWhite",
+	StateMarkerBlack:   "MarkerBlack",
+	StateRegistering:   "Registering",
+	StateKakutei:       "Kakutei",
+}
+
+func (s State) String() string {
+	if 0 <= s && int(s) < len(stateNames) {
+		return stateNames[s]
+	}
+	return "State(?)"
+}
+
+// OnStateChange sets the function called whenever the state of SKK changes.
+func (M *Mode) OnStateChange(f func(State)) {
+	M.onStateChange = f
+}
+
+// modeHook is called with the input mode by all the instances,
+// and with StateLatin when the line is accepted.
+// It is set by the optional integrations with the platform such as imecontrol.
+var modeHook func(M *Mode, s State)
+
+func (M *Mode) notify(s State) {
+	M.debugf("state %s", s)
+	if M.onStateChange != nil {
+		M.onStateChange(s)
+	}
+	if s <= StateJisx0208Latin && s != M.reportedMode {
+		// 同じモードのままなら入力モードの変化として通知しない
+		M.reportedMode = s
+		if modeHook != nil {
+			modeHook(M, s)
+		}
+		if M.onModeChange != nil {
+			M.onModeChange(s)
+		}
+	}
+}
+
+// OnModeChange sets the function called when the input mode changes
+// to StateLatin, StateHiragana, StateKatakana, StateAbbrev or StateJisx0208Latin.
+func (M *Mode) OnModeChange(f func(State)) {
+	M.onModeChange = f
+}
+
+// OnKakutei sets the function called with the text confirmed.
+func (M *Mode) OnKakutei(f func(text string)) {
+	M.onKakutei = f
+}
+
+// OnRegister sets the function called when a new word is registered
+// to the user dictionary.
+func (M *Mode) OnRegister(f func(source, word string)) {
+	M.onRegister = f
+}
+
+// OnPurge sets the function called when a candidate is purged
+// from the user dictionary.
+func (M *Mode) OnPurge(f func(source, candidate string)) {
+	M.onPurge = f
+}
+
+// kakuteiDone notifies that text is confirmed.
+func (M *Mode) kakuteiDone(text string) {
+	M.notify(StateKakutei)
+	if M.onKakutei != nil {
+		M.onKakutei(text)
+	}
+}
@@ -0,0 +1,49 @@
+//go:build !js && !plan9
+
+package skk
+
+// Status is the state of SKK in an editor returned by Mode.State.
+type Status struct {
+	// Mode is the input mode: StateLatin, StateHiragana, StateKatakana,
+	// StateAbbrev or StateJisx0208Latin.
+	Mode State
+	// Pending is StateMarkerWhite(▽) or StateMarkerBlack(▼) while
+	// a conversion is not confirmed yet. Otherwise it is StateLatin.
+	Pending State
+	// Reading is the reading being converted. It is empty
+	// when no conversion is pending.
+	Reading string
+	// Loading is true while a dictionary is loaded in background.
+	// The UI can show it since the conversion finds nothing meanwhile.
+	Loading bool
+}
+
+// IsPending reports whether the buffer has a region not confirmed yet.
+// The hosts can use it not to accept the line while converting.
+func (s Status) IsPending() bool {
+	return s.Pending == StateMarkerWhite || s.Pending == StateMarkerBlack
+}
+
+// State returns the input mode and the pending conversion of the editor
+// which called SKK last. Use it in the callbacks such as OnStateChange
+// or before the host accepts the line.
+func (M *Mode) State() Status {
+	M.statesMutex.Lock()
+	st := M.current
+	M.statesMutex.Unlock()
+	if st == nil || st.buffer == nil {
+		return Status{Loading: M.loading()}
+	}
+	status := Status{Mode: st.mode, Loading: M.loading()}
+	start, end, pending, ok := M.Region(st.buffer)
+	if !ok {
+		return status
+	}
+	status.Pending = pending
+	if pending == StateMarkerBlack && st.source != "" {
+		status.Reading = st.source
+	} else if start+1 <= end {
+		status.Reading = st.buffer.SubString(start+1, end)
+	}
+	return status
+}
@@ -0,0 +1,152 @@
+package skk
+
+// EditorSurface is the minimal operations of a line editor used by
+// InputRomaji and Kakutei, so that line editors other than go-readline-ny
+// can input kana with the romaji and the marker ▽. The conversion with ▼,
+// which reads the keys selecting the candidates, is done only on
+// go-readline-ny; the other editors can show the candidates of Convert
+// by themselves. The positions are counted in the cells (characters)
+// of the line.
+type EditorSurface interface {
+	// Cursor returns the position of the cursor.
+	Cursor() int
+	// Len returns the number of the cells of the line.
+	Len() int
+	// SubString returns the text of the cells [start,end).
+	SubString(start, end int) string
+	// Insert inserts s at the cursor, moves the cursor after it
+	// and updates the screen.
+	Insert(s string)
+	// Replace replaces the cells from start to the cursor with s,
+	// moves the cursor after it and updates the screen.
+	Replace(start int, s string)
+	// Delete removes the cell at pos. The cursor moves left
+	// when pos is before it. The screen is updated by Repaint.
+	Delete(pos int)
+	// Repaint redraws the line.
+	Repaint()
+}
+
+// lineSurface is EditorSurface on a slice of runes without a screen.
+type lineSurface struct {
+	line   []rune
+	cursor int
+}
+
+func (s *lineSurface) Cursor() int { return s.cursor }
+
+func (s *lineSurface) Len() int { return len(s.line) }
+
+func (s *lineSurface) SubString(start, end int) string { return string(s.line[start:end]) }
+
+func (s *lineSurface) Insert(text string) { s.Replace(s.cursor, text) }
+
+func (s *lineSurface) Replace(start int, text string) {
+	r := []rune(text)
+	s.line = append(append(append([]rune{}, s.line[:start]...), r...), s.line[s.cursor:]...)
+	s.cursor = start + len(r)
+}
+
+func (s *lineSurface) Delete(pos int) {
+	s.line = append(s.line[:pos], s.line[pos+1:]...)
+	if pos < s.cursor {
+		s.cursor--
+	}
+}
+
+func (s *lineSurface) Repaint() {}
+
+func (M *Mode) seekMarker(S EditorSurface) int {
+	for i := S.Cursor() - 1; i >= 0; i-- {
+		ch := S.SubString(i, i+1)
+		if ch == M.white() || ch == M.black() {
+			return i
+		}
+	}
+	return -1
+}
+
+func removeOne(S EditorSurface, pos int) {
+	S.Delete(pos)
+	S.Repaint()
+}
+
+// kakutei confirms the text after the marker at markerPos.
+func (M *Mode) kakutei(S EditorSurface, markerPos int) {
+	removeOne(S, markerPos)
+	M.kakuteiDone(S.SubString(markerPos, S.Cursor()))
+}
+
+// stripMarkers removes all markers left in the line.
+func (M *Mode) stripMarkers(S EditorSurface) {
+	removed := false
+	for i := S.Len() - 1; i >= 0; i-- {
+		ch := S.SubString(i, i+1)
+		if ch == M.white() || ch == M.black() {
+			S.Delete(i)
+			removed = true
+		}
+	}
+	if removed {
+		S.Repaint()
+	}
+}
+
+// inputRomaji converts last and the romaji before the cursor with the table of K.
+func (M *Mode) inputRomaji(S EditorSurface, K *_Kana, last string) {
+	for i := 3; i > 0; i-- {
+		if cursor := S.Cursor(); cursor >= i {
+			key := S.SubString(cursor-i, cursor) + last
+			if value, ok := K.table[key]; ok {
+				M.debugf("romaji %q -> %q", key, value)
+				S.Replace(cursor-i, value)
+				return
+			}
+		}
+	}
+	if value, ok := K.table[last]; ok {
+		if value == markerWhite && M != nil {
+			value = M.white()
+		}
+		M.debugf("romaji %q -> %q", last, value)
+		S.Insert(value)
+		if M != nil && value == M.white() {
+			M.notify(StateMarkerWhite)
+		}
+	} else {
+		S.Insert(last)
+	}
+}
+
+// InputRomaji processes key typed in the hiragana mode (or the katakana mode
+// when katakana is true) on S for the editors other than go-readline-ny.
+// A lower case letter is converted to kana with the romaji before the cursor,
+// and an upper case letter starts the reading to convert with ▽.
+func (M *Mode) InputRomaji(S EditorSurface, key string, katakana bool) {
+	K := M.kanas()[0]
+	state := StateHiragana
+	if katakana {
+		K = M.kanas()[1]
+		state = StateKatakana
+	}
+	M.countKey(state)
+	if len(key) == 1 && 'A' <= key[0] && key[0] <= 'Z' {
+		key = string(key[0] - 'A' + 'a')
+		if M.seekMarker(S) < 0 {
+			S.Insert(M.white())
+			M.notify(StateMarkerWhite)
+		}
+	}
+	M.inputRomaji(S, K, key)
+}
+
+// Kakutei confirms the reading after ▽ or the candidate after ▼ on S.
+// It returns false when there is no marker before the cursor.
+func (M *Mode) Kakutei(S EditorSurface) bool {
+	markerPos := M.seekMarker(S)
+	if markerPos < 0 {
+		return false
+	}
+	M.kakutei(S, markerPos)
+	return true
+}
@@ -0,0 +1,36 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	rl "github.com/nyaosorg/go-readline-ny"
+)
+
+// bufferSurface is EditorSurface of go-readline-ny.
+type bufferSurface struct {
+	B *rl.Buffer
+}
+
+func surfaceOf(B *rl.Buffer) EditorSurface {
+	return bufferSurface{B: B}
+}
+
+func (s bufferSurface) Cursor() int { return s.B.Cursor }
+
+func (s bufferSurface) Len() int { return len(s.B.Buffer) }
+
+func (s bufferSurface) SubString(start, end int) string { return s.B.SubString(start, end) }
+
+func (s bufferSurface) Insert(text string) { s.B.InsertAndRepaint(text) }
+
+func (s bufferSurface) Replace(start int, text string) { s.B.ReplaceAndRepaint(start, text) }
+
+func (s bufferSurface) Delete(pos int) {
+	copy(s.B.Buffer[pos:], s.B.Buffer[pos+1:])
+	s.B.Buffer = s.B.Buffer[:len(s.B.Buffer)-1]
+	if pos < s.B.Cursor {
+		s.B.Cursor--
+	}
+}
+
+func (s bufferSurface) Repaint() { s.B.RepaintAfterPrompt() }
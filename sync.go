@@ -0,0 +1,156 @@
+package skk
+
+import (
+	"sync"
+)
+
+// SyncDictionary is a Dictionary guarded by a mutex.
+//
+// A Mode serves one ReadLine at a time, but its dictionaries can be
+// touched from other goroutines: another ReadLine sharing the Mode's
+// dictionaries, or the host saving the user dictionary. In such cases,
+// set a SyncDictionary to Mode.UserDictionary (or call Mode.Synchronize).
+type SyncDictionary struct {
+	mu         sync.RWMutex
+	dictionary Dictionary
+}
+
+// NewSyncDictionary returns a SyncDictionary wrapping d.
+func NewSyncDictionary(d Dictionary) *SyncDictionary {
+	return &SyncDictionary{dictionary: d}
+}
+
+// Lookup returns a copy of the candidates for source.
+func (S *SyncDictionary) Lookup(source string) ([]string, bool) {
+	S.mu.RLock()
+	defer S.mu.RUnlock()
+	list, ok := S.dictionary.Lookup(source)
+	if !ok {
+		return nil, false
+	}
+	return append([]string{}, list...), true
+}
+
+// Store replaces the candidates for source.
+func (S *SyncDictionary) Store(source string, candidates []string) error {
+	S.mu.Lock()
+	defer S.mu.Unlock()
+	return S.dictionary.Store(source, candidates)
+}
+
+// Delete removes the entry for source.
+func (S *SyncDictionary) Delete(source string) error {
+	S.mu.Lock()
+	defer S.mu.Unlock()
+	return S.dictionary.Delete(source)
+}
+
+// Update replaces the candidates for source with the result of f
+// while the dictionary is locked, so that no updates by others are lost.
+func (S *SyncDictionary) Update(source string, f func(candidates []string, ok bool) []string) error {
+	S.mu.Lock()
+	defer S.mu.Unlock()
+	if u, ok := S.dictionary.(Updater); ok {
+		return u.Update(source, f)
+	}
+	list, ok := S.dictionary.Lookup(source)
+	if newList := f(list, ok); len(newList) > 0 {
+		return S.dictionary.Store(source, newList)
+	}
+	return S.dictionary.Delete(source)
+}
+
+// Share makes other use the user dictionary of M, so that the editors
+// with their own Mode (e.g. the main editor and an incremental search prompt)
+// register and purge words into one dictionary without lost updates.
+// The user dictionary is wrapped by SyncDictionary.
+// The changes by other are saved by the auto-save and Close of M
+// as the ones by M are, and the recency of the entries and the metrics
+// of other are counted in M.
+func (M *Mode) Share(other *Mode) {
+	S := M.Synchronize()
+	other.User = M.User
+	other.UserDictionary = S
+	other.sharedBy = M
+}
+
+// root returns the Mode which the changes of the user dictionary by M
+// are saved by, following Share and the registration in the minibuffer.
+func (M *Mode) root() *Mode {
+	for M.sharedBy != nil {
+		M = M.sharedBy
+	}
+	return M
+}
+
+// PrefixSearch returns the midashi starting with prefix
+// when the wrapped dictionary supports it.
+func (S *SyncDictionary) PrefixSearch(prefix string) []string {
+	S.mu.RLock()
+	defer S.mu.RUnlock()
+	if ps, ok := S.dictionary.(PrefixSearcher); ok {
+		return ps.PrefixSearch(prefix)
+	}
+	return nil
+}
+
+// Complete is the same as PrefixSearch.
+func (S *SyncDictionary) Complete(prefix string) []string {
+	return S.PrefixSearch(prefix)
+}
+
+// Synchronize makes the user dictionary safe for concurrent use
+// by wrapping it with SyncDictionary.
+func (M *Mode) Synchronize() *SyncDictionary {
+	if S, ok := M.UserDictionary.(*SyncDictionary); ok {
+		return S
+	}
+	S := NewSyncDictionary(M.user())
+	M.UserDictionary = S
+	return S
+}
+
+// Snapshot returns a copy of the user dictionary which is not changed
+// by the registrations and the purges after this call, so that it can be
+// written in another goroutine while the user keeps typing.
+// Only the map is copied: the lists of candidates are shared because
+// they are always replaced instead of being modified in place.
+func (M *Mode) Snapshot() Jisyo {
+	defer M.rlockUser()()
+	return M.User.clone()
+}
+
+// rlockUser locks the user dictionary for reading when it is synchronized,
+// and returns the function to unlock it.
+func (M *Mode) rlockUser() func() {
+	if S, ok := M.UserDictionary.(*SyncDictionary); ok {
+		S.mu.RLock()
+		return S.mu.RUnlock
+	}
+	return func() {}
+}
+
+// lockUser locks the user dictionary for writing when it is synchronized,
+// and returns the dictionary to change and the function to unlock it.
+// The dictionary returned is the one wrapped by SyncDictionary,
+// so it must not be used after unlocking.
+//
+// Every change of the user dictionary by Mode, such as the registration,
+// the purge, the eviction and the editing, is done with this lock,
+// so a change reading and writing some entries is not interleaved with
+// the changes by the other editors sharing the dictionary or with
+// the snapshots for saving. The lock of the usage of the entries may be
+// taken while it is held, but not the other way around.
+func (M *Mode) lockUser() (Dictionary, func()) {
+	if S, ok := M.UserDictionary.(*SyncDictionary); ok {
+		S.mu.Lock()
+		return S.dictionary, S.mu.Unlock
+	}
+	return M.user(), func() {}
+}
+
+// HasPrefixIndex reports whether the wrapped dictionary has an index
+// for PrefixSearch.
+func (S *SyncDictionary) HasPrefixIndex() bool {
+	return HasPrefixIndex(S.dictionary)
+}
@@ -0,0 +1,153 @@
+package skk
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSyncDictionary(t *testing.T) {
+	M := New()
+	S := M.Synchronize()
+	if M.Synchronize() != S {
+		t.Fatal("Synchronize wrapped twice")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				list, _ := M.user().Lookup("かんじ")
+				M.user().Store("かんじ", unshift(list, "漢字"))
+			}
+		}()
+	}
+	wg.Wait()
+	if list, ok := M.User.Lookup("かんじ"); !ok || list[0] != "漢字" {
+		t.Fatalf("User: %v", M.User)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	M := New()
+	M.User["かんじ"] = []string{"漢字"}
+	S := M.Synchronize()
+	snapshot := M.Snapshot()
+	S.Store("かんじ", unshift([]string{"漢字"}, "感じ"))
+	S.Store("あい", []string{"愛"})
+	if len(snapshot) != 1 || len(snapshot["かんじ"]) != 1 {
+		t.Fatalf("snapshot is changed: %#v", snapshot)
+	}
+
+	j := Jisyo{}
+	j.Read(strings.NewReader("かんじ /漢字/\n"))
+	snapshot = j.clone()
+	j.Read(strings.NewReader("かんじ /感じ/\n"))
+	if len(snapshot["かんじ"]) != 1 || len(j["かんじ"]) != 2 {
+		t.Fatalf("snapshot %#v, jisyo %#v", snapshot, j)
+	}
+}
+
+func TestShare(t *testing.T) {
+	M := New()
+	N := New()
+	M.Share(N)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		word := string(rune('A' + i%26))
+		go func() {
+			defer wg.Done()
+			M.updateUser("かんじ", func(list []string, _ bool) []string { return unshift(list, "M"+word) })
+		}()
+		go func() {
+			defer wg.Done()
+			N.updateUser("かんじ", func(list []string, _ bool) []string { return unshift(list, "N"+word) })
+		}()
+	}
+	wg.Wait()
+	if list, _ := N.lookup("かんじ"); len(list) != 200 {
+		t.Fatalf("lost updates: %d", len(list))
+	}
+	if len(M.User["かんじ"]) != 200 {
+		t.Fatalf("User is not shared: %d", len(M.User["かんじ"]))
+	}
+}
+
+func TestSharedEviction(t *testing.T) {
+	M, err := NewWithOptions(WithUserJisyoLimit(10, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	N, err := NewWithOptions(WithUserJisyoLimit(10, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	M.Share(N)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			M.Register(fmt.Sprintf("M%d", i), "語")
+		}()
+		go func() {
+			defer wg.Done()
+			N.Register(fmt.Sprintf("N%d", i), "語")
+		}()
+		go func() {
+			defer wg.Done()
+			M.Snapshot()
+			N.Compact()
+		}()
+	}
+	wg.Wait()
+	if n := len(M.Snapshot()); n != 10 {
+		t.Fatalf("%d entries", n)
+	}
+}
+
+func TestShareSavedByClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jisyo")
+	M, err := NewWithOptions(WithUserJisyo(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	N := New()
+	M.Share(N)
+	if err := N.Register("かんじ", "漢字"); err != nil {
+		t.Fatal(err)
+	}
+	if err := M.Close(); err != nil {
+		t.Fatal(err)
+	}
+	j := Jisyo{}
+	if err := j.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if list := j["かんじ"]; len(list) != 1 || list[0] != "漢字" {
+		t.Fatalf("%#v", j)
+	}
+}
+
+func TestRecentConcurrent(t *testing.T) {
+	M := New()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < maxRecent; j++ {
+				M.remember("かんじ", "漢字")
+				M.Recent()
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(M.Recent()); n != maxRecent {
+		t.Fatalf("len(Recent())=%d", n)
+	}
+}
@@ -0,0 +1,57 @@
+package skk
+
+import (
+	"io"
+)
+
+// Terminal is the control of the terminal used by the minibuffer.
+// Replace it for the terminals lacking some of the ANSI escape sequences,
+// or to record the operations in tests.
+type Terminal interface {
+	// CursorUp moves the cursor to the previous line keeping the column.
+	CursorUp(w io.Writer) (int, error)
+	// CursorDown moves the cursor to the next line keeping the column.
+	CursorDown(w io.Writer) (int, error)
+	// PrevLine moves the cursor to the head of the previous line.
+	PrevLine(w io.Writer) (int, error)
+	// EraseLine erases the whole current line.
+	EraseLine(w io.Writer) (int, error)
+	// EraseToEnd erases from the cursor to the end of the line.
+	EraseToEnd(w io.Writer) (int, error)
+}
+
+// ANSITerminal is the Terminal with the ANSI escape sequences. (default)
+type ANSITerminal struct{}
+
+func (ANSITerminal) CursorUp(w io.Writer) (int, error) {
+	return io.WriteString(w, "\x1B[A")
+}
+
+func (ANSITerminal) CursorDown(w io.Writer) (int, error) {
+	return io.WriteString(w, "\x1B[B")
+}
+
+func (ANSITerminal) PrevLine(w io.Writer) (int, error) {
+	return io.WriteString(w, "\x1B[F")
+}
+
+func (ANSITerminal) EraseLine(w io.Writer) (int, error) {
+	return io.WriteString(w, "\x1B[2K")
+}
+
+func (ANSITerminal) EraseToEnd(w io.Writer) (int, error) {
+	return io.WriteString(w, "\x1B[K")
+}
+
+// terminalOr returns t, or ANSITerminal when t is nil.
+func terminalOr(t Terminal) Terminal {
+	if t != nil {
+		return t
+	}
+	return ANSITerminal{}
+}
+
+// terminal returns the Terminal of M.
+func (M *Mode) terminal() Terminal {
+	return terminalOr(M.Terminal)
+}
@@ -0,0 +1,30 @@
+package skk
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// NewTLSConfig returns tls.Config which trusts the certificates of
+// the PEM files caFiles in addition to the system ones,
+// for the dictionary servers with a private CA.
+// The filenames may start with ~ and contain %ENV%.
+func NewTLSConfig(caFiles ...string) (*tls.Config, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	for _, fn := range caFiles {
+		fn = expandEnv(fn)
+		pem, err := os.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates", fn)
+		}
+	}
+	return &tls.Config{RootCAs: pool}, nil
+}
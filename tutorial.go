@@ -0,0 +1,156 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	rl "github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+// tutorialJisyo is the dictionary used by the exercises of the tutorial,
+// so that the answers do not depend on the dictionaries of the user.
+var tutorialJisyo = map[string][]string{
+	"かんじ":  {"漢字", "感じ", "幹事"},
+	"かk":   {"書", "描"},
+	"にほんご": {"日本語"},
+}
+
+// _Lesson is an exercise of the tutorial.
+type _Lesson struct {
+	text   []string
+	answer string
+	// check reports whether the exercise is done in addition to the answer.
+	check func(M *Mode) bool
+}
+
+var tutorialLessons = []_Lesson{
+	{
+		text: []string{
+			"SKK は Ctrl-J で起動します。ローマ字で入力するとひらがなになります。",
+			"Ctrl-J を押してから「kana」と入力し、Enter を押してください。",
+		},
+		answer: "かな",
+	},
+	{
+		text: []string{
+			"q を押すとカタカナ入力になり、もう一度 q を押すとひらがなに戻ります。",
+			"「カタカナ」と入力し、q でひらがなに戻してから Enter を押してください。",
+		},
+		answer: "カタカナ",
+	},
+	{
+		text: []string{
+			"大文字で始めると ▽ が付き、その後の読みを変換します。",
+			"「Kanji」と入力してスペースを押すと ▼漢字 になります。Ctrl-J で確定します。",
+			"「漢字」を入力して Enter を押してください。",
+		},
+		answer: "漢字",
+	},
+	{
+		text: []string{
+			"▼ の状態でスペースを押すと次の候補、x を押すと前の候補になります。",
+			"「Kanji」を変換して「感じ」を入力し、Enter を押してください。",
+		},
+		answer: "感じ",
+	},
+	{
+		text: []string{
+			"送り仮名は、その始まりを大文字で入力します。",
+			"「KaKu」と入力すると「書く」に変換されます。",
+			"「書く」を入力して Enter を押してください。",
+		},
+		answer: "書く",
+	},
+	{
+		text: []string{
+			"辞書にない読みを変換すると、辞書登録モードになります。",
+			"「Sukiru」とスペースを入力し、登録する単語として",
+			"q でカタカナにして「sukiru」と入力し Enter を押してください。",
+			"登録された「スキル」が入力されたら Enter を押してください。",
+		},
+		answer: "スキル",
+		check: func(M *Mode) bool {
+			list, _ := M.user().Lookup("すきる")
+			return slices.Contains(list, "スキル")
+		},
+	},
+	{
+		text: []string{
+			"▼ の状態で X を押すと、その候補をユーザ辞書から削除します。",
+			"「Sukiru」を変換して ▼スキル で X を押し、yes と答えてください。",
+			"行が空になったら Enter を押してください。",
+		},
+		answer: "",
+		check: func(M *Mode) bool {
+			list, _ := M.user().Lookup("すきる")
+			return !slices.Contains(list, "スキル")
+		},
+	},
+	{
+		text: []string{
+			"l を押すと直接入力(英数)に戻ります。Ctrl-J で再びひらがなになります。",
+			"l を押してから「skk」と入力し、Enter を押してください。",
+		},
+		answer: "skk",
+	},
+}
+
+// Tutorial walks the user through the kana input, the conversion,
+// the okurigana, the registration and the purge with the exercises
+// on editor. The exercises use a small dictionary of their own,
+// and the dictionaries of the user are not changed.
+// Ctrl-C skips an exercise and Ctrl-D quits the tutorial.
+func Tutorial(ctx context.Context, editor *rl.Editor) error {
+	var out io.Writer = os.Stdout
+	if editor.Writer != nil {
+		out = editor.Writer
+	}
+	M := New()
+	for source, list := range tutorialJisyo {
+		M.System[source] = list
+	}
+	promptWriter := editor.PromptWriter
+	defer func() { editor.PromptWriter = promptWriter }()
+	ctrlJ, _ := editor.Lookup(keys.CtrlJ)
+	editor.BindKey(keys.CtrlJ, M)
+	defer func() {
+		M.restoreKeyMap(editor)
+		editor.BindKey(keys.CtrlJ, ctrlJ)
+	}()
+
+	for i, lesson := range tutorialLessons {
+		fmt.Fprintf(out, "\n[%d/%d]\n", i+1, len(tutorialLessons))
+		for _, line := range lesson.text {
+			fmt.Fprintln(out, line)
+		}
+		editor.PromptWriter = func(w io.Writer) (int, error) {
+			return io.WriteString(w, "> ")
+		}
+		for {
+			line, err := editor.ReadLine(ctx)
+			if errors.Is(err, rl.CtrlC) {
+				break
+			}
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return err
+			}
+			if line == lesson.answer && (lesson.check == nil || lesson.check(M)) {
+				fmt.Fprintln(out, "正解です。")
+				break
+			}
+			fmt.Fprintf(out, "「%s」を入力してください。(Ctrl-C: 次へ, Ctrl-D: 終了)\n", lesson.answer)
+		}
+	}
+	fmt.Fprintln(out, "\nチュートリアルは終わりです。")
+	return nil
+}
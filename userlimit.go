@@ -0,0 +1,185 @@
+package skk
+
+import (
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// userUsage is the use of the entries of the user dictionary
+// in the session for the limits and Compact.
+type userUsage struct {
+	maxEntries    int
+	maxCandidates int
+	mutex         sync.Mutex
+	clock         int64
+	// used is the time the entry was registered or selected last.
+	used map[string]int64
+	// selected is the entries whose candidate was selected.
+	selected map[string]bool
+}
+
+// WithUserJisyoLimit limits the size of the user dictionary.
+// When an entry is updated and the count of the entries exceeds maxEntries,
+// the entries used least recently are removed. The user dictionary is
+// saved from the entry used most recently in each section as ddskk does,
+// and the order is taken as the recency of the entries when it is loaded,
+// so the recency is kept across the sessions.
+// The candidates of an entry updated are cut to maxCandidates.
+// Zero means no limit.
+func WithUserJisyoLimit(maxEntries, maxCandidates int) Option {
+	return func(M *Mode) error {
+		M.usage.maxEntries = maxEntries
+		M.usage.maxCandidates = maxCandidates
+		return nil
+	}
+}
+
+// touch records that the entry of source is used now.
+func (M *Mode) touch(source string, selected bool) {
+	u := &M.root().usage
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.used == nil {
+		u.used = map[string]int64{}
+		u.selected = map[string]bool{}
+	}
+	u.clock++
+	u.used[source] = u.clock
+	if selected {
+		u.selected[source] = true
+	}
+}
+
+// seedRecencyScale is the range of the recency given to the entries loaded
+// from the user dictionary, which is below that of the entries used since.
+const seedRecencyScale = 1 << 30
+
+// seedRecency gives the recency to the entries of a section of the user
+// dictionary loaded in keys from the one used most recently. The recency
+// is scaled by the length of the section so that the entries at the same
+// depth of the okuri-ari and okuri-nasi sections are as old.
+func (M *Mode) seedRecency(keys []string) {
+	u := &M.usage
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.used == nil {
+		u.used = map[string]int64{}
+		u.selected = map[string]bool{}
+	}
+	for i, key := range keys {
+		if _, ok := u.used[key]; !ok {
+			u.used[key] = -int64(i+1) * seedRecencyScale / int64(len(keys)+1)
+		}
+	}
+}
+
+// recentKeys returns the midashi of j from the one used most recently.
+func (M *Mode) recentKeys(j Jisyo) []string {
+	keys := slices.Sorted(maps.Keys(j))
+	u := &M.usage
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	sort.SliceStable(keys, func(i, j int) bool {
+		return u.used[keys[i]] > u.used[keys[j]]
+	})
+	return keys
+}
+
+// limitCandidates cuts list to the limit of the candidates.
+func (M *Mode) limitCandidates(list []string) []string {
+	if max := M.root().usage.maxCandidates; max > 0 && len(list) > max {
+		limited := list[:max:max]
+		// skk-ignore-dic-word は候補ではないので落とさない
+		for _, candidate := range list[max:] {
+			if isIgnoreDicWord(candidate) {
+				limited = append(limited, candidate)
+			}
+		}
+		return limited
+	}
+	return list
+}
+
+// evict removes the entries used least recently from the user dictionary
+// locked by lockUser while it has more entries than the limit.
+// The entry of source updated just now is kept.
+func (M *Mode) evict(user Dictionary, source string) error {
+	u := &M.root().usage
+	max := u.maxEntries
+	if max <= 0 {
+		return nil
+	}
+	ps, ok := user.(PrefixSearcher)
+	if !ok {
+		return nil
+	}
+	keys := ps.PrefixSearch("")
+	if len(keys) <= max {
+		return nil
+	}
+	u.mutex.Lock()
+	sort.SliceStable(keys, func(i, j int) bool {
+		return u.used[keys[i]] < u.used[keys[j]]
+	})
+	u.mutex.Unlock()
+	excess := len(keys) - max
+	for _, key := range keys {
+		if excess <= 0 {
+			break
+		}
+		if key == source {
+			continue
+		}
+		M.debugf("evict %s", key)
+		if err := user.Delete(key); err != nil {
+			return err
+		}
+		excess--
+	}
+	return nil
+}
+
+// Compact removes the entries of the user dictionary which have
+// no candidate, or which are not selected since the Mode was made and
+// whose candidates are the same as the system dictionary, such as
+// the ones copied by the registration and left after the registered
+// word was purged. It returns the count of the entries removed.
+func (M *Mode) Compact() (int, error) {
+	removed, err := M.compact()
+	if removed > 0 {
+		M.markDirty()
+	}
+	return removed, err
+}
+
+func (M *Mode) compact() (int, error) {
+	user, unlock := M.lockUser()
+	defer unlock()
+	ps, ok := user.(PrefixSearcher)
+	if !ok {
+		return 0, nil
+	}
+	u := &M.root().usage
+	removed := 0
+	for _, key := range ps.PrefixSearch("") {
+		u.mutex.Lock()
+		selected := u.selected[key]
+		u.mutex.Unlock()
+		list, _ := user.Lookup(key)
+		if len(list) > 0 {
+			if selected {
+				continue
+			}
+			if system, ok := M.system().Lookup(key); !ok || !slices.Equal(list, system) {
+				continue
+			}
+		}
+		if err := user.Delete(key); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,86 @@
+//go:build !js && !plan9
+
+package skk
+
+import (
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+	rl "github.com/nyaosorg/go-readline-ny"
+)
+
+var widthCondition = &runewidth.Condition{EastAsianWidth: false}
+
+// SetAmbiguousWidth sets the display width (1 or 2) of East Asian Ambiguous
+// characters. It is used to fit prompts and candidate listings into the terminal,
+// and is also applied to the markers(▽ and ▼) for go-readline-ny.
+func SetAmbiguousWidth(width int) {
+	widthCondition = &runewidth.Condition{EastAsianWidth: width >= 2}
+	for _, m := range []string{markerWhite, markerBlack} {
+		r, _ := utf8.DecodeRuneInString(m)
+		rl.SetCharWidth(r, width)
+	}
+}
+
+// singleRuneGrapheme reports whether r is always a grapheme by itself,
+// such as ASCII, kana and kanji, so its width is that of the rune.
+func singleRuneGrapheme(r rune) bool {
+	switch {
+	case r < 0x300:
+		return true
+	case 0x3000 <= r && r < 0xA000:
+		// 結合用の濁点・半濁点を除く
+		return r != 0x3099 && r != 0x309A
+	case 0xFF01 <= r && r < 0xFFF0:
+		return true
+	}
+	return false
+}
+
+// stringWidth returns the display width of s on the terminal.
+// The width of the text of the common characters is summed up
+// without splitting it into the graphemes, which is slow.
+func stringWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		if !singleRuneGrapheme(r) {
+			return widthCondition.StringWidth(s)
+		}
+		width += widthCondition.RuneWidth(r)
+	}
+	return width
+}
+
+// fitToTerminal truncates s not to wrap when it is shown as a prompt
+// of the minibuffer. When the text wraps, the cursor can not return
+// to the editline. The rest of the line is erased by enterMiniBuffer.
+// The common characters are scanned only until the width of the
+// terminal, so a long listing costs no more than a short one.
+func fitToTerminal(B *rl.Buffer, s string) string {
+	width, _, err := B.Tty.Size()
+	if err != nil || width <= 0 {
+		return s
+	}
+	// the space after the prompt and the last column are not available.
+	limit := width - 2
+	const tail = ".."
+	cut := -1
+	w := 0
+	for i, r := range s {
+		if !singleRuneGrapheme(r) {
+			if stringWidth(s) <= limit {
+				return s
+			}
+			return widthCondition.Truncate(s, limit, tail)
+		}
+		rw := widthCondition.RuneWidth(r)
+		if cut < 0 && w+rw > limit-len(tail) {
+			cut = i
+		}
+		w += rw
+		if w > limit {
+			return s[:cut] + tail
+		}
+	}
+	return s
+}